@@ -0,0 +1,342 @@
+package copilotcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// anthropicRequest is the subset of the Anthropic Messages API request that
+// NewAnthropicMessagesHandler understands.
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	Messages  []anthropicMessage `json:"messages"`
+	System    anthropicContent   `json:"system"`
+	MaxTokens int                `json:"max_tokens"`
+	Stream    bool               `json:"stream"`
+}
+
+// anthropicMessage is one turn of an Anthropic conversation.
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content anthropicContent `json:"content"`
+}
+
+// anthropicContent is message or system content, sent by Anthropic clients
+// either as a plain string or as an array of content blocks. Only text blocks
+// are supported; their text is concatenated.
+type anthropicContent string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *anthropicContent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = anthropicContent(s)
+		return nil
+	}
+
+	var blocks []anthropicBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return errors.New("content must be a string or an array of content blocks")
+	}
+	var b strings.Builder
+	for _, block := range blocks {
+		if block.Type != "text" {
+			return fmt.Errorf("unsupported content block type %q", block.Type)
+		}
+		b.WriteString(block.Text)
+	}
+	*c = anthropicContent(b.String())
+	return nil
+}
+
+// anthropicBlock is an Anthropic content block.
+type anthropicBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// anthropicUsage reports token counts.
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicResponse is the Anthropic Messages API response envelope, also
+// sent inside the message_start stream event.
+type anthropicResponse struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Model        string           `json:"model"`
+	Content      []anthropicBlock `json:"content"`
+	StopReason   *string          `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        anthropicUsage   `json:"usage"`
+}
+
+// anthropicError is the Anthropic error envelope.
+type anthropicError struct {
+	Type  string               `json:"type"`
+	Error anthropicErrorDetail `json:"error"`
+}
+
+// anthropicErrorDetail describes an Anthropic error.
+type anthropicErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicStopEndTurn is the only stop reason reported: the sidecar does not
+// say why generation ended, and max_tokens is not enforced.
+const anthropicStopEndTurn = "end_turn"
+
+// NewAnthropicMessagesHandler returns an http.HandlerFunc that serves the
+// Anthropic Messages API shape, so tooling built on Anthropic SDKs can talk to
+// the sidecar. It accepts POST requests like:
+//
+//	{"model":"...","max_tokens":1024,"system":"...","messages":[{"role":"user","content":"..."}],"stream":false}
+//
+// and replies with an Anthropic message:
+//
+//	{"id":"msg_...","type":"message","role":"assistant","model":"...","content":[{"type":"text","text":"..."}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}
+//
+// Each request runs in a new session. The system field is appended to the
+// client's system message for that session, and model, when set, overrides
+// the client's model. The conversation must end with a user message; earlier
+// turns are sent along with it as a "User:"/"Assistant:" transcript. Content
+// may be a string or an array of text blocks. max_tokens is accepted but not
+// enforced. Token usage is taken from the sidecar's usage reports.
+//
+// With "stream":true, the response is sent as Server-Sent Events using the
+// Anthropic event types: message_start, content_block_start,
+// content_block_delta, content_block_stop, message_delta, and message_stop,
+// or an error event if the query fails mid-stream.
+//
+// Errors use the Anthropic error envelope:
+//
+//	{"type":"error","error":{"type":"invalid_request_error","message":"..."}}
+//
+// Example registration:
+//
+//	mux.HandleFunc("POST /v1/messages", copilotcli.NewAnthropicMessagesHandler(client))
+func NewAnthropicMessagesHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	return RateLimit(h, withJSONContentType(h, h.writeAnthropicError, withHandlerTimeout(h, func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeAnthropicError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+
+		prompt, err := anthropicPrompt(req.Messages)
+		if err != nil {
+			h.writeAnthropicError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts := QueryOptions{
+			Prompt:        prompt,
+			Model:         req.Model,
+			SystemMessage: string(req.System),
+		}
+		model := req.Model
+		if model == "" {
+			model = client.Model()
+		}
+
+		if req.Stream {
+			streamAnthropic(w, r, client, h, opts, model)
+			return
+		}
+
+		result, err := client.QueryWithOptions(r.Context(), opts)
+		if err != nil {
+			setRetryAfter(w, err)
+			h.writeAnthropicError(w, errorStatus(err), err.Error())
+			return
+		}
+
+		stop := anthropicStopEndTurn
+		h.writeJSON(w, http.StatusOK, anthropicResponse{
+			ID:         anthropicMessageID(result.SessionID),
+			Type:       "message",
+			Role:       "assistant",
+			Model:      model,
+			Content:    []anthropicBlock{{Type: "text", Text: result.Content}},
+			StopReason: &stop,
+			Usage: anthropicUsage{
+				InputTokens:  result.Usage.InputTokens,
+				OutputTokens: result.Usage.OutputTokens,
+			},
+		})
+	})))
+}
+
+// streamAnthropic runs opts as a stream and writes it as Anthropic SSE events,
+// configured by h.
+func streamAnthropic(w http.ResponseWriter, r *http.Request, client CopilotClient, h *Client, opts QueryOptions, model string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.writeAnthropicError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	// Cancel the stream whenever the handler returns early so the session
+	// aborts.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	events, sessionID, err := client.QueryStreamWithOptions(ctx, opts)
+	if err != nil {
+		h.writeAnthropicError(w, errorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(name string, data any) bool {
+		return writeSSEEvent(w, flusher.Flush, h.cfg.jsonEncoder, defaultSSEFieldNames.error, name, "", data) == nil
+	}
+	delta := func(text string) bool {
+		return write("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]string{"type": "text_delta", "text": text},
+		})
+	}
+
+	if !write("message_start", map[string]any{
+		"type": "message_start",
+		"message": anthropicResponse{
+			ID:      anthropicMessageID(sessionID),
+			Type:    "message",
+			Role:    "assistant",
+			Model:   model,
+			Content: []anthropicBlock{},
+		},
+	}) || !write("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": anthropicBlock{Type: "text"},
+	}) {
+		return
+	}
+
+	for {
+		var event StreamEvent
+		select {
+		case event, ok = <-events:
+		case <-ctx.Done():
+			if errors.Is(context.Cause(ctx), errHandlerTimeout) {
+				write("error", anthropicErrorBody(http.StatusGatewayTimeout, errHandlerTimeout.Error()))
+			}
+			return
+		}
+		if !ok {
+			return
+		}
+
+		switch {
+		case event.Error != nil:
+			write("error", anthropicErrorBody(errorStatus(event.Error), event.Error.Error()))
+			return
+		case event.IsFinal:
+			// Without deltas (streaming disabled on the client), the whole
+			// answer arrives with the final event.
+			if event.ChunkCount == 0 && event.Content != "" && !delta(event.Content) {
+				return
+			}
+			if !write("content_block_stop", map[string]any{"type": "content_block_stop", "index": 0}) ||
+				!write("message_delta", map[string]any{
+					"type":  "message_delta",
+					"delta": map[string]any{"stop_reason": anthropicStopEndTurn, "stop_sequence": nil},
+					"usage": map[string]int{"output_tokens": event.Usage.OutputTokens},
+				}) {
+				return
+			}
+			write("message_stop", map[string]string{"type": "message_stop"})
+			return
+		case event.DeltaContent != "":
+			if !delta(event.DeltaContent) {
+				return
+			}
+		}
+	}
+}
+
+// anthropicPrompt turns an Anthropic conversation into a single prompt. A
+// lone user message is sent as is; longer conversations are rendered as a
+// transcript ending with the last user message.
+func anthropicPrompt(messages []anthropicMessage) (string, error) {
+	if len(messages) == 0 {
+		return "", errors.New("messages: at least one message is required")
+	}
+	for i, m := range messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			return "", fmt.Errorf("messages.%d.role: must be \"user\" or \"assistant\"", i)
+		}
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "user" {
+		return "", errors.New("messages: the last message must have role \"user\"")
+	}
+	if strings.TrimSpace(string(last.Content)) == "" {
+		return "", errors.New("messages: the last message must not be empty")
+	}
+	if len(messages) == 1 {
+		return string(last.Content), nil
+	}
+
+	var b strings.Builder
+	for i, m := range messages {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		if m.Role == "user" {
+			b.WriteString("User: ")
+		} else {
+			b.WriteString("Assistant: ")
+		}
+		b.WriteString(string(m.Content))
+	}
+	return b.String(), nil
+}
+
+// anthropicMessageID derives an Anthropic-style message ID from a session ID.
+func anthropicMessageID(sessionID string) string {
+	return "msg_" + sessionID
+}
+
+// anthropicErrorBody builds the Anthropic error envelope for an HTTP status.
+func anthropicErrorBody(status int, msg string) anthropicError {
+	var typ string
+	switch status {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		typ = "invalid_request_error"
+	case http.StatusNotFound:
+		typ = "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		typ = "request_too_large"
+	case http.StatusTooManyRequests:
+		typ = "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		typ = "overloaded_error"
+	default:
+		typ = "api_error"
+	}
+	return anthropicError{
+		Type:  "error",
+		Error: anthropicErrorDetail{Type: typ, Message: msg},
+	}
+}
+
+func (c *Client) writeAnthropicError(w http.ResponseWriter, status int, msg string) {
+	c.writeJSON(w, status, anthropicErrorBody(status, msg))
+}
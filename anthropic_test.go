@@ -0,0 +1,156 @@
+package copilotcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postAnthropic(t *testing.T, handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewReader([]byte(body))))
+	return rec
+}
+
+func TestNewAnthropicMessagesHandler_Message(t *testing.T) {
+	var (
+		gotCfg    *copilot.SessionConfig
+		gotPrompt string
+	)
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			gotCfg = cfg
+			sess := providerSession("s1", "Paris.", "")
+			send := sess.sendFn
+			sess.sendFn = func(ctx context.Context, opts copilot.MessageOptions) (string, error) {
+				gotPrompt = opts.Prompt
+				return send(ctx, opts)
+			}
+			return sess, nil
+		},
+	}
+	handler := NewAnthropicMessagesHandler(newTestClient(mock, WithSystemMessage("Be brief.")))
+
+	rec := postAnthropic(t, handler, `{
+		"model": "claude-sonnet-4",
+		"max_tokens": 256,
+		"system": [{"type": "text", "text": "Answer in English."}],
+		"messages": [
+			{"role": "user", "content": "Capital of Italy?"},
+			{"role": "assistant", "content": "Rome."},
+			{"role": "user", "content": [{"type": "text", "text": "And France?"}]}
+		]
+	}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"id": "msg_s1",
+		"type": "message",
+		"role": "assistant",
+		"model": "claude-sonnet-4",
+		"content": [{"type": "text", "text": "Paris."}],
+		"stop_reason": "end_turn",
+		"stop_sequence": null,
+		"usage": {"input_tokens": 0, "output_tokens": 0}
+	}`, rec.Body.String())
+
+	require.NotNil(t, gotCfg)
+	assert.Equal(t, "claude-sonnet-4", gotCfg.Model)
+	require.NotNil(t, gotCfg.SystemMessage)
+	assert.Equal(t, "Be brief.\nAnswer in English.", gotCfg.SystemMessage.Content)
+	assert.Equal(t, "User: Capital of Italy?\n\nAssistant: Rome.\n\nUser: And France?", gotPrompt)
+}
+
+func TestNewAnthropicMessagesHandler_Stream(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return streamSession("s1",
+				copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("Hel")}},
+				copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("lo")}},
+				copilot.SessionEvent{Type: copilot.SessionIdle},
+			), nil
+		},
+	}
+	handler := NewAnthropicMessagesHandler(newTestClient(mock))
+
+	rec := postAnthropic(t, handler, `{"max_tokens": 64, "stream": true, "messages": [{"role": "user", "content": "hi"}]}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+
+	var names []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			names = append(names, name)
+		}
+	}
+	assert.Equal(t, []string{
+		"message_start", "content_block_start", "content_block_delta", "content_block_delta",
+		"content_block_stop", "message_delta", "message_stop",
+	}, names)
+	assert.Contains(t, rec.Body.String(), `"delta":{"text":"Hel","type":"text_delta"}`)
+	assert.Contains(t, rec.Body.String(), `"id":"msg_s1"`)
+	assert.Contains(t, rec.Body.String(), `"model":"gpt-4o"`)
+}
+
+func TestNewAnthropicMessagesHandler_StreamError(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("s1", "", "boom"), nil
+		},
+	}
+	handler := NewAnthropicMessagesHandler(newTestClient(mock))
+
+	rec := postAnthropic(t, handler, `{"stream": true, "messages": [{"role": "user", "content": "hi"}]}`)
+
+	assert.Contains(t, rec.Body.String(), "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"api_error\",\"message\":\"copilot: boom\"}}\n\n")
+	assert.NotContains(t, rec.Body.String(), "message_stop")
+}
+
+func TestNewAnthropicMessagesHandler_Errors(t *testing.T) {
+	handler := NewAnthropicMessagesHandler(newTestClient(&mockSDKClient{}))
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"invalid JSON", `{bad`, "invalid request body"},
+		{"no messages", `{"messages": []}`, "at least one message"},
+		{"last message from assistant", `{"messages": [{"role": "assistant", "content": "hi"}]}`, `role "user"`},
+		{"unknown role", `{"messages": [{"role": "tool", "content": "hi"}]}`, "messages.0.role"},
+		{"empty content", `{"messages": [{"role": "user", "content": "  "}]}`, "must not be empty"},
+		{"image block", `{"messages": [{"role": "user", "content": [{"type": "image"}]}]}`, `unsupported content block type "image"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postAnthropic(t, handler, tt.body)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			var resp anthropicError
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, "error", resp.Type)
+			assert.Equal(t, "invalid_request_error", resp.Error.Type)
+			assert.Contains(t, resp.Error.Message, tt.want)
+		})
+	}
+
+	t.Run("not connected", func(t *testing.T) {
+		client, err := New()
+		require.NoError(t, err)
+
+		rec := postAnthropic(t, NewAnthropicMessagesHandler(client), `{"messages": [{"role": "user", "content": "hi"}]}`)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"type":"overloaded_error"`)
+	})
+}
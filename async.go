@@ -0,0 +1,57 @@
+package copilotcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// QueryHandle is a query running in the background, started by QueryAsync.
+// Its methods are safe to call from any goroutine.
+type QueryHandle struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	result *QueryResult
+	err    error
+}
+
+// QueryAsync starts QueryWithSession in the background and returns a handle
+// to wait for or cancel it, so the goroutine that cancels a query need not be
+// the one waiting for it. The query also ends if ctx does.
+func (c *Client) QueryAsync(ctx context.Context, sessionID, prompt string) *QueryHandle {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &QueryHandle{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(h.done)
+		defer cancel()
+
+		h.result, h.err = c.QueryWithSession(ctx, sessionID, prompt)
+		if h.err != nil && ctx.Err() != nil && !errors.Is(h.err, ctx.Err()) {
+			// A cancellation that surfaced as another error, e.g. during
+			// session setup, still reports as one.
+			h.err = fmt.Errorf("%w: %w", ctx.Err(), h.err)
+		}
+	}()
+	return h
+}
+
+// Cancel stops the query, aborting the message its session is processing.
+// Result then returns an error matching context.Canceled. Canceling a query
+// that has already finished has no effect.
+func (h *QueryHandle) Cancel() {
+	h.cancel()
+}
+
+// Result blocks until the query finishes and returns its result. It may be
+// called any number of times.
+func (h *QueryHandle) Result() (*QueryResult, error) {
+	<-h.done
+	return h.result, h.err
+}
+
+// Done returns a channel that is closed once the query finishes, for use in
+// select statements.
+func (h *QueryHandle) Done() <-chan struct{} {
+	return h.done
+}
@@ -0,0 +1,81 @@
+package copilotcli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryAsync(t *testing.T) {
+	t.Run("result", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return providerSession("async", "done", ""), nil
+			},
+		})
+
+		h := client.QueryAsync(t.Context(), "", "hi")
+		res, err := h.Result()
+		require.NoError(t, err)
+		assert.Equal(t, "done", res.Content)
+		assert.Equal(t, "async", res.SessionID)
+
+		res, err = h.Result()
+		require.NoError(t, err, "Result can be called again")
+		assert.Equal(t, "done", res.Content)
+		h.Cancel()
+	})
+
+	t.Run("cancel from another goroutine aborts the session", func(t *testing.T) {
+		sess, aborted := silentSession()
+		sent := make(chan struct{})
+		sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+			close(sent)
+			return testMsgID, nil
+		}
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+
+		h := client.QueryAsync(t.Context(), "", "hi")
+		go func() {
+			<-sent
+			h.Cancel()
+		}()
+
+		res, err := h.Result()
+		assert.Nil(t, res)
+		require.ErrorIs(t, err, context.Canceled)
+		select {
+		case <-aborted:
+		case <-time.After(time.Second):
+			t.Fatal("session was not aborted")
+		}
+		select {
+		case <-h.Done():
+		default:
+			t.Fatal("Done is not closed after Result returns")
+		}
+	})
+
+	t.Run("cancel before the session is ready", func(t *testing.T) {
+		ready := make(chan struct{})
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				<-ready
+				return nil, assert.AnError
+			},
+		})
+
+		h := client.QueryAsync(t.Context(), "", "hi")
+		h.Cancel()
+		close(ready)
+		_, err := h.Result()
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, err, assert.AnError)
+	})
+}
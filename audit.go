@@ -0,0 +1,74 @@
+package copilotcli
+
+import (
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// QueryRecord describes one completed query for WithQueryAuditor. Prompt and
+// Response are only filled in with WithQueryAuditContent, since they may
+// contain personal data; the lengths are always set.
+type QueryRecord struct {
+	// Time is when the query started.
+	Time time.Time `json:"time"`
+	// SessionID is the session the query ran in, or the requested one if the
+	// query failed before a session was opened (empty for a new session).
+	SessionID string `json:"session_id"`
+	// Model is the model the query was sent to.
+	Model string `json:"model"`
+	// Stream reports whether the query was streamed.
+	Stream bool `json:"stream"`
+	// PromptLength and ResponseLength are in characters. ResponseLength
+	// counts the output produced before a failure, if any.
+	PromptLength   int `json:"prompt_length"`
+	ResponseLength int `json:"response_length"`
+	// Duration is how long the query took, until completion or failure.
+	Duration time.Duration `json:"duration_ns"`
+	// Error is the error message, empty on success.
+	Error string `json:"error,omitempty"`
+	// Prompt and Response are the raw texts, with WithQueryAuditContent only.
+	Prompt   string `json:"prompt,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// QueryAuditor receives a QueryRecord for every completed query. See
+// WithQueryAuditor.
+type QueryAuditor func(record QueryRecord)
+
+// beginAudit starts timing a query and returns the function that reports it
+// to the auditor. The returned function reports at most once, so concurrent
+// completion paths of a stream are safe.
+func (c *Client) beginAudit(opts QueryOptions, stream bool) func(sessionID, response string, err error) {
+	auditor := c.cfg.auditor
+	if auditor == nil {
+		return func(string, string, error) {}
+	}
+
+	start := c.cfg.clock.Now()
+	var once sync.Once
+	return func(sessionID, response string, err error) {
+		once.Do(func() {
+			if sessionID == "" {
+				sessionID = opts.SessionID
+			}
+			record := QueryRecord{
+				Time:           start,
+				SessionID:      sessionID,
+				Model:          c.sessionModel(opts.Model),
+				Stream:         stream,
+				PromptLength:   utf8.RuneCountInString(opts.Prompt),
+				ResponseLength: utf8.RuneCountInString(response),
+				Duration:       c.cfg.clock.Now().Sub(start),
+			}
+			if err != nil {
+				record.Error = err.Error()
+			}
+			if c.cfg.auditContent {
+				record.Prompt = opts.Prompt
+				record.Response = response
+			}
+			auditor(record)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package copilotcli
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAuditor collects audit records; safe for use from stream goroutines.
+type recordingAuditor struct {
+	mu      sync.Mutex
+	records []QueryRecord
+}
+
+func (a *recordingAuditor) audit(r QueryRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, r)
+}
+
+func (a *recordingAuditor) all() []QueryRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]QueryRecord(nil), a.records...)
+}
+
+func TestQueryAuditor_Query(t *testing.T) {
+	auditor := &recordingAuditor{}
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("s1", "héllo", ""), nil
+		},
+	}
+	client := newTestClient(mock, WithModel("gpt-5"), WithQueryAuditor(auditor.audit))
+
+	_, err := client.Query(t.Context(), "ping?")
+	require.NoError(t, err)
+
+	records := auditor.all()
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, "s1", r.SessionID)
+	assert.Equal(t, "gpt-5", r.Model)
+	assert.False(t, r.Stream)
+	assert.Equal(t, 5, r.PromptLength)
+	assert.Equal(t, 5, r.ResponseLength)
+	assert.False(t, r.Time.IsZero())
+	assert.Positive(t, r.Duration)
+	assert.Empty(t, r.Error)
+	assert.Empty(t, r.Prompt, "content is excluded by default")
+	assert.Empty(t, r.Response, "content is excluded by default")
+}
+
+func TestQueryAuditor_IncludeContent(t *testing.T) {
+	auditor := &recordingAuditor{}
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("s1", "pong", ""), nil
+		},
+	}
+	client := newTestClient(mock, WithQueryAuditor(auditor.audit), WithQueryAuditContent(true))
+
+	_, err := client.Query(t.Context(), "ping?")
+	require.NoError(t, err)
+
+	records := auditor.all()
+	require.Len(t, records, 1)
+	assert.Equal(t, "ping?", records[0].Prompt)
+	assert.Equal(t, "pong", records[0].Response)
+}
+
+func TestQueryAuditor_ErrorPaths(t *testing.T) {
+	t.Run("validation error", func(t *testing.T) {
+		auditor := &recordingAuditor{}
+		client := newTestClient(&mockSDKClient{}, WithQueryAuditor(auditor.audit))
+
+		_, err := client.QueryWithSession(t.Context(), "s9", "")
+		require.ErrorIs(t, err, ErrEmptyPrompt)
+
+		records := auditor.all()
+		require.Len(t, records, 1)
+		assert.Equal(t, "s9", records[0].SessionID)
+		assert.Equal(t, ErrEmptyPrompt.Error(), records[0].Error)
+	})
+
+	t.Run("session error", func(t *testing.T) {
+		auditor := &recordingAuditor{}
+		mock := &mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return providerSession("s1", "", "boom"), nil
+			},
+		}
+		client := newTestClient(mock, WithQueryAuditor(auditor.audit))
+
+		_, err := client.Query(t.Context(), "hi")
+		require.Error(t, err)
+
+		records := auditor.all()
+		require.Len(t, records, 1)
+		assert.Contains(t, records[0].Error, "boom")
+	})
+
+	t.Run("stream setup error", func(t *testing.T) {
+		auditor := &recordingAuditor{}
+		client, err := New(WithQueryAuditor(auditor.audit))
+		require.NoError(t, err)
+
+		_, _, err = client.QueryStream(t.Context(), "", "hi")
+		require.ErrorIs(t, err, ErrNotConnected)
+
+		records := auditor.all()
+		require.Len(t, records, 1)
+		assert.True(t, records[0].Stream)
+		assert.Equal(t, ErrNotConnected.Error(), records[0].Error)
+	})
+
+	t.Run("stream canceled", func(t *testing.T) {
+		auditor := &recordingAuditor{}
+		client, aborted := hangingStreamClient()
+		require.NoError(t, WithQueryAuditor(auditor.audit)(client.cfg))
+
+		ctx, cancel := context.WithCancel(t.Context())
+		_, _, err := client.QueryStream(ctx, "", "hi")
+		require.NoError(t, err)
+		cancel()
+		<-aborted
+
+		require.Eventually(t, func() bool { return len(auditor.all()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, "query aborted (canceled): context canceled", auditor.all()[0].Error)
+	})
+}
+
+func TestQueryAuditor_Stream(t *testing.T) {
+	auditor := &recordingAuditor{}
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return streamSession("s1",
+				copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("ab")}},
+				copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("c")}},
+				copilot.SessionEvent{Type: copilot.SessionIdle},
+			), nil
+		},
+	}
+	client := newTestClient(mock, WithQueryAuditor(auditor.audit), WithStreamSuppressFinalContent(true))
+
+	events, _, err := client.QueryStream(t.Context(), "", "hi")
+	require.NoError(t, err)
+	drain(events)
+
+	records := auditor.all()
+	require.Len(t, records, 1)
+	assert.True(t, records[0].Stream)
+	assert.Equal(t, "s1", records[0].SessionID)
+	assert.Equal(t, 3, records[0].ResponseLength)
+	assert.Empty(t, records[0].Error)
+}
+
+func TestWithQueryAuditor_Validation(t *testing.T) {
+	_, err := New(WithQueryAuditor(nil))
+	require.Error(t, err)
+}
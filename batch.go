@@ -0,0 +1,108 @@
+package copilotcli
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// BatchError reports which prompts in a QueryBatch call failed.
+type BatchError struct {
+	// Errors holds one entry per input prompt; nil entries succeeded.
+	Errors []error
+}
+
+// Error summarizes the failed prompts.
+func (e *BatchError) Error() string {
+	var (
+		failed int
+		first  error
+	)
+	for _, err := range e.Errors {
+		if err == nil {
+			continue
+		}
+		if first == nil {
+			first = err
+		}
+		failed++
+	}
+	return fmt.Sprintf("%d of %d batch queries failed: %v", failed, len(e.Errors), first)
+}
+
+// Unwrap returns the individual errors so errors.Is and errors.As can match them.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// QueryBatch runs independent prompts concurrently, each in its own new
+// session, and returns the results in input order. At most WithMaxConcurrency
+// queries run at a time, and batches larger than WithMaxBatchSize are
+// rejected with ErrBatchTooLarge.
+//
+// Failures are reported per prompt: the corresponding result is nil and the
+// returned error is a *BatchError whose Errors slice lines up with prompts.
+// Results for successful prompts are returned even when others fail.
+func (c *Client) QueryBatch(ctx context.Context, prompts []string) ([]*QueryResult, error) {
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return nil, ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	if err := c.checkBatchSize(len(prompts)); err != nil {
+		return nil, err
+	}
+
+	results := make([]*QueryResult, len(prompts))
+	errs := make([]error, len(prompts))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(c.cfg.maxConcurrency, len(prompts)) {
+		wg.Go(func() {
+			for i := range jobs {
+				results[i], errs[i] = c.Query(ctx, prompts[i])
+			}
+		})
+	}
+
+	// Stop handing out work once the context is done; prompts that never
+	// started report the context error.
+dispatch:
+	for i := range prompts {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			for j := i; j < len(prompts); j++ {
+				errs[j] = ctx.Err()
+			}
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return results, &BatchError{Errors: errs}
+		}
+	}
+	return results, nil
+}
+
+// checkBatchSize returns ErrBatchTooLarge if WithMaxBatchSize is set and a
+// batch of n prompts exceeds it.
+func (c *Client) checkBatchSize(n int) error {
+	if c.cfg.maxBatchSize > 0 && n > c.cfg.maxBatchSize {
+		return fmt.Errorf("%w: %d prompts, limit is %d", ErrBatchTooLarge, n, c.cfg.maxBatchSize)
+	}
+	return nil
+}
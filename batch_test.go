@@ -0,0 +1,172 @@
+package copilotcli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEchoBatchMock returns a mock whose sessions answer each prompt with
+// "echo: <prompt>" and fail any prompt equal to "fail". It records the peak
+// number of queries in flight.
+func newEchoBatchMock(peak *atomic.Int32) *mockSDKClient {
+	var (
+		inFlight atomic.Int32
+		nextID   atomic.Int32
+	)
+	return &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			sess := &mockSDKSession{id: fmt.Sprintf("batch-%d", nextID.Add(1))}
+			sess.sendFn = func(_ context.Context, opts copilot.MessageOptions) (string, error) {
+				n := inFlight.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					inFlight.Add(-1)
+					if opts.Prompt == "fail" {
+						sess.emit(&copilot.SessionEvent{
+							Type: copilot.SessionError,
+							Data: copilot.Data{Message: ptr("boom")},
+						})
+						return
+					}
+					sess.emit(&copilot.SessionEvent{
+						Type: copilot.AssistantMessage,
+						Data: copilot.Data{Content: ptr("echo: " + opts.Prompt)},
+					})
+					sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+				}()
+				return testMsgID, nil
+			}
+			return sess, nil
+		},
+	}
+}
+
+func TestClient_QueryBatch(t *testing.T) {
+	var peak atomic.Int32
+	client := newTestClient(newEchoBatchMock(&peak), WithMaxConcurrency(2))
+
+	prompts := []string{"one", "two", "three", "four", "five"}
+	results, err := client.QueryBatch(t.Context(), prompts)
+
+	require.NoError(t, err)
+	require.Len(t, results, len(prompts))
+	for i, p := range prompts {
+		assert.Equal(t, "echo: "+p, results[i].Content)
+	}
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func TestClient_QueryBatch_PartialFailure(t *testing.T) {
+	var peak atomic.Int32
+	client := newTestClient(newEchoBatchMock(&peak))
+
+	results, err := client.QueryBatch(t.Context(), []string{"ok", "fail", ""})
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Errors, 3)
+	require.NoError(t, batchErr.Errors[0])
+	assert.Contains(t, batchErr.Errors[1].Error(), "boom")
+	require.ErrorIs(t, batchErr.Errors[2], ErrEmptyPrompt)
+	require.ErrorIs(t, err, ErrEmptyPrompt)
+
+	require.NotNil(t, results[0])
+	assert.Equal(t, "echo: ok", results[0].Content)
+	assert.Nil(t, results[1])
+	assert.Nil(t, results[2])
+}
+
+func TestClient_QueryBatch_NotConnected(t *testing.T) {
+	client := &Client{cfg: defaultCfg(), sdk: &mockSDKClient{}}
+	_, err := client.QueryBatch(t.Context(), []string{"hi"})
+	require.ErrorIs(t, err, ErrNotConnected)
+}
+
+func TestClient_QueryBatch_TooLarge(t *testing.T) {
+	var peak atomic.Int32
+	client := newTestClient(newEchoBatchMock(&peak), WithMaxBatchSize(2))
+
+	_, err := client.QueryBatch(t.Context(), []string{"a", "b", "c"})
+	require.ErrorIs(t, err, ErrBatchTooLarge)
+	assert.Contains(t, err.Error(), "3 prompts, limit is 2")
+	assert.Zero(t, peak.Load(), "no prompt ran")
+
+	results, err := client.QueryBatch(t.Context(), []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	_, err = New(WithMaxBatchSize(-1))
+	require.Error(t, err)
+}
+
+func TestNewBatchHandler(t *testing.T) {
+	var peak atomic.Int32
+	client := newTestClient(newEchoBatchMock(&peak))
+	handler := NewBatchHandler(client)
+
+	t.Run("returns per-item results in order", func(t *testing.T) {
+		body := `{"prompts": ["a", "fail", "c"]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/copilot/batch", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var items []batchItem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+		require.Len(t, items, 3)
+		assert.Equal(t, "echo: a", items[0].Content)
+		assert.NotEmpty(t, items[0].SessionID)
+		assert.Contains(t, items[1].Error, "boom")
+		assert.Empty(t, items[1].Content)
+		assert.Equal(t, "echo: c", items[2].Content)
+	})
+
+	t.Run("rejects empty prompt list", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/copilot/batch", strings.NewReader(`{"prompts": []}`))
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("rejects batches over the size limit", func(t *testing.T) {
+		limited := NewBatchHandler(newTestClient(newEchoBatchMock(&peak), WithMaxBatchSize(2)))
+		req := httptest.NewRequest(http.MethodPost, "/api/copilot/batch", strings.NewReader(`{"prompts": ["a", "b", "c"]}`))
+		rec := httptest.NewRecorder()
+
+		limited(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "batch exceeds the maximum size")
+	})
+
+	t.Run("returns 503 when not connected", func(t *testing.T) {
+		disconnected := NewBatchHandler(&Client{cfg: defaultCfg(), sdk: &mockSDKClient{}})
+		req := httptest.NewRequest(http.MethodPost, "/api/copilot/batch", strings.NewReader(`{"prompts": ["a"]}`))
+		rec := httptest.NewRecorder()
+
+		disconnected(rec, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
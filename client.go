@@ -5,9 +5,16 @@ package copilotcli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	copilot "github.com/github/copilot-sdk/go"
 )
@@ -16,23 +23,97 @@ import (
 type QueryResult struct {
 	Content   string
 	SessionID string
+
+	// Usage is the token usage reported by the sidecar.
+	Usage Usage
+	// EstimatedCost is the WithCostModel estimate for Usage; zero without a
+	// cost model.
+	EstimatedCost float64
 }
 
 // StreamEvent represents a single streaming event (a delta or the final result).
 type StreamEvent struct {
 	DeltaContent string
-	Content      string // populated only in the final event
-	IsFinal      bool
-	Error        error
+	// ReasoningDelta is a chunk of the model's reasoning ("thinking") output,
+	// sent before or between answer deltas by models that support it. It is
+	// never included in Content.
+	ReasoningDelta string
+	// Content is the complete answer, populated only in the final event
+	// (empty with WithStreamSuppressFinalContent). It is the session's
+	// complete AssistantMessage when one arrived, otherwise the concatenated
+	// deltas.
+	Content   string
+	IsFinal   bool
+	Error     error
+	SessionID string // the session the event belongs to
+	// Model is the model that produced the event. Only set by
+	// QueryStreamFanout.
+	Model string
+
+	// ChunkCount is the number of delta events received. Final event only.
+	ChunkCount int
+	// Elapsed is the time from sending the prompt to completion. Final event only.
+	Elapsed time.Duration
+	// FirstTokenLatency is the time from sending the prompt to the first
+	// answer delta, or to the complete message when the session does not
+	// stream deltas. Zero if no content arrived. Final event only.
+	FirstTokenLatency time.Duration
+	// Usage is the token usage reported by the sidecar. Final event only.
+	Usage Usage
+	// EstimatedCost is the WithCostModel estimate for Usage; zero without a
+	// cost model. Final event only.
+	EstimatedCost float64
+	// Raw carries an SDK event the stream does not otherwise interpret (e.g.,
+	// tool execution or usage events). Only sent when WithRawEvents is enabled;
+	// the set of event types and their payloads depend on the SDK version.
+	Raw *copilot.SessionEvent
 }
 
 // Client wraps the Copilot CLI SDK client and manages connectivity to a
 // headless Copilot CLI sidecar.
 type Client struct {
 	cfg       *cfg
-	sdk       sdkClient
+	sdk       SDKClient
 	connected bool
 	mu        sync.RWMutex
+
+	// toolsMu guards cfg.tools, which may change at runtime via RegisterTool
+	// and UnregisterTool.
+	toolsMu sync.RWMutex
+
+	// sessionSlots bounds concurrent queries when WithMaxConcurrentSessions
+	// is set; nil means unlimited.
+	sessionSlots chan struct{}
+
+	// toolSlots bounds concurrent tool handler executions across all tools
+	// when WithToolConcurrency is set; nil means unlimited.
+	toolSlots chan struct{}
+
+	// limiter throttles the HTTP handlers when WithRateLimit is set.
+	limiter *rateLimiter
+
+	// idempotency caches query handler responses when WithIdempotencyTTL is set.
+	idempotency *idempotencyCache
+
+	// sessions tracks the IDs of sessions this client has created so they can
+	// be destroyed together by DestroyAllSessions.
+	sessionsMu sync.Mutex
+	sessions   map[string]struct{}
+
+	// connectedAt is when Start last connected. Guarded by mu.
+	connectedAt time.Time
+
+	// inFlight counts the queries and streams currently running.
+	inFlight atomic.Int64
+
+	// toolRounds counts the tool calls of each running query by session ID
+	// when WithMaxToolRounds is set.
+	toolRoundsMu sync.Mutex
+	toolRounds   map[string]int
+
+	// shutdownDone is closed by Stop to release the WithShutdownContext
+	// watcher. Guarded by mu.
+	shutdownDone chan struct{}
 }
 
 // New creates a new Client with the supplied functional options.
@@ -51,18 +132,45 @@ func New(opts ...Option) (*Client, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	sdkClient := copilot.NewClient(&copilot.ClientOptions{
-		CLIUrl:   c.cliURL,
-		LogLevel: c.logLevel,
-	})
+	base := c.sdk
+	if base == nil {
+		base = &sdkClientAdapter{c: copilot.NewClient(c.clientOptions())}
+	}
+	sdk, err := newRecorder(base, c.recordPath, c.recordMode)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Client{
-		cfg: c,
-		sdk: &sdkClientAdapter{c: sdkClient},
-	}, nil
+	return newClient(c, sdk), nil
+}
+
+// newClient assembles a Client around a resolved cfg and SDK implementation.
+func newClient(c *cfg, sdk SDKClient) *Client {
+	client := &Client{
+		cfg:      c,
+		sdk:      sdk,
+		sessions: make(map[string]struct{}),
+	}
+	if c.maxToolRounds > 0 {
+		client.toolRounds = make(map[string]int)
+	}
+	if c.maxSessions > 0 {
+		client.sessionSlots = make(chan struct{}, c.maxSessions)
+	}
+	if c.toolConcurrency > 0 {
+		client.toolSlots = make(chan struct{}, c.toolConcurrency)
+	}
+	if c.rateLimitRPS > 0 {
+		client.limiter = newRateLimiter(c.rateLimitRPS, c.rateLimitBurst, c.rateLimitKey, c.clock.Now)
+	}
+	if c.idempotencyTTL > 0 {
+		client.idempotency = newIdempotencyCache(c.idempotencyTTL, c.clock.Now)
+	}
+	return client
 }
 
 // Start connects to the Copilot CLI sidecar with retry and exponential backoff.
+// See WithRetryAttempts, WithRetryDelay, and WithStartRetryPredicate.
 func (c *Client) Start(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -81,17 +189,22 @@ func (c *Client) Start(ctx context.Context) error {
 
 		if err == nil {
 			c.connected = true
+			c.connectedAt = c.cfg.clock.Now()
+			c.watchShutdown()
 			return nil
 		}
 
 		lastErr = err
+		if c.cfg.startRetryIf != nil && !c.cfg.startRetryIf(err) {
+			break
+		}
 
 		// Don't sleep after the last attempt.
 		if attempt < c.cfg.retryAttempts-1 {
 			select {
 			case <-ctx.Done():
 				return fmt.Errorf("%w: %w", ErrSidecarUnavailable, ctx.Err())
-			case <-time.After(delay):
+			case <-c.cfg.clock.After(delay):
 			}
 			delay *= 2
 		}
@@ -100,18 +213,96 @@ func (c *Client) Start(ctx context.Context) error {
 	return fmt.Errorf("%w: %w", ErrSidecarUnavailable, lastErr)
 }
 
-// Stop disconnects from the Copilot CLI sidecar.
+// Stop disconnects from the Copilot CLI sidecar. Stopping a client that is
+// not connected is a no-op and returns nil; use StopStrict to tell the two
+// cases apart. Stop waits for the SDK to shut down without a deadline; use
+// StopContext to bound it.
 func (c *Client) Stop() error {
+	return c.StopContext(context.Background())
+}
+
+// StopContext is like Stop, but gives up waiting for the SDK to shut down
+// once ctx ends and returns ctx.Err(). The client is marked disconnected
+// either way, and the SDK shutdown finishes in the background.
+func (c *Client) StopContext(ctx context.Context) error {
+	err := c.stop(ctx)
+	if errors.Is(err, ErrAlreadyStopped) {
+		return nil
+	}
+	return err
+}
+
+// StopStrict is like Stop, but returns ErrAlreadyStopped if the client was
+// not connected, whether it was never started or already stopped. It is safe
+// to call concurrently and repeatedly: exactly one call stops a running
+// client.
+func (c *Client) StopStrict() error {
+	return c.stop(context.Background())
+}
+
+// stop implements StopContext and StopStrict.
+func (c *Client) stop(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if !c.connected {
-		return nil
+		return ErrAlreadyStopped
 	}
 
-	err := c.sdk.Stop()
+	if c.shutdownDone != nil {
+		close(c.shutdownDone)
+		c.shutdownDone = nil
+	}
 	c.connected = false
-	return err
+	c.connectedAt = time.Time{}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- c.sdk.Stop() }()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+		go func() {
+			if err := <-stopped; err != nil {
+				c.cfg.logger.Warn("copilot client stop finished after its deadline", "error", err)
+			}
+		}()
+		return ctx.Err()
+	}
+}
+
+// watchShutdown stops the client once the WithShutdownContext context ends.
+// The watcher exits without stopping if Stop is called first. Callers must
+// hold c.mu for writing.
+func (c *Client) watchShutdown() {
+	ctx := c.cfg.shutdownCtx
+	if ctx == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	c.shutdownDone = done
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := c.Stop(); err != nil {
+				c.cfg.logger.Warn("copilot client shutdown", "error", err)
+			}
+		case <-done:
+		}
+	}()
+}
+
+// uptime returns how long the client has been connected, or zero.
+func (c *Client) uptime() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.connected || c.connectedAt.IsZero() {
+		return 0
+	}
+	return c.cfg.clock.Now().Sub(c.connectedAt)
 }
 
 // IsConnected reports whether the client has an active connection to the sidecar.
@@ -121,17 +312,98 @@ func (c *Client) IsConnected() bool {
 	return c.connected
 }
 
-// Ping checks that the sidecar is responsive. Returns an error if it is not.
-func (c *Client) Ping(ctx context.Context) error {
+// CLIURL returns the address of the Copilot CLI sidecar.
+func (c *Client) CLIURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.cliURL
+}
+
+// Model returns the LLM model used for new sessions.
+func (c *Client) Model() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.model
+}
+
+// AuthMode returns how the sidecar authenticates with the LLM provider.
+func (c *Client) AuthMode() AuthMode {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.authMode
+}
+
+// ProviderType returns the BYOK provider type. It is only meaningful when
+// AuthMode is AuthModeBYOK.
+func (c *Client) ProviderType() ProviderType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.providerType
+}
+
+// Streaming reports whether streaming delta events are enabled.
+func (c *Client) Streaming() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg.streaming
+}
+
+// LogLevel returns the SDK log verbosity.
+func (c *Client) LogLevel() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	return c.cfg.logLevel
+}
+
+// Tools returns a copy of the currently registered tool definitions.
+func (c *Client) Tools() []ToolDefinition {
+	c.toolsMu.RLock()
+	defer c.toolsMu.RUnlock()
+
+	if len(c.cfg.tools) == 0 {
+		return nil
+	}
+	tools := make([]ToolDefinition, len(c.cfg.tools))
+	copy(tools, c.cfg.tools)
+	return tools
+}
+
+// Ping checks that the sidecar is responsive. Returns an error if it is not.
+// It gives up after the timeout set by WithPingTimeout.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.PingMessage(ctx, "health")
+}
 
+// PingMessage pings the sidecar with a custom message payload. It returns
+// ErrPingTimeout if the sidecar does not answer within the ping timeout.
+func (c *Client) PingMessage(ctx context.Context, msg string) error {
+	c.mu.RLock()
 	if !c.connected {
+		c.mu.RUnlock()
 		return ErrNotConnected
 	}
+	c.mu.RUnlock()
 
-	_, err := c.sdk.Ping(ctx, "health")
-	return err
+	pingCtx, cancel := context.WithTimeout(ctx, c.cfg.pingTimeout)
+	defer cancel()
+
+	// The SDK's Ping does not observe its context, so wait on it separately;
+	// a hung request is abandoned rather than blocking the caller.
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.sdk.Ping(pingCtx, msg)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-pingCtx.Done():
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w after %s", ErrPingTimeout, c.cfg.pingTimeout)
+	}
 }
 
 // Query sends a prompt to the LLM in a new session and returns the complete response.
@@ -139,12 +411,124 @@ func (c *Client) Query(ctx context.Context, prompt string) (*QueryResult, error)
 	return c.QueryWithSession(ctx, "", prompt)
 }
 
+// Ask sends a one-shot prompt in a new session and returns only the response
+// text. It fails like Query, e.g. with ErrEmptyPrompt or ErrNotConnected.
+func (c *Client) Ask(ctx context.Context, prompt string) (string, error) {
+	result, err := c.Query(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
 // QueryWithSession sends a prompt in an existing session (multi-turn) or creates
 // a new one when sessionID is empty.
+//
+// If the session fails after the model produced some output, the error is a
+// *PartialResultError carrying that output. If it fails before any output with
+// a rate-limit or availability error, providers added with
+// WithFallbackProvider are tried in order. If ctx ends first, the message is
+// aborted and the error is an *AbortError saying why.
+//
+// Hooks registered with WithBeforeQuery and WithAfterQuery run around the query.
 func (c *Client) QueryWithSession(ctx context.Context, sessionID, prompt string) (*QueryResult, error) {
-	if prompt == "" {
+	return c.QueryWithOptions(ctx, QueryOptions{SessionID: sessionID, Prompt: prompt})
+}
+
+// InFlight returns the number of queries and streams currently running, e.g.
+// to drive autoscaling. A stream counts until it completes, fails, or is
+// canceled.
+func (c *Client) InFlight() int {
+	return int(c.inFlight.Load())
+}
+
+// trackInFlight counts a query as running until the returned function is
+// first called.
+func (c *Client) trackInFlight() func() {
+	c.inFlight.Add(1)
+	return sync.OnceFunc(func() { c.inFlight.Add(-1) })
+}
+
+// QueryOptions configures a single QueryWithOptions call.
+type QueryOptions struct {
+	// SessionID continues an existing session; empty creates a new one.
+	SessionID string
+	// ConversationKey identifies the conversation in the
+	// WithSessionPersistence store. When SessionID is empty, the session
+	// stored for the key is continued, and a new session is stored for it.
+	ConversationKey string
+	// Prompt is the message to send. Required.
+	Prompt string
+	// Model overrides the client's configured model for this query. Empty
+	// uses the client's model.
+	Model string
+	// SystemMessage is appended to the client's system message for the
+	// session this query opens or resumes.
+	SystemMessage string
+	// Provider replaces the client's provider for this query. Nil uses the
+	// one from ContextWithProvider, if any, else the client's.
+	Provider *ProviderOverride
+	// TemplateVars are additional variables for the WithPromptTemplate
+	// template, next to .Prompt. Ignored without a template.
+	TemplateVars map[string]any
+	// Message carries extra SDK message fields for this query. Attachments
+	// (files, directories, or selections) and Mode (delivery mode, default
+	// "enqueue") are passed through; Message.Prompt is ignored in favor of
+	// Prompt.
+	Message copilot.MessageOptions
+}
+
+// QueryWithOptions sends a prompt like QueryWithSession, with per-query
+// settings such as a model override. Returns ErrEmptyModel if Model is set
+// but blank.
+func (c *Client) QueryWithOptions(ctx context.Context, opts QueryOptions) (*QueryResult, error) {
+	defer c.trackInFlight()()
+
+	audit := c.beginAudit(opts, false)
+	for _, hook := range c.cfg.beforeQuery {
+		hook(ctx, opts.Prompt, opts.SessionID)
+	}
+
+	result, err := c.queryWithOptions(ctx, opts)
+
+	for _, hook := range c.cfg.afterQuery {
+		hook(ctx, result, err)
+	}
+
+	var sessionID, response string
+	if result != nil {
+		sessionID, response = result.SessionID, result.Content
+	}
+	var partial *PartialResultError
+	if errors.As(err, &partial) {
+		response = partial.Content
+	}
+	audit(sessionID, response, err)
+	return result, err
+}
+
+// queryWithOptions implements QueryWithOptions without the hooks.
+func (c *Client) queryWithOptions(ctx context.Context, opts QueryOptions) (*QueryResult, error) {
+	if opts.Prompt == "" {
 		return nil, ErrEmptyPrompt
 	}
+	if opts.Model != "" && strings.TrimSpace(opts.Model) == "" {
+		return nil, ErrEmptyModel
+	}
+	prompt, err := c.renderPrompt(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkPromptLength(prompt); err != nil {
+		return nil, err
+	}
+	if err := c.checkContextWindow(prompt); err != nil {
+		return nil, err
+	}
+	provider, err := c.providerConfig(ctx, opts.Provider)
+	if err != nil {
+		return nil, err
+	}
 
 	c.mu.RLock()
 	if !c.connected {
@@ -153,73 +537,256 @@ func (c *Client) QueryWithSession(ctx context.Context, sessionID, prompt string)
 	}
 	c.mu.RUnlock()
 
-	session, err := c.getOrCreateSession(ctx, sessionID)
+	if err := c.loadConversation(ctx, &opts); err != nil {
+		return nil, err
+	}
+	sessionID := opts.SessionID
+
+	release, err := c.acquireSession(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("session setup: %w", err)
+		return nil, err
+	}
+	defer release()
+
+	msg := opts.Message
+	msg.Prompt = prompt
+
+	// Fail over to the WithFallbackProvider chain. A resumed session keeps
+	// its ID (and history); a new session is replaced by another new one.
+	result, err := c.queryProvider(ctx, opts, provider, msg)
+	for _, fb := range c.cfg.fallbacks {
+		if !isRetryableProviderError(err) {
+			break
+		}
+		c.cfg.logger.Warn("copilot provider failed, trying fallback",
+			"session_id", sessionID, "provider", fb.providerType, "base_url", fb.baseURL, "error", err)
+
+		result, err = c.queryProvider(ctx, opts, fb.config(c.cfg.azureAPIVersion), msg)
+	}
+	if err == nil {
+		c.saveConversation(ctx, opts.ConversationKey, sessionID, result.SessionID)
+	}
+	return result, err
+}
+
+// queryProvider runs one query against provider (nil for the configured
+// or context one), retrying rate-limit and availability errors up to WithQueryRetries
+// times with exponential backoff. The backoff wait ends early with ctx.Err()
+// if ctx is canceled.
+func (c *Client) queryProvider(ctx context.Context, opts QueryOptions, provider *copilot.ProviderConfig, msg copilot.MessageOptions) (*QueryResult, error) {
+	delay := c.cfg.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		session, err := c.openSession(ctx, opts.SessionID, opts.Model, opts.SystemMessage, provider)
+		if err != nil {
+			return nil, fmt.Errorf("session setup: %w", err)
+		}
+
+		result, err := c.sendAndWait(ctx, session, msg)
+		if result != nil {
+			result.EstimatedCost = c.estimateCost(result.Usage, opts.Model)
+		}
+		if attempt >= c.cfg.queryRetries || !isRetryableProviderError(err) {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, abortError(ctx)
+		case <-c.cfg.clock.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// answer accumulates a turn's reply. A complete AssistantMessage is
+// authoritative whenever one arrives, in whatever order relative to the
+// deltas; otherwise the reply is the concatenated deltas, which is also what
+// survives a mid-generation error.
+type answer struct {
+	prefix     string
+	deltas     string
+	message    string
+	hasMessage bool
+}
+
+func (a *answer) addDelta(delta string) { a.deltas += delta }
+
+// resume keeps the reply so far as a prefix for a continuation turn, whose
+// deltas or message are appended to it.
+func (a *answer) resume() { *a = answer{prefix: a.String()} }
+
+func (a *answer) setMessage(content string) {
+	a.message = content
+	a.hasMessage = true
+}
+
+// String returns the reply accumulated so far.
+func (a *answer) String() string {
+	if a.hasMessage {
+		return a.prefix + a.message
 	}
+	return a.prefix + a.deltas
+}
 
+// sendAndWait sends msg on session and waits for the complete response.
+//
+// Like queryStream and Subscribe, it subscribes to the session before
+// sending, so events the SDK emits synchronously from Send are captured, and
+// it ignores events that arrive after the turn has settled, such as an idle
+// event following an error.
+func (c *Client) sendAndWait(ctx context.Context, session SDKSession, msg copilot.MessageOptions) (*QueryResult, error) {
 	var (
-		content string
+		reply   answer
+		usage   Usage
 		done    = make(chan struct{})
+		settled bool
 		mu      sync.Mutex
 		evtErr  error
 	)
 
+	// firstToken is closed on the first AssistantMessage or delta, which
+	// disarms the WithFirstTokenTimeout watchdog.
+	firstToken := make(chan struct{})
+	var tokenOnce sync.Once
+	markFirstToken := func() { tokenOnce.Do(func() { close(firstToken) }) }
+
 	unsubscribe := session.On(func(event copilot.SessionEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if settled {
+			return
+		}
+
 		switch event.Type {
+		case copilot.AssistantMessageDelta:
+			// Accumulate deltas so partial output survives a mid-generation error.
+			if event.Data.DeltaContent != nil {
+				reply.addDelta(*event.Data.DeltaContent)
+				markFirstToken()
+			}
 		case copilot.AssistantMessage:
-			mu.Lock()
 			if event.Data.Content != nil {
-				content = *event.Data.Content
+				reply.setMessage(*event.Data.Content)
+				markFirstToken()
 			}
-			mu.Unlock()
+		case copilot.AssistantUsage:
+			usage.add(&event.Data)
 		case copilot.SessionIdle:
+			settled = true
 			close(done)
 		case copilot.SessionError:
-			mu.Lock()
-			msg := "session error"
-			if event.Data.Message != nil {
-				msg = *event.Data.Message
-			}
-			evtErr = fmt.Errorf("copilot: %s", msg)
-			mu.Unlock()
+			evtErr = c.sessionError(&event.Data)
+			settled = true
 			close(done)
 		default:
 			// Ignore other event types.
 		}
 	})
 	defer unsubscribe()
+	defer c.beginToolRounds(session.ID())()
+	defer c.cfg.toolCtxs.begin(ctx, session.ID())()
 
-	if _, err := session.Send(ctx, copilot.MessageOptions{Prompt: prompt}); err != nil {
+	if _, err := session.Send(ctx, msg); err != nil {
 		return nil, fmt.Errorf("sending message: %w", err)
 	}
 
-	select {
-	case <-done:
-	case <-ctx.Done():
-		_ = session.Abort(ctx)
-		return nil, ctx.Err()
+	var watchdog <-chan time.Time
+	if d := c.cfg.firstTokenWait; d > 0 {
+		watchdog = c.cfg.clock.After(d)
+	}
+
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ctx.Done():
+			_ = session.Abort(context.WithoutCancel(ctx))
+			return nil, abortError(ctx)
+		case <-firstToken:
+			firstToken, watchdog = nil, nil
+		case <-watchdog:
+			select {
+			case <-firstToken:
+				firstToken, watchdog = nil, nil
+				continue
+			default:
+			}
+			_ = session.Abort(context.WithoutCancel(ctx))
+			return nil, fmt.Errorf("%w after %s", ErrFirstTokenTimeout, c.cfg.firstTokenWait)
+		}
 	}
 
 	mu.Lock()
 	defer mu.Unlock()
 
+	content := reply.String()
 	if evtErr != nil {
+		if content != "" {
+			return nil, &PartialResultError{Content: content, SessionID: session.ID(), Err: evtErr}
+		}
 		return nil, evtErr
 	}
 
 	return &QueryResult{
 		Content:   content,
 		SessionID: session.ID(),
+		Usage:     usage,
 	}, nil
 }
 
 // QueryStream sends a prompt and returns a channel of streaming events plus
-// the session ID. The channel is closed when the response completes.
+// the session ID. The channel is closed when the response completes. The
+// stream subscribes to the session before the prompt is sent, so no event is
+// lost, even one the SDK emits before Send returns. A slow
+// consumer holds up the stream once the channel's buffer is full; see
+// WithStreamOverflowPolicy. See WithStreamResumeOnError to continue a stream
+// cut short by a rate limit or outage. If ctx ends first, the message is
+// aborted and the stream ends with an error event carrying an *AbortError,
+// if the consumer is still reading, before the channel is closed.
 func (c *Client) QueryStream(ctx context.Context, sessionID, prompt string) (<-chan StreamEvent, string, error) { //nolint:gocritic // named returns not used to keep internal channel writable
-	if prompt == "" {
+	return c.QueryStreamWithOptions(ctx, QueryOptions{SessionID: sessionID, Prompt: prompt})
+}
+
+// QueryStreamWithOptions streams a response like QueryStream, with the
+// per-query settings of QueryOptions. Returns ErrEmptyModel if Model is set
+// but blank.
+func (c *Client) QueryStreamWithOptions(ctx context.Context, opts QueryOptions) (<-chan StreamEvent, string, error) { //nolint:gocritic // named returns not used to keep internal channel writable
+	untrack := c.trackInFlight()
+	audit := c.beginAudit(opts, true)
+	events, sid, err := c.queryStream(ctx, opts, audit, untrack)
+	if err != nil {
+		untrack()
+		audit("", "", err)
+	}
+	return events, sid, err
+}
+
+// queryStream implements QueryStreamWithOptions. audit is called when the
+// stream completes, fails, or is canceled; untrack once its session is
+// released.
+func (c *Client) queryStream(ctx context.Context, opts QueryOptions, audit func(sessionID, response string, err error), untrack func()) (<-chan StreamEvent, string, error) { //nolint:gocritic // named returns not used to keep internal channel writable
+	if opts.Prompt == "" {
 		return nil, "", ErrEmptyPrompt
 	}
+	if opts.Model != "" && strings.TrimSpace(opts.Model) == "" {
+		return nil, "", ErrEmptyModel
+	}
+	prompt, err := c.renderPrompt(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := c.checkPromptLength(prompt); err != nil {
+		return nil, "", err
+	}
+	if err := c.checkContextWindow(prompt); err != nil {
+		return nil, "", err
+	}
+	provider, err := c.providerConfig(ctx, opts.Provider)
+	if err != nil {
+		return nil, "", err
+	}
 
 	c.mu.RLock()
 	if !c.connected {
@@ -228,66 +795,778 @@ func (c *Client) QueryStream(ctx context.Context, sessionID, prompt string) (<-c
 	}
 	c.mu.RUnlock()
 
-	session, err := c.getOrCreateSession(ctx, sessionID)
+	if err := c.loadConversation(ctx, &opts); err != nil {
+		return nil, "", err
+	}
+
+	release, err := c.acquireSession(ctx)
 	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := c.openSession(ctx, opts.SessionID, opts.Model, opts.SystemMessage, provider)
+	if err != nil {
+		release()
 		return nil, "", fmt.Errorf("session setup: %w", err)
 	}
 
 	events := make(chan StreamEvent, 64)
 
 	var (
-		fullContent string
-		mu          sync.Mutex
+		reply      answer
+		chunkCount int
+		usage      Usage
+		firstToken time.Duration
+		ended      bool
+		resumes    int
+		resuming   bool
+		mu         sync.Mutex
+		finished   = make(chan struct{})
+		start      = c.cfg.clock.Now()
 	)
 
+	// markFirstToken records the first-token latency once, which disarms
+	// the WithFirstTokenTimeout watchdog. Callers hold mu.
+	markFirstToken := func() {
+		if firstToken != 0 {
+			return
+		}
+		firstToken = max(c.cfg.clock.Now().Sub(start), 1)
+		if c.cfg.metrics != nil {
+			c.cfg.metrics.ObserveFirstToken(firstToken)
+		}
+	}
+
+	// pending holds the deltas coalesced while the channel was full under
+	// StreamOverflowCoalesce. Guarded by mu.
+	var pending string
+
+	// send delivers an event, after any pending deltas, unless the caller has
+	// given up. Callers hold mu, so events are never sent after finish.
+	sid := session.ID()
+	send := func(e StreamEvent) {
+		if pending != "" {
+			select {
+			case events <- StreamEvent{DeltaContent: pending, SessionID: sid}:
+			case <-ctx.Done():
+			}
+			pending = ""
+		}
+		e.SessionID = sid
+		select {
+		case events <- e:
+		case <-ctx.Done():
+		}
+	}
+
+	// sendDelta delivers an answer delta according to the
+	// WithStreamOverflowPolicy policy. Callers hold mu.
+	sendDelta := func(delta string) {
+		switch c.cfg.overflow {
+		case StreamOverflowCoalesce:
+			select {
+			case events <- StreamEvent{DeltaContent: pending + delta, SessionID: sid}:
+				pending = ""
+			default:
+				pending += delta
+			}
+		case StreamOverflowDropOldest:
+			for {
+				select {
+				case events <- StreamEvent{DeltaContent: delta, SessionID: sid}:
+					return
+				default:
+				}
+				// The channel is full: discard its oldest event, unless the
+				// consumer just made room.
+				select {
+				case <-events:
+				default:
+				}
+			}
+		default:
+			send(StreamEvent{DeltaContent: delta})
+		}
+	}
+
+	// finish sends the last event and closes the stream. Callers hold mu.
+	finish := func(e StreamEvent) {
+		send(e)
+		ended = true
+		close(events)
+		close(finished)
+	}
+
+	msg := opts.Message
+	msg.Prompt = prompt
+
+	// resume re-sends the prompt as a continuation of partial after the
+	// retryable error cause, backing off like WithQueryRetries. If ctx ends
+	// first, the cleanup goroutine aborts the turn; if the send fails, the
+	// stream ends with cause.
+	resume := func(partial string, attempt int, cause error) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.cfg.clock.After(c.cfg.retryDelay << (attempt - 1)):
+		}
+		c.cfg.logger.Warn("copilot stream failed, resuming",
+			"session_id", sid, "attempt", attempt, "error", cause)
+		cont := msg
+		cont.Prompt = continuationPrompt(prompt, partial)
+		_, err := session.Send(ctx, cont)
+
+		mu.Lock()
+		defer mu.Unlock()
+		resuming = false
+		if err != nil && !ended && ctx.Err() == nil {
+			audit(sid, reply.String(), cause)
+			finish(StreamEvent{Error: cause})
+		}
+	}
+
+	// Each event is handled entirely under mu, from accumulation to delivery,
+	// so even when the SDK invokes the handler from several goroutines at
+	// once, deltas reach the channel in exactly the order they were added to
+	// reply, and the final event follows all of them.
 	unsubscribe := session.On(func(event copilot.SessionEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ended {
+			return
+		}
+
 		switch event.Type {
 		case copilot.AssistantMessageDelta:
 			if event.Data.DeltaContent != nil {
-				mu.Lock()
-				fullContent += *event.Data.DeltaContent
-				mu.Unlock()
-				events <- StreamEvent{DeltaContent: *event.Data.DeltaContent}
+				markFirstToken()
+				resuming = false
+				reply.addDelta(*event.Data.DeltaContent)
+				chunkCount++
+				sendDelta(*event.Data.DeltaContent)
+			}
+		case copilot.AssistantReasoningDelta:
+			if event.Data.DeltaContent != nil {
+				send(StreamEvent{ReasoningDelta: *event.Data.DeltaContent})
 			}
 		case copilot.AssistantMessage:
-			mu.Lock()
 			if event.Data.Content != nil {
-				fullContent = *event.Data.Content
+				markFirstToken()
+				resuming = false
+				reply.setMessage(*event.Data.Content)
+			}
+		case copilot.AssistantUsage:
+			usage.add(&event.Data)
+			if c.cfg.rawEvents {
+				send(StreamEvent{Raw: &event})
 			}
-			mu.Unlock()
 		case copilot.SessionIdle:
-			mu.Lock()
-			events <- StreamEvent{Content: fullContent, IsFinal: true}
-			mu.Unlock()
-			close(events)
+			if resuming {
+				// The failed turn settling before its continuation starts.
+				return
+			}
+			content := reply.String()
+			audit(sid, content, nil)
+			if c.cfg.suppressFinal {
+				content = ""
+			}
+			finish(StreamEvent{
+				Content:           content,
+				IsFinal:           true,
+				ChunkCount:        chunkCount,
+				Elapsed:           c.cfg.clock.Now().Sub(start),
+				FirstTokenLatency: firstToken,
+				Usage:             usage,
+				EstimatedCost:     c.estimateCost(usage, opts.Model),
+			})
 		case copilot.SessionError:
-			msg := "session error"
-			if event.Data.Message != nil {
-				msg = *event.Data.Message
+			err := c.sessionError(&event.Data)
+			if c.cfg.streamResume && resumes < maxStreamResumes && isRetryableProviderError(err) {
+				resumes++
+				resuming = true
+				partial := reply.String()
+				reply.resume()
+				go resume(partial, resumes, err)
+				return
 			}
-			events <- StreamEvent{Error: fmt.Errorf("copilot: %s", msg)}
-			close(events)
+			audit(sid, reply.String(), err)
+			finish(StreamEvent{Error: err})
 		default:
-			// Ignore other event types.
+			if c.cfg.rawEvents {
+				send(StreamEvent{Raw: &event})
+			}
 		}
 	})
 
+	endToolRounds := c.beginToolRounds(sid)
+	endToolContext := c.cfg.toolCtxs.begin(ctx, sid)
+
+	// Stop listening once the stream ends, and abort the in-flight turn if
+	// the caller gives up first so the sidecar stops generating.
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			select {
+			case <-finished:
+			default:
+				_ = session.Abort(context.WithoutCancel(ctx))
+				mu.Lock()
+				if !ended {
+					// End the stream with the reason, unless the consumer
+					// stopped reading and there is no room for it.
+					err := abortError(ctx)
+					audit(sid, reply.String(), err)
+					ended = true
+					select {
+					case events <- StreamEvent{Error: err, SessionID: sid}:
+					default:
+					}
+					close(events)
+				}
+				mu.Unlock()
+			}
+		}
+		// A handler call racing with unsubscribe is harmless: events is
+		// only closed under mu, once ended, and send gives up once ctx is
+		// done.
 		unsubscribe()
+		endToolRounds()
+		endToolContext()
+		release()
+		untrack()
 	}()
 
-	if _, err := session.Send(ctx, copilot.MessageOptions{Prompt: prompt}); err != nil {
+	if _, err := session.Send(ctx, msg); err != nil {
+		mu.Lock()
+		ended = true
+		mu.Unlock()
+		close(finished)
 		unsubscribe()
 		close(events)
 		return nil, "", fmt.Errorf("sending message: %w", err)
 	}
+	c.saveConversation(ctx, opts.ConversationKey, opts.SessionID, sid)
+
+	if d := c.cfg.firstTokenWait; d > 0 {
+		expired := c.cfg.clock.After(d)
+		go func() {
+			select {
+			case <-expired:
+			case <-finished:
+				return
+			case <-ctx.Done():
+				return
+			}
+			mu.Lock()
+			if ended || firstToken != 0 {
+				mu.Unlock()
+				return
+			}
+			err := fmt.Errorf("%w after %s", ErrFirstTokenTimeout, d)
+			audit(sid, reply.String(), err)
+			finish(StreamEvent{Error: err})
+			mu.Unlock()
+			_ = session.Abort(context.WithoutCancel(ctx))
+		}()
+	}
+
+	return events, sid, nil
+}
+
+// maxStreamResumes bounds how many times WithStreamResumeOnError continues a
+// single stream.
+const maxStreamResumes = 3
+
+// continuationPrompt asks the model to carry on with its reply to prompt
+// after a retryable error cut it short at partial. With no partial reply
+// there is nothing to continue, so the prompt is simply sent again.
+func continuationPrompt(prompt, partial string) string {
+	if partial == "" {
+		return prompt
+	}
+	return prompt + "\n\nYour previous answer to this was interrupted. It ended with:\n\n" +
+		partial + "\n\nContinue the answer exactly where it stopped, without repeating any of it."
+}
+
+// QueryStreamWithResult is like QueryStream, but also returns a function that
+// blocks until the stream completes and returns the assembled result, so
+// callers can render deltas live without accumulating them. The returned
+// channel must be drained for the stream to complete; if ctx ends first, the
+// channel is closed and the result function returns ctx.Err(). The
+// result function may be called any number of times, including after the
+// channel is drained. If the stream fails after some deltas, the error is a
+// *PartialResultError carrying them.
+func (c *Client) QueryStreamWithResult(ctx context.Context, sessionID, prompt string) (<-chan StreamEvent, func() (*QueryResult, error), error) {
+	in, sid, err := c.QueryStream(ctx, sessionID, prompt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make(chan StreamEvent, cap(in))
+	done := make(chan struct{})
+	var (
+		result *QueryResult
+		resErr error
+	)
+
+	go func() {
+		defer close(done)
+		defer close(out)
+
+		var partial strings.Builder
+		for {
+			var (
+				event StreamEvent
+				ok    bool
+			)
+			select {
+			case event, ok = <-in:
+			case <-ctx.Done():
+				// QueryStream may not deliver its terminal event once ctx ends.
+				resErr = abortError(ctx)
+				return
+			}
+			if !ok {
+				break
+			}
+
+			switch {
+			case event.Error != nil:
+				resErr = event.Error
+				if partial.Len() > 0 {
+					resErr = &PartialResultError{Content: partial.String(), SessionID: sid, Err: event.Error}
+				}
+			case event.IsFinal:
+				content := event.Content
+				if c.cfg.suppressFinal {
+					content = partial.String()
+				}
+				result = &QueryResult{Content: content, SessionID: sid}
+			default:
+				partial.WriteString(event.DeltaContent)
+			}
+
+			select {
+			case out <- event:
+			case <-ctx.Done():
+			}
+		}
+
+		if result == nil && resErr == nil {
+			resErr = errors.New("copilot: stream ended without a result")
+		}
+	}()
+
+	wait := func() (*QueryResult, error) {
+		<-done
+		return result, resErr
+	}
+	return out, wait, nil
+}
+
+// QueryStreamToWriter streams a prompt like QueryStream, writing each answer
+// delta to w as it arrives, and returns the assembled result. If w implements
+// http.Flusher, it is flushed after every write. A write error aborts the turn
+// and is returned immediately. If the stream fails after some deltas, the
+// error is a *PartialResultError carrying them.
+func (c *Client) QueryStreamToWriter(ctx context.Context, sessionID, prompt string, w io.Writer) (*QueryResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // on a write error, this aborts the turn
+
+	events, sid, err := c.QueryStream(ctx, sessionID, prompt)
+	if err != nil {
+		return nil, err
+	}
+	flusher, _ := w.(http.Flusher)
+
+	var written strings.Builder
+	for {
+		var (
+			event StreamEvent
+			ok    bool
+		)
+		select {
+		case event, ok = <-events:
+		case <-ctx.Done():
+			// QueryStream may not deliver its terminal event once ctx ends.
+			return nil, abortError(ctx)
+		}
+		if !ok {
+			return nil, errors.New("copilot: stream ended without a result")
+		}
+
+		switch {
+		case event.Error != nil:
+			if written.Len() > 0 {
+				return nil, &PartialResultError{Content: written.String(), SessionID: sid, Err: event.Error}
+			}
+			return nil, event.Error
+		case event.IsFinal:
+			content := event.Content
+			if c.cfg.suppressFinal {
+				content = written.String()
+			}
+			return &QueryResult{
+				Content:       content,
+				SessionID:     sid,
+				Usage:         event.Usage,
+				EstimatedCost: event.EstimatedCost,
+			}, nil
+		case event.DeltaContent != "":
+			if _, err := io.WriteString(w, event.DeltaContent); err != nil {
+				return nil, fmt.Errorf("writing stream: %w", err)
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			written.WriteString(event.DeltaContent)
+		}
+	}
+}
+
+// sessionError converts the data of a SessionError event into an error,
+// prefixed as configured by WithErrorPrefix. Provider rate limits match
+// ErrRateLimited.
+func (c *Client) sessionError(data *copilot.Data) error {
+	msg := "session error"
+	if data.Message != nil {
+		msg = *data.Message
+	}
+	if isRateLimited(data) {
+		return &sessionFailure{msg: c.cfg.errorPrefix + msg, kind: ErrRateLimited}
+	}
+	return errors.New(c.cfg.errorPrefix + msg)
+}
+
+// rateLimitMarkers are substrings of session error messages that indicate
+// the provider is throttling requests.
+var rateLimitMarkers = []string{
+	"429",
+	"rate limit",
+	"rate-limit",
+	"too many requests",
+}
+
+// isRateLimited reports whether a SessionError event means the provider
+// rejected the request for exceeding its rate limit.
+func isRateLimited(data *copilot.Data) bool {
+	if data.StatusCode != nil && *data.StatusCode == 429 {
+		return true
+	}
+	if data.Message == nil {
+		return false
+	}
+	msg := strings.ToLower(*data.Message)
+	for _, marker := range rateLimitMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribe sends a prompt and forwards every raw SDK event of the turn on the
+// returned channel, together with the session ID. Unlike QueryStream, events
+// are not interpreted: deltas are not accumulated and no final or error
+// StreamEvent is synthesized, so callers must handle the copilot.SessionEvent
+// types themselves. The channel is closed after the SessionIdle or
+// SessionError event, or once ctx ends, in which case the turn is aborted.
+// The channel must be drained until closed, or ctx canceled.
+func (c *Client) Subscribe(ctx context.Context, sessionID, prompt string) (<-chan copilot.SessionEvent, string, error) { //nolint:gocritic // named returns not used to keep internal channel writable
+	if prompt == "" {
+		return nil, "", ErrEmptyPrompt
+	}
+	if err := c.checkPromptLength(prompt); err != nil {
+		return nil, "", err
+	}
+	if err := c.checkContextWindow(prompt); err != nil {
+		return nil, "", err
+	}
+
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return nil, "", ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := c.getOrCreateSession(ctx, sessionID, "")
+	if err != nil {
+		release()
+		return nil, "", fmt.Errorf("session setup: %w", err)
+	}
+
+	var (
+		events   = make(chan copilot.SessionEvent, 64)
+		finished = make(chan struct{})
+		ended    bool
+		mu       sync.Mutex
+	)
+
+	// end closes the stream. Callers hold mu.
+	end := func() {
+		if ended {
+			return
+		}
+		ended = true
+		close(events)
+		close(finished)
+	}
+
+	unsubscribe := session.On(func(event copilot.SessionEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if ended {
+			return
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return
+		}
+		if event.Type == copilot.SessionIdle || event.Type == copilot.SessionError {
+			end()
+		}
+	})
+
+	go func() {
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			mu.Lock()
+			active := !ended
+			end()
+			mu.Unlock()
+			if active {
+				_ = session.Abort(context.WithoutCancel(ctx))
+			}
+		}
+		unsubscribe()
+		release()
+	}()
+
+	if _, err := session.Send(ctx, copilot.MessageOptions{Prompt: prompt}); err != nil {
+		mu.Lock()
+		end()
+		mu.Unlock()
+		return nil, "", fmt.Errorf("sending message: %w", err)
+	}
+
+	return events, session.ID(), nil
+}
+
+// renderPrompt returns the prompt to send for opts: opts.Prompt rendered
+// through the WithPromptTemplate template, or as is without one.
+func (c *Client) renderPrompt(opts QueryOptions) (string, error) {
+	if c.cfg.promptTmpl == nil {
+		return opts.Prompt, nil
+	}
+
+	data := make(map[string]any, len(opts.TemplateVars)+1)
+	maps.Copy(data, opts.TemplateVars)
+	data["Prompt"] = opts.Prompt
+
+	var b strings.Builder
+	if err := c.cfg.promptTmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("rendering prompt template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// checkPromptLength returns ErrPromptTooLong if WithMaxPromptLength is set and
+// the prompt has more runes than allowed.
+func (c *Client) checkPromptLength(prompt string) error {
+	if c.cfg.maxPromptLength <= 0 {
+		return nil
+	}
+	if n := utf8.RuneCountInString(prompt); n > c.cfg.maxPromptLength {
+		return fmt.Errorf("%w: %d characters, limit is %d", ErrPromptTooLong, n, c.cfg.maxPromptLength)
+	}
+	return nil
+}
+
+// acquireSession waits for a free session slot when WithMaxConcurrentSessions
+// is set. The returned release func must be called once the query completes.
+// Returns ErrTooManySessions if ctx ends before a slot frees up.
+func (c *Client) acquireSession(ctx context.Context) (func(), error) {
+	if c.sessionSlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case c.sessionSlots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-c.sessionSlots }) }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %w", ErrTooManySessions, ctx.Err())
+	}
+}
+
+// CreateSession creates a session without sending a prompt and returns its
+// ID, so it can be pre-warmed before the first message arrives. The session
+// is configured like the ones queries create, with the client's model, tools,
+// system message, and provider (including a ContextWithProvider override), and
+// is tracked for DestroyAllSessions. Pass the ID to QueryWithSession or
+// QueryStream to use it. The call counts against WithMaxConcurrentSessions
+// only while the session is being created.
+func (c *Client) CreateSession(ctx context.Context) (string, error) {
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return "", ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	session, err := c.openSession(ctx, "", "", "", nil)
+	if err != nil {
+		return "", fmt.Errorf("session setup: %w", err)
+	}
+	return session.ID(), nil
+}
+
+// TouchSession checks that an existing session can still be resumed, without
+// sending a message. It resumes the session with the client's configured
+// options and returns an error if that fails, which makes it suitable for
+// health-checking a specific conversation before using it. The call counts
+// against WithMaxConcurrentSessions only while the resume is in progress.
+func (c *Client) TouchSession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return ErrEmptySessionID
+	}
+
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err := c.getOrCreateSession(ctx, sessionID, ""); err != nil {
+		return fmt.Errorf("resuming session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// AbortSession cancels the message a session is currently processing, such
+// as a query started by another request. The session itself is kept and can
+// be used for further turns. Aborting an idle session is a no-op on the
+// sidecar. It does not count against WithMaxConcurrentSessions, so an abort
+// always goes through.
+func (c *Client) AbortSession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return ErrEmptySessionID
+	}
+	if err := c.validateSessionID(sessionID); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	// Tools still running for the aborted message should stop too.
+	c.cfg.toolCtxs.cancel(sessionID)
+
+	resumeCfg, err := c.buildResumeConfig("")
+	if err != nil {
+		return err
+	}
+	session, err := c.resumeSession(ctx, sessionID, resumeCfg)
+	if err != nil {
+		return fmt.Errorf("resuming session %s: %w", sessionID, err)
+	}
+	return session.Abort(ctx)
+}
 
-	return events, session.ID(), nil
-}
-
 // DestroySession deletes a session on the sidecar.
 func (c *Client) DestroySession(ctx context.Context, sessionID string) error {
+	if err := c.validateSessionID(sessionID); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	if err := c.sdk.DeleteSession(ctx, sessionID); err != nil {
+		return err
+	}
+	c.untrackSession(sessionID)
+	return nil
+}
+
+// ResetSession clears the conversation history of a session while keeping
+// its ID: the session is deleted on the sidecar and recreated under the same
+// ID with the client's configured model, tools, and provider, so the next
+// turn starts fresh.
+func (c *Client) ResetSession(ctx context.Context, sessionID string) error {
+	if sessionID == "" {
+		return ErrEmptySessionID
+	}
+	if err := c.validateSessionID(sessionID); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	release, err := c.acquireSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := c.sdk.DeleteSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("deleting session: %w", err)
+	}
+	c.untrackSession(sessionID)
+
+	sessionCfg, err := c.buildSessionConfig("")
+	if err != nil {
+		return err
+	}
+	sessionCfg.SessionID = sessionID
+	session, err := c.createSession(ctx, sessionCfg)
+	if err != nil {
+		return fmt.Errorf("recreating session: %w", err)
+	}
+	c.trackSession(session.ID())
+	return nil
+}
+
+// DestroyAllSessions deletes every session this client has created and not
+// yet destroyed. It attempts all deletions and returns their errors joined;
+// sessions that fail to delete remain tracked so a later call can retry them.
+func (c *Client) DestroyAllSessions(ctx context.Context) error {
 	c.mu.RLock()
 	if !c.connected {
 		c.mu.RUnlock()
@@ -295,54 +1574,190 @@ func (c *Client) DestroySession(ctx context.Context, sessionID string) error {
 	}
 	c.mu.RUnlock()
 
-	return c.sdk.DeleteSession(ctx, sessionID)
+	c.sessionsMu.Lock()
+	ids := make([]string, 0, len(c.sessions))
+	for id := range c.sessions {
+		ids = append(ids, id)
+	}
+	c.sessionsMu.Unlock()
+
+	var errs []error
+	for _, id := range ids {
+		if err := c.sdk.DeleteSession(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("destroying session %s: %w", id, err))
+			continue
+		}
+		c.untrackSession(id)
+	}
+	return errors.Join(errs...)
+}
+
+// validateSessionID applies the WithSessionIDValidator validator to a
+// caller-supplied session ID. Empty IDs, which request a new session, pass.
+func (c *Client) validateSessionID(sessionID string) error {
+	if sessionID == "" || c.cfg.sessionIDCheck == nil {
+		return nil
+	}
+	if err := c.cfg.sessionIDCheck(sessionID); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSessionID, err)
+	}
+	return nil
+}
+
+// trackSession records a session created by this client.
+func (c *Client) trackSession(sessionID string) {
+	c.sessionsMu.Lock()
+	c.sessions[sessionID] = struct{}{}
+	c.sessionsMu.Unlock()
+}
+
+// untrackSession forgets a destroyed session.
+func (c *Client) untrackSession(sessionID string) {
+	c.sessionsMu.Lock()
+	delete(c.sessions, sessionID)
+	c.sessionsMu.Unlock()
 }
 
 // getOrCreateSession resumes an existing session or creates a new one with
-// the client's configured tools, model, and provider settings.
-func (c *Client) getOrCreateSession(ctx context.Context, sessionID string) (sdkSession, error) {
+// the client's configured tools, model, and provider settings. A non-empty
+// model overrides the configured one. With WithAutoRecreateSession, a session
+// the sidecar no longer knows is replaced by a new one.
+func (c *Client) getOrCreateSession(ctx context.Context, sessionID, model string) (SDKSession, error) {
+	return c.openSession(ctx, sessionID, model, "", nil)
+}
+
+// openSession implements getOrCreateSession. A non-empty system is appended
+// to the configured system message, and a non-nil provider replaces the
+// configured one. Otherwise a ContextWithProvider override applies.
+func (c *Client) openSession(ctx context.Context, sessionID, model, system string, provider *copilot.ProviderConfig) (SDKSession, error) {
+	if err := c.validateSessionID(sessionID); err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		var err error
+		if provider, err = c.providerConfig(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+
 	if sessionID != "" {
-		resumeCfg := &copilot.ResumeSessionConfig{
-			Model:     c.cfg.model,
-			Streaming: c.cfg.streaming,
-			Tools:     c.sdkTools(),
-		}
-		if c.cfg.systemMessage != "" {
-			resumeCfg.SystemMessage = &copilot.SystemMessageConfig{
-				Mode:    "append",
-				Content: c.cfg.systemMessage,
-			}
+		resumeCfg, err := c.buildResumeConfig(model)
+		if err != nil {
+			return nil, err
+		}
+		resumeCfg.SystemMessage = c.systemMessageConfig(system)
+		if provider != nil {
+			resumeCfg.Provider = provider
 		}
-		if c.cfg.authMode == AuthModeBYOK {
-			resumeCfg.Provider = c.buildProvider()
+		session, err := c.resumeSession(ctx, sessionID, resumeCfg)
+		if err == nil || !c.cfg.autoRecreate || !errors.Is(err, ErrSessionNotFound) {
+			return session, err
 		}
-		return c.sdk.ResumeSessionWithOptions(ctx, sessionID, resumeCfg)
+		c.cfg.logger.Info("copilot session not found, creating a new one", "session_id", sessionID)
 	}
 
-	sessionCfg := c.buildSessionConfig()
-	return c.sdk.CreateSession(ctx, sessionCfg)
+	sessionCfg, err := c.buildSessionConfig(model)
+	if err != nil {
+		return nil, err
+	}
+	sessionCfg.SystemMessage = c.systemMessageConfig(system)
+	if provider != nil {
+		sessionCfg.Provider = provider
+	}
+	session, err := c.createSession(ctx, sessionCfg)
+	if err != nil {
+		return nil, err
+	}
+	c.trackSession(session.ID())
+	return session, nil
 }
 
-// buildSessionConfig assembles a SessionConfig from the client's resolved cfg.
-func (c *Client) buildSessionConfig() *copilot.SessionConfig {
-	sc := &copilot.SessionConfig{
-		Model:     c.cfg.model,
-		Streaming: c.cfg.streaming,
-		Tools:     c.sdkTools(),
+// createSession creates a session from cfg after applying the
+// WithSessionConfigHook hooks.
+func (c *Client) createSession(ctx context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+	for _, hook := range c.cfg.sessionHooks {
+		hook(cfg)
 	}
+	return c.sdk.CreateSession(ctx, cfg)
+}
 
-	if c.cfg.systemMessage != "" {
-		sc.SystemMessage = &copilot.SystemMessageConfig{
-			Mode:    "append",
-			Content: c.cfg.systemMessage,
-		}
+// resumeSession resumes sessionID with cfg after applying the
+// WithResumeConfigHook hooks.
+func (c *Client) resumeSession(ctx context.Context, sessionID string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
+	for _, hook := range c.cfg.resumeHooks {
+		hook(cfg)
+	}
+	return c.sdk.ResumeSessionWithOptions(ctx, sessionID, cfg)
+}
+
+// buildResumeConfig assembles a ResumeSessionConfig from the client's
+// resolved cfg. A non-empty model takes precedence over the configured one.
+func (c *Client) buildResumeConfig(model string) (*copilot.ResumeSessionConfig, error) {
+	tools, available, err := c.sessionTools()
+	if err != nil {
+		return nil, err
+	}
+	rc := &copilot.ResumeSessionConfig{
+		Model:          c.sessionModel(model),
+		Streaming:      c.cfg.streaming,
+		Tools:          tools,
+		AvailableTools: available,
 	}
+	rc.SystemMessage = c.systemMessageConfig("")
+	if c.cfg.authMode == AuthModeBYOK {
+		rc.Provider = c.buildProvider()
+	}
+	return rc, nil
+}
+
+// buildSessionConfig assembles a SessionConfig from the client's resolved cfg.
+// A non-empty model takes precedence over the configured one.
+func (c *Client) buildSessionConfig(model string) (*copilot.SessionConfig, error) {
+	tools, available, err := c.sessionTools()
+	if err != nil {
+		return nil, err
+	}
+	sc := &copilot.SessionConfig{
+		Model:          c.sessionModel(model),
+		Streaming:      c.cfg.streaming,
+		Tools:          tools,
+		AvailableTools: available,
+	}
+	sc.SystemMessage = c.systemMessageConfig("")
 
 	if c.cfg.authMode == AuthModeBYOK {
 		sc.Provider = c.buildProvider()
 	}
 
-	return sc
+	return sc, nil
+}
+
+// systemMessageConfig returns the configured system message with extra
+// appended on a new line, or nil if both are empty.
+func (c *Client) systemMessageConfig(extra string) *copilot.SystemMessageConfig {
+	content := c.cfg.systemMessage
+	switch {
+	case extra == "":
+	case content == "":
+		content = extra
+	default:
+		content += "\n" + extra
+	}
+	if content == "" {
+		return nil
+	}
+	return &copilot.SystemMessageConfig{
+		Mode:    "append",
+		Content: content,
+	}
+}
+
+// sessionModel returns override if set, else the configured model.
+func (c *Client) sessionModel(override string) string {
+	if override != "" {
+		return override
+	}
+	return c.cfg.model
 }
 
 // buildProvider creates a ProviderConfig from the client's resolved cfg.
@@ -362,15 +1777,160 @@ func (c *Client) buildProvider() *copilot.ProviderConfig {
 	return p
 }
 
-// sdkTools converts the configured ToolDefinitions to SDK Tool values.
+// RegisterTool adds a tool to the set offered to sessions created or resumed
+// after the call. Sessions that are already live keep their original tools.
+// Returns ErrDuplicateTool if a tool with the same name is already registered.
+func (c *Client) RegisterTool(td ToolDefinition) error {
+	if td.Name == "" {
+		return errors.New("tool name must not be empty")
+	}
+
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+
+	for _, existing := range c.cfg.tools {
+		if existing.Name == td.Name {
+			return fmt.Errorf("%w: %s", ErrDuplicateTool, td.Name)
+		}
+	}
+	for _, existing := range c.cfg.typedTools {
+		if existing.Name == td.Name {
+			return fmt.Errorf("%w: %s", ErrDuplicateTool, td.Name)
+		}
+	}
+
+	// Copy on write so a concurrent sdkTools snapshot is never mutated.
+	tools := make([]ToolDefinition, len(c.cfg.tools), len(c.cfg.tools)+1)
+	copy(tools, c.cfg.tools)
+	c.cfg.tools = append(tools, td)
+	return nil
+}
+
+// UnregisterTool removes the named tool from the set offered to future
+// sessions. It reports whether a tool was removed.
+//
+// A removal that would break WithToolChoice, i.e. of the tool it names or of
+// the last tool under ToolChoiceRequired, is refused with an error wrapping
+// ErrUnknownToolChoice, and the tool stays registered.
+func (c *Client) UnregisterTool(name string) (bool, error) {
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+
+	for i, existing := range c.cfg.tools {
+		if existing.Name != name {
+			continue
+		}
+		previous := c.cfg.tools
+		tools := make([]ToolDefinition, 0, len(c.cfg.tools)-1)
+		tools = append(tools, c.cfg.tools[:i]...)
+		c.cfg.tools = append(tools, c.cfg.tools[i+1:]...)
+		if err := c.cfg.validateToolChoice(); err != nil {
+			c.cfg.tools = previous
+			return false, fmt.Errorf("unregistering tool %s: %w", name, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// noToolsAllowed is the only entry of the tool allow-list under
+// ToolChoiceNone. It names no tool, so the session can call none.
+const noToolsAllowed = "copilotcli-no-tools"
+
+// sessionTools returns the SDK tools and tool allow-list for a new or resumed
+// session, applying the configured tool choice. ToolChoiceRequired with no
+// tools is an error: the SDK treats an empty allow-list as allowing every
+// built-in tool.
+func (c *Client) sessionTools() ([]copilot.Tool, []string, error) {
+	tools := c.sdkTools()
+
+	switch c.cfg.toolChoice {
+	case "", ToolChoiceAuto:
+		return tools, nil, nil
+	case ToolChoiceNone:
+		// An empty allow-list would allow every built-in tool; allow only a
+		// name no tool has instead.
+		return nil, []string{noToolsAllowed}, nil
+	case ToolChoiceRequired:
+		if len(tools) == 0 {
+			return nil, nil, fmt.Errorf("%w: %q requires at least one tool", ErrUnknownToolChoice, c.cfg.toolChoice)
+		}
+		names := make([]string, len(tools))
+		for i, t := range tools {
+			names[i] = t.Name
+		}
+		return tools, names, nil
+	default:
+		return tools, []string{c.cfg.toolChoice}, nil
+	}
+}
+
+// sdkTools converts the configured ToolDefinitions to SDK Tool values,
+// followed by the WithTypedTool tools.
 func (c *Client) sdkTools() []copilot.Tool {
-	if len(c.cfg.tools) == 0 {
+	c.toolsMu.RLock()
+	defer c.toolsMu.RUnlock()
+
+	if len(c.cfg.tools) == 0 && len(c.cfg.typedTools) == 0 {
 		return nil
 	}
 
-	tools := make([]copilot.Tool, len(c.cfg.tools))
-	for i, td := range c.cfg.tools {
-		tools[i] = td.toSDKTool()
+	tools := make([]copilot.Tool, 0, len(c.cfg.tools)+len(c.cfg.typedTools))
+	for _, td := range c.cfg.tools {
+		tools = append(tools, c.limitToolRounds(limitTool(instrumentTool(td.toSDKTool(c.cfg.toolCtxs, c.cfg.clock), c.cfg.metrics, c.cfg.clock), c.toolSlots, c.cfg.toolCtxs)))
+	}
+	for _, t := range c.cfg.typedTools {
+		tools = append(tools, c.limitToolRounds(limitTool(instrumentTool(t, c.cfg.metrics, c.cfg.clock), c.toolSlots, c.cfg.toolCtxs)))
 	}
 	return tools
 }
+
+// beginToolRounds starts counting the tool calls of the query about to run on
+// sessionID against the WithMaxToolRounds budget, and returns the function
+// that stops counting once the query ends.
+func (c *Client) beginToolRounds(sessionID string) func() {
+	if c.toolRounds == nil {
+		return func() {}
+	}
+
+	c.toolRoundsMu.Lock()
+	c.toolRounds[sessionID] = 0
+	c.toolRoundsMu.Unlock()
+	return func() {
+		c.toolRoundsMu.Lock()
+		delete(c.toolRounds, sessionID)
+		c.toolRoundsMu.Unlock()
+	}
+}
+
+// limitToolRounds refuses the tool's calls once the running query on the
+// invoking session has used up its WithMaxToolRounds budget, telling the
+// model to answer with what it has instead. Refused calls do not reach the
+// handler. Calls outside a counted query are not limited.
+func (c *Client) limitToolRounds(tool copilot.Tool) copilot.Tool {
+	if c.toolRounds == nil || tool.Handler == nil {
+		return tool
+	}
+
+	handler := tool.Handler
+	tool.Handler = func(invocation copilot.ToolInvocation) (copilot.ToolResult, error) {
+		c.toolRoundsMu.Lock()
+		n, counted := c.toolRounds[invocation.SessionID]
+		if counted {
+			n++
+			c.toolRounds[invocation.SessionID] = n
+		}
+		c.toolRoundsMu.Unlock()
+
+		if counted && n > c.cfg.maxToolRounds {
+			return copilot.ToolResult{
+				TextResultForLLM: fmt.Sprintf("error: %s (limit %d); do not call any more tools, answer with the information you already have",
+					ErrToolLoopExceeded.Error(), c.cfg.maxToolRounds),
+				ResultType: "error",
+				SessionLog: fmt.Sprintf("Tool %s refused: %s", tool.Name, ErrToolLoopExceeded.Error()),
+			}, nil
+		}
+		return handler(invocation)
+	}
+	return tool
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -25,7 +29,7 @@ const testMsgID = "msg-1"
 func TestQueryWithSession_SuccessfulQuery(t *testing.T) {
 	sess := &mockSDKSession{id: "sess-abc"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -50,10 +54,125 @@ func TestQueryWithSession_SuccessfulQuery(t *testing.T) {
 	assert.Equal(t, "sess-abc", result.SessionID)
 }
 
+func TestClient_Ask(t *testing.T) {
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("ask-sess", "42", ""), nil
+		},
+	})
+
+	answer, err := client.Ask(t.Context(), "meaning of life?")
+	require.NoError(t, err)
+	assert.Equal(t, "42", answer)
+
+	_, err = client.Ask(t.Context(), "")
+	require.ErrorIs(t, err, ErrEmptyPrompt)
+
+	client.connected = false
+	_, err = client.Ask(t.Context(), "hi")
+	require.ErrorIs(t, err, ErrNotConnected)
+}
+
+func TestQueryWithOptions_MessageOptions(t *testing.T) {
+	var sent copilot.MessageOptions
+	sess := providerSession("msg-sess", "read it", "")
+	send := sess.sendFn
+	sess.sendFn = func(ctx context.Context, options copilot.MessageOptions) (string, error) {
+		sent = options
+		return send(ctx, options)
+	}
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+	})
+
+	attachments := []copilot.Attachment{{Type: copilot.File, DisplayName: "report.txt", Path: ptr("/tmp/report.txt")}}
+	_, err := client.QueryWithOptions(t.Context(), QueryOptions{
+		Prompt: "summarize the report",
+		Message: copilot.MessageOptions{
+			Prompt:      "ignored",
+			Attachments: attachments,
+			Mode:        "immediate",
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "summarize the report", sent.Prompt)
+	assert.Equal(t, attachments, sent.Attachments)
+	assert.Equal(t, "immediate", sent.Mode)
+}
+
+func TestMaxPromptLength(t *testing.T) {
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("len-sess", "ok", ""), nil
+		},
+	}, WithMaxPromptLength(5))
+
+	// Runes, not bytes: five multi-byte characters fit.
+	_, err := client.Query(t.Context(), "héllo")
+	require.NoError(t, err)
+
+	_, err = client.Query(t.Context(), "too long")
+	require.ErrorIs(t, err, ErrPromptTooLong)
+	assert.Contains(t, err.Error(), "8 characters, limit is 5")
+
+	_, _, err = client.QueryStream(t.Context(), "", "too long")
+	require.ErrorIs(t, err, ErrPromptTooLong)
+
+	handler := NewQueryHandler(client)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/copilot/query", strings.NewReader(`{"prompt":"too long"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestQueryWithOptions_ModelOverride(t *testing.T) {
+	var createdModel, resumedModel string
+	newSess := func(id string) *mockSDKSession {
+		sess := &mockSDKSession{id: id}
+		sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+			go func() {
+				sess.emit(&copilot.SessionEvent{
+					Type: copilot.AssistantMessage,
+					Data: copilot.Data{Content: ptr("ok")},
+				})
+				sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+			}()
+			return testMsgID, nil
+		}
+		return sess
+	}
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			createdModel = cfg.Model
+			return newSess("new-sess"), nil
+		},
+		resumeFn: func(_ context.Context, sessionID string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
+			resumedModel = cfg.Model
+			return newSess(sessionID), nil
+		},
+	}
+	client := newTestClient(mock, WithModel("gpt-4o-mini"))
+
+	_, err := client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hard question", Model: "gpt-5"})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-5", createdModel)
+
+	_, err = client.QueryWithOptions(t.Context(), QueryOptions{SessionID: "s1", Prompt: "follow-up", Model: "gpt-5"})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-5", resumedModel)
+
+	_, err = client.Query(t.Context(), "easy question")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", createdModel)
+
+	_, err = client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", Model: "  "})
+	require.ErrorIs(t, err, ErrEmptyModel)
+}
+
 func TestQueryWithSession_SessionError(t *testing.T) {
 	sess := &mockSDKSession{id: "sess-err"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -75,10 +194,46 @@ func TestQueryWithSession_SessionError(t *testing.T) {
 	assert.Contains(t, err.Error(), "model overloaded")
 }
 
+func TestQueryWithSession_PartialResultOnError(t *testing.T) {
+	sess := &mockSDKSession{id: "sess-partial"}
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return sess, nil
+		},
+	}
+
+	sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+		go func() {
+			sess.emit(&copilot.SessionEvent{
+				Type: copilot.AssistantMessageDelta,
+				Data: copilot.Data{DeltaContent: ptr("The first half")},
+			})
+			sess.emit(&copilot.SessionEvent{
+				Type: copilot.AssistantMessageDelta,
+				Data: copilot.Data{DeltaContent: ptr(" of an answer")},
+			})
+			sess.emit(&copilot.SessionEvent{
+				Type: copilot.SessionError,
+				Data: copilot.Data{Message: ptr("rate limited")},
+			})
+		}()
+		return testMsgID, nil
+	}
+
+	client := newTestClient(mock)
+	_, err := client.QueryWithSession(t.Context(), "", "hi")
+
+	var partial *PartialResultError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, "The first half of an answer", partial.Content)
+	assert.Equal(t, "sess-partial", partial.SessionID)
+	assert.Contains(t, err.Error(), "rate limited")
+}
+
 func TestQueryWithSession_SessionErrorNilMessage(t *testing.T) {
 	sess := &mockSDKSession{id: "sess-e2"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -100,6 +255,242 @@ func TestQueryWithSession_SessionErrorNilMessage(t *testing.T) {
 	assert.Contains(t, err.Error(), "session error")
 }
 
+func TestWithErrorPrefix(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return streamSession("sess-prefix", copilot.SessionEvent{
+				Type: copilot.SessionError,
+				Data: copilot.Data{Message: ptr("model overloaded")},
+			}), nil
+		},
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		expect string
+	}{
+		{"default", nil, "copilot: model overloaded"},
+		{"custom", []Option{WithErrorPrefix("assistant: ")}, "assistant: model overloaded"},
+		{"disabled", []Option{WithErrorPrefix("")}, "model overloaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(mock, tt.opts...)
+
+			_, err := client.QueryWithSession(t.Context(), "", "hi")
+			require.EqualError(t, err, tt.expect)
+
+			events, _, err := client.QueryStream(t.Context(), "", "hi")
+			require.NoError(t, err)
+			var streamErr error
+			for evt := range events {
+				streamErr = evt.Error
+			}
+			require.EqualError(t, streamErr, tt.expect)
+		})
+	}
+}
+
+func TestSessionError_RateLimited(t *testing.T) {
+	tests := []struct {
+		name string
+		data copilot.Data
+		want bool
+	}{
+		{"status code", copilot.Data{Message: ptr("request failed"), StatusCode: ptr(int64(429))}, true},
+		{"message", copilot.Data{Message: ptr("Rate limit reached for gpt-4o")}, true},
+		{"too many requests", copilot.Data{Message: ptr("Too Many Requests")}, true},
+		{"other status", copilot.Data{Message: ptr("request failed"), StatusCode: ptr(int64(500))}, false},
+		{"no message", copilot.Data{}, false},
+	}
+	client := newTestClient(&mockSDKClient{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.sessionError(&tt.data)
+			assert.Equal(t, tt.want, errors.Is(err, ErrRateLimited))
+			if tt.data.Message != nil {
+				assert.EqualError(t, err, "copilot: "+*tt.data.Message, "classification keeps the message")
+			}
+		})
+	}
+}
+
+// turnSession returns a session that emits the next of turns on each Send,
+// recording the prompts it was sent.
+func turnSession(id string, turns ...[]copilot.SessionEvent) (*mockSDKSession, func() []string) {
+	sess := &mockSDKSession{id: id}
+	var (
+		mu      sync.Mutex
+		prompts []string
+	)
+	sess.sendFn = func(_ context.Context, msg copilot.MessageOptions) (string, error) {
+		mu.Lock()
+		n := len(prompts)
+		prompts = append(prompts, msg.Prompt)
+		mu.Unlock()
+		if n >= len(turns) {
+			return "", errors.New("unexpected send")
+		}
+		go func() {
+			for i := range turns[n] {
+				sess.emit(&turns[n][i])
+			}
+		}()
+		return testMsgID, nil
+	}
+	return sess, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(prompts)
+	}
+}
+
+func TestQueryStream_ResumeOnError(t *testing.T) {
+	rateLimited := []copilot.SessionEvent{
+		{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("The answer ")}},
+		{Type: copilot.SessionError, Data: copilot.Data{Message: ptr("rate limited"), StatusCode: ptr(int64(429))}},
+		{Type: copilot.SessionIdle},
+	}
+	continuation := []copilot.SessionEvent{
+		{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("is 42.")}},
+		{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("is 42.")}},
+		{Type: copilot.SessionIdle},
+	}
+
+	stream := func(t *testing.T, sess *mockSDKSession, opts ...Option) (deltas []string, last StreamEvent) {
+		t.Helper()
+		opts = append(opts, WithRetryDelay(time.Millisecond))
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		}, opts...)
+		events, _, err := client.QueryStream(t.Context(), "", "What is the answer?")
+		require.NoError(t, err)
+		for evt := range events {
+			if evt.DeltaContent != "" {
+				deltas = append(deltas, evt.DeltaContent)
+			}
+			last = evt
+		}
+		return deltas, last
+	}
+
+	t.Run("rate limit mid-stream continues", func(t *testing.T) {
+		sess, prompts := turnSession("resume", rateLimited, continuation)
+		deltas, final := stream(t, sess, WithStreamResumeOnError(true))
+
+		require.NoError(t, final.Error)
+		assert.True(t, final.IsFinal)
+		assert.Equal(t, []string{"The answer ", "is 42."}, deltas, "deltas continue on the same channel")
+		assert.Equal(t, "The answer is 42.", final.Content, "partial answer followed by the continuation")
+		assert.Equal(t, 2, final.ChunkCount)
+
+		sent := prompts()
+		require.Len(t, sent, 2)
+		assert.Equal(t, "What is the answer?", sent[0])
+		assert.Contains(t, sent[1], "What is the answer?")
+		assert.Contains(t, sent[1], "The answer ", "continuation includes the partial answer")
+		assert.Contains(t, sent[1], "Continue the answer exactly where it stopped")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		sess, prompts := turnSession("no-resume", rateLimited, continuation)
+		_, last := stream(t, sess)
+
+		require.ErrorIs(t, last.Error, ErrRateLimited)
+		assert.Len(t, prompts(), 1)
+	})
+
+	t.Run("non-retryable error", func(t *testing.T) {
+		failed := []copilot.SessionEvent{
+			{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("The answer ")}},
+			{Type: copilot.SessionError, Data: copilot.Data{Message: ptr("content filtered")}},
+		}
+		sess, prompts := turnSession("bad", failed, continuation)
+		_, last := stream(t, sess, WithStreamResumeOnError(true))
+
+		require.EqualError(t, last.Error, "copilot: content filtered")
+		assert.Len(t, prompts(), 1)
+	})
+
+	t.Run("gives up after repeated failures", func(t *testing.T) {
+		turns := slices.Repeat([][]copilot.SessionEvent{rateLimited}, maxStreamResumes+1)
+		sess, prompts := turnSession("flaky", turns...)
+		_, last := stream(t, sess, WithStreamResumeOnError(true))
+
+		require.ErrorIs(t, last.Error, ErrRateLimited)
+		assert.Len(t, prompts(), maxStreamResumes+1)
+	})
+}
+
+func TestAbortReason(t *testing.T) {
+	// Each context ends shortly after the query has started.
+	tests := []struct {
+		name    string
+		ctx     func(context.Context) (context.Context, context.CancelFunc)
+		reason  AbortReason
+		wantErr error
+	}{
+		{"manual cancel", func(ctx context.Context) (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(ctx)
+			time.AfterFunc(10*time.Millisecond, cancel)
+			return ctx, cancel
+		}, AbortCanceled, context.Canceled},
+		{"deadline", func(ctx context.Context) (context.Context, context.CancelFunc) {
+			return context.WithTimeout(ctx, 10*time.Millisecond)
+		}, AbortTimeout, context.DeadlineExceeded},
+		{"handler deadline", func(ctx context.Context) (context.Context, context.CancelFunc) {
+			return context.WithTimeoutCause(ctx, 10*time.Millisecond, errHandlerTimeout)
+		}, AbortHandlerTimeout, context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess, _ := silentSession()
+			client := newTestClient(&mockSDKClient{
+				createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+			})
+
+			t.Run("query", func(t *testing.T) {
+				ctx, cancel := tt.ctx(t.Context())
+				defer cancel()
+				_, err := client.QueryWithSession(ctx, "", "hi")
+				require.ErrorIs(t, err, tt.wantErr, "the context error still matches")
+				var aborted *AbortError
+				require.ErrorAs(t, err, &aborted)
+				assert.Equal(t, tt.reason, aborted.Reason)
+			})
+
+			t.Run("stream", func(t *testing.T) {
+				ctx, cancel := tt.ctx(t.Context())
+				defer cancel()
+				events, _, err := client.QueryStream(ctx, "", "hi")
+				require.NoError(t, err)
+
+				var last StreamEvent
+				for evt := range events {
+					last = evt
+				}
+				require.ErrorIs(t, last.Error, tt.wantErr)
+				var aborted *AbortError
+				require.ErrorAs(t, last.Error, &aborted)
+				assert.Equal(t, tt.reason, aborted.Reason)
+			})
+		})
+	}
+
+	t.Run("SSE error event", func(t *testing.T) {
+		events := make(chan StreamEvent, 1)
+		events <- StreamEvent{Error: &AbortError{Reason: AbortTimeout, Err: context.DeadlineExceeded}, SessionID: "s1"}
+		close(events)
+
+		var buf strings.Builder
+		require.NoError(t, StreamTo(t.Context(), &buf, nil, events))
+		assert.Contains(t, buf.String(), `"reason":"timeout"`)
+		assert.Contains(t, buf.String(), `"error":"query aborted (timeout): context deadline exceeded"`)
+	})
+}
+
 func TestQueryWithSession_ContextCancellation(t *testing.T) {
 	sess := &mockSDKSession{id: "sess-cancel"}
 	abortCalled := false
@@ -109,7 +500,7 @@ func TestQueryWithSession_ContextCancellation(t *testing.T) {
 	}
 
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -134,7 +525,7 @@ func TestQueryWithSession_ContextCancellation(t *testing.T) {
 func TestQueryWithSession_SendError(t *testing.T) {
 	sess := &mockSDKSession{id: "sess-senderr"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -154,7 +545,7 @@ func TestQueryWithSession_SendError(t *testing.T) {
 func TestQueryWithSession_AssistantMessageNilContent(t *testing.T) {
 	sess := &mockSDKSession{id: "sess-nil"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -181,7 +572,7 @@ func TestQueryWithSession_AssistantMessageNilContent(t *testing.T) {
 func TestQueryWithSession_ResumeSession(t *testing.T) {
 	sess := &mockSDKSession{id: "existing-sess"}
 	mock := &mockSDKClient{
-		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (sdkSession, error) {
+		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
 			assert.Equal(t, "existing-sess", sessionID)
 			return sess, nil
 		},
@@ -213,7 +604,7 @@ func TestQueryWithSession_ResumeSession(t *testing.T) {
 func TestQueryStream_SuccessfulStream(t *testing.T) {
 	sess := &mockSDKSession{id: "stream-sess"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -256,12 +647,186 @@ func TestQueryStream_SuccessfulStream(t *testing.T) {
 	assert.Equal(t, []string{"Hello", ", world!"}, deltas)
 	assert.True(t, finalEvent.IsFinal)
 	assert.Equal(t, "Hello, world!", finalEvent.Content)
+	assert.Equal(t, 2, finalEvent.ChunkCount)
+	assert.Positive(t, finalEvent.Elapsed)
+}
+
+func TestQueryStream_ContentAccumulation(t *testing.T) {
+	delta := func(s string) copilot.SessionEvent {
+		return copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr(s)}}
+	}
+	message := func(s string) copilot.SessionEvent {
+		return copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr(s)}}
+	}
+
+	tests := []struct {
+		name   string
+		events []copilot.SessionEvent
+		want   string
+	}{
+		{
+			name:   "deltas only",
+			events: []copilot.SessionEvent{delta("Hel"), delta("lo")},
+			want:   "Hello",
+		},
+		{
+			name:   "message only",
+			events: []copilot.SessionEvent{message("Hello")},
+			want:   "Hello",
+		},
+		{
+			name:   "message after deltas",
+			events: []copilot.SessionEvent{delta("Hel"), delta("lo"), message("Hello!")},
+			want:   "Hello!",
+		},
+		{
+			name:   "message before deltas",
+			events: []copilot.SessionEvent{message("Hello!"), delta("Hel"), delta("lo")},
+			want:   "Hello!",
+		},
+		{
+			name:   "message between deltas",
+			events: []copilot.SessionEvent{delta("Hel"), message("Hello!"), delta("lo")},
+			want:   "Hello!",
+		},
+		{
+			name:   "empty message",
+			events: []copilot.SessionEvent{delta("Hel"), delta("lo"), message("")},
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := append(slices.Clone(tt.events), copilot.SessionEvent{Type: copilot.SessionIdle})
+			client := newTestClient(&mockSDKClient{
+				createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+					return streamSession("acc", events...), nil
+				},
+			})
+
+			stream, _, err := client.QueryStream(t.Context(), "", "hi")
+			require.NoError(t, err)
+			var final StreamEvent
+			for evt := range stream {
+				if evt.IsFinal {
+					final = evt
+				}
+			}
+			require.True(t, final.IsFinal)
+			assert.Equal(t, tt.want, final.Content)
+
+			result, err := client.Query(t.Context(), "hi")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result.Content, "Query follows the same rule")
+		})
+	}
+}
+
+type recordingMetrics struct {
+	mu         sync.Mutex
+	firstToken []time.Duration
+	toolCalls  []string
+}
+
+func (m *recordingMetrics) ObserveFirstToken(d time.Duration) {
+	m.mu.Lock()
+	m.firstToken = append(m.firstToken, d)
+	m.mu.Unlock()
+}
+
+func (m *recordingMetrics) ObserveToolCall(name string, d time.Duration, success bool) {
+	m.mu.Lock()
+	m.toolCalls = append(m.toolCalls, fmt.Sprintf("%s:%t:%t", name, success, d >= 0))
+	m.mu.Unlock()
+}
+
+func TestQueryStream_FirstTokenLatency(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []copilot.SessionEvent
+	}{
+		{
+			name: "first delta",
+			events: []copilot.SessionEvent{
+				{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("Hi")}},
+				{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("!")}},
+				{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("Hi!")}},
+			},
+		},
+		{
+			name: "single message without deltas",
+			events: []copilot.SessionEvent{
+				{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("Hi!")}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := &mockSDKSession{id: "ftl-sess"}
+			sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+				go func() {
+					time.Sleep(5 * time.Millisecond)
+					for i := range tt.events {
+						sess.emit(&tt.events[i])
+					}
+					time.Sleep(20 * time.Millisecond)
+					sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+				}()
+				return testMsgID, nil
+			}
+			metrics := &recordingMetrics{}
+			client := newTestClient(&mockSDKClient{
+				createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+					return sess, nil
+				},
+			}, WithMetrics(metrics))
+
+			events, _, err := client.QueryStream(t.Context(), "", "hi")
+			require.NoError(t, err)
+
+			var final StreamEvent
+			for evt := range events {
+				if evt.IsFinal {
+					final = evt
+				}
+			}
+
+			assert.GreaterOrEqual(t, final.FirstTokenLatency, 5*time.Millisecond)
+			assert.Less(t, final.FirstTokenLatency, final.Elapsed)
+			metrics.mu.Lock()
+			defer metrics.mu.Unlock()
+			assert.Equal(t, []time.Duration{final.FirstTokenLatency}, metrics.firstToken)
+		})
+	}
+}
+
+func TestMetrics_ToolCalls(t *testing.T) {
+	metrics := &recordingMetrics{}
+	client := newTestClient(&mockSDKClient{}, WithMetrics(metrics), WithTools(
+		ToolDefinition{Name: "ok_tool", Handler: func(map[string]any) (string, error) { return "fine", nil }},
+		ToolDefinition{Name: "bad_tool", Handler: func(map[string]any) (string, error) { return "", errors.New("nope") }},
+		ToolDefinition{Name: "panic_tool", Handler: func(map[string]any) (string, error) { panic("boom") }},
+	))
+
+	for _, tool := range client.sdkTools() {
+		_, err := tool.Handler(copilot.ToolInvocation{Arguments: map[string]any{}})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"ok_tool:true:true", "bad_tool:false:true", "panic_tool:false:true"}, metrics.toolCalls)
+}
+
+func TestWithMetrics_Validation(t *testing.T) {
+	_, err := New(WithMetrics(nil))
+	require.Error(t, err)
 }
 
 func TestQueryStream_ErrorEvent(t *testing.T) {
 	sess := &mockSDKSession{id: "stream-err"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -297,10 +862,192 @@ func TestQueryStream_ErrorEvent(t *testing.T) {
 	assert.Contains(t, collected[1].Error.Error(), "rate limited")
 }
 
+// drain discards events until the channel is closed.
+func drain(events <-chan StreamEvent) {
+	for range events {
+		continue
+	}
+}
+
+// streamSession returns a mock session that emits events after Send.
+func streamSession(id string, events ...copilot.SessionEvent) *mockSDKSession {
+	sess := &mockSDKSession{id: id}
+	sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+		go func() {
+			for i := range events {
+				sess.emit(&events[i])
+			}
+		}()
+		return testMsgID, nil
+	}
+	return sess
+}
+
+func TestQueryStreamWithResult(t *testing.T) {
+	sess := streamSession("res-sess",
+		copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("Hello")}},
+		copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr(" there")}},
+		copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("Hello there")}},
+		copilot.SessionEvent{Type: copilot.SessionIdle},
+	)
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+	})
+
+	events, result, err := client.QueryStreamWithResult(t.Context(), "", "hi")
+	require.NoError(t, err)
+
+	var deltas []string
+	for evt := range events {
+		if !evt.IsFinal {
+			deltas = append(deltas, evt.DeltaContent)
+		}
+	}
+	assert.Equal(t, []string{"Hello", " there"}, deltas)
+
+	for range 2 {
+		res, err := result()
+		require.NoError(t, err)
+		assert.Equal(t, &QueryResult{Content: "Hello there", SessionID: "res-sess"}, res)
+	}
+}
+
+func TestQueryStream_SuppressFinalContent(t *testing.T) {
+	newSess := func() *mockSDKSession {
+		return streamSession("sup-sess",
+			copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("Hel")}},
+			copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("lo")}},
+			copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("Hello")}},
+			copilot.SessionEvent{Type: copilot.SessionIdle},
+		)
+	}
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return newSess(), nil },
+	}, WithStreamSuppressFinalContent(true))
+
+	events, _, err := client.QueryStream(t.Context(), "", "hi")
+	require.NoError(t, err)
+	var final StreamEvent
+	for evt := range events {
+		if evt.IsFinal {
+			final = evt
+		}
+	}
+	assert.True(t, final.IsFinal)
+	assert.Empty(t, final.Content)
+	assert.Equal(t, 2, final.ChunkCount)
+
+	// The result future still assembles the content from the deltas.
+	events, result, err := client.QueryStreamWithResult(t.Context(), "", "hi")
+	require.NoError(t, err)
+	drain(events)
+	res, err := result()
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", res.Content)
+}
+
+func TestQueryStreamWithResult_Error(t *testing.T) {
+	sess := streamSession("res-err",
+		copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("partial")}},
+		copilot.SessionEvent{Type: copilot.SessionError, Data: copilot.Data{Message: ptr("rate limited")}},
+	)
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+	})
+
+	events, result, err := client.QueryStreamWithResult(t.Context(), "", "hi")
+	require.NoError(t, err)
+	drain(events)
+
+	res, err := result()
+	assert.Nil(t, res)
+	var partial *PartialResultError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, "partial", partial.Content)
+	assert.Equal(t, "res-err", partial.SessionID)
+	assert.Contains(t, err.Error(), "rate limited")
+}
+
+func TestQueryStreamToWriter(t *testing.T) {
+	t.Run("writes and flushes deltas", func(t *testing.T) {
+		sess := streamSession("writer",
+			copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("Hello")}},
+			copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr(", world!")}},
+			copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("Hello, world!")}},
+			copilot.SessionEvent{Type: copilot.SessionIdle},
+		)
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+
+		rec := httptest.NewRecorder()
+		res, err := client.QueryStreamToWriter(t.Context(), "", "hi", rec)
+		require.NoError(t, err)
+		assert.Equal(t, "Hello, world!", rec.Body.String())
+		assert.True(t, rec.Flushed)
+		assert.Equal(t, "Hello, world!", res.Content)
+		assert.Equal(t, "writer", res.SessionID)
+	})
+
+	t.Run("write error aborts the turn", func(t *testing.T) {
+		sess, aborted := silentSession()
+		sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+			go sess.emit(&copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("Hello")}})
+			return testMsgID, nil
+		}
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+
+		res, err := client.QueryStreamToWriter(t.Context(), "", "hi", failingWriter{})
+		assert.Nil(t, res)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "broken pipe")
+		select {
+		case <-aborted:
+		case <-time.After(time.Second):
+			t.Fatal("session was not aborted")
+		}
+	})
+
+	t.Run("stream error after deltas", func(t *testing.T) {
+		sess := streamSession("writer-err",
+			copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("partial")}},
+			copilot.SessionEvent{Type: copilot.SessionError, Data: copilot.Data{Message: ptr("rate limited")}},
+		)
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+
+		var buf bytes.Buffer
+		_, err := client.QueryStreamToWriter(t.Context(), "", "hi", &buf)
+		var partial *PartialResultError
+		require.ErrorAs(t, err, &partial)
+		assert.Equal(t, "partial", partial.Content)
+		assert.Equal(t, "partial", buf.String())
+	})
+}
+
+func TestQueryStreamWithResult_ContextCanceled(t *testing.T) {
+	sess := streamSession("res-cancel") // never completes
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	events, result, err := client.QueryStreamWithResult(ctx, "", "hi")
+	require.NoError(t, err)
+
+	cancel()
+	drain(events)
+	_, err = result()
+	require.ErrorIs(t, err, context.Canceled)
+}
+
 func TestQueryStream_ErrorEventNilMessage(t *testing.T) {
 	sess := &mockSDKSession{id: "stream-e2"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -331,7 +1078,7 @@ func TestQueryStream_ErrorEventNilMessage(t *testing.T) {
 func TestQueryStream_SendError(t *testing.T) {
 	sess := &mockSDKSession{id: "stream-senderr"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -352,7 +1099,7 @@ func TestQueryStream_SendError(t *testing.T) {
 func TestQueryStream_ResumeSession(t *testing.T) {
 	sess := &mockSDKSession{id: "resume-stream"}
 	mock := &mockSDKClient{
-		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (sdkSession, error) {
+		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
 			assert.Equal(t, "resume-stream", sessionID)
 			return sess, nil
 		},
@@ -384,10 +1131,549 @@ func TestQueryStream_ResumeSession(t *testing.T) {
 	assert.Equal(t, "done", final.Content)
 }
 
+// silentSession accepts prompts but never emits an event, recording aborts.
+func silentSession() (*mockSDKSession, <-chan struct{}) {
+	aborted := make(chan struct{})
+	var once sync.Once
+	return &mockSDKSession{
+		id:      "silent",
+		abortFn: func(context.Context) error { once.Do(func() { close(aborted) }); return nil },
+	}, aborted
+}
+
+// heldSession emits a delta right away, closes delivered, and completes only
+// once release is closed.
+func heldSession(release <-chan struct{}) (*mockSDKSession, <-chan struct{}) {
+	delivered := make(chan struct{})
+	sess := &mockSDKSession{id: "held"}
+	sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+		go func() {
+			sess.emit(&copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("he")}})
+			close(delivered)
+			<-release
+			sess.emit(&copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("llo")}})
+			sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+		}()
+		return testMsgID, nil
+	}
+	return sess, delivered
+}
+
+// expireAfter fires clk once delivered is closed, then closes release.
+func expireAfter(clk *manualClock, delivered <-chan struct{}, release chan<- struct{}) {
+	go func() {
+		<-delivered
+		clk.fire <- time.Time{}
+		close(release)
+	}()
+}
+
+// floodSession emits n deltas "0,", "1,", ... without waiting for the
+// consumer, closes emitted, and then goes idle.
+func floodSession(n int) (*mockSDKSession, <-chan struct{}) {
+	emitted := make(chan struct{})
+	sess := &mockSDKSession{id: "flood"}
+	sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+		go func() {
+			for i := range n {
+				sess.emit(&copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr(fmt.Sprintf("%d,", i))}})
+			}
+			close(emitted)
+			sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+		}()
+		return testMsgID, nil
+	}
+	return sess, emitted
+}
+
+func TestQueryStream_OverflowPolicy(t *testing.T) {
+	const n = 100
+	var want strings.Builder
+	for i := range n {
+		fmt.Fprintf(&want, "%d,", i)
+	}
+
+	// collect returns the deltas and the final event of a stream.
+	collect := func(events <-chan StreamEvent) ([]string, StreamEvent) {
+		var deltas []string
+		var final StreamEvent
+		for e := range events {
+			if e.IsFinal {
+				final = e
+			} else {
+				deltas = append(deltas, e.DeltaContent)
+			}
+		}
+		return deltas, final
+	}
+
+	stream := func(t *testing.T, opts ...Option) (<-chan StreamEvent, <-chan struct{}) {
+		t.Helper()
+		sess, emitted := floodSession(n)
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		}, opts...)
+		events, _, err := client.QueryStream(t.Context(), "", "hi")
+		require.NoError(t, err)
+		return events, emitted
+	}
+
+	t.Run("block waits for the consumer", func(t *testing.T) {
+		events, emitted := stream(t)
+
+		select {
+		case <-emitted:
+			t.Fatal("deltas were emitted past a full channel")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		deltas, final := collect(events)
+		assert.Len(t, deltas, n)
+		assert.Equal(t, want.String(), strings.Join(deltas, ""))
+		assert.Equal(t, want.String(), final.Content)
+		assert.Equal(t, n, final.ChunkCount)
+	})
+
+	t.Run("coalesce merges pending deltas", func(t *testing.T) {
+		events, emitted := stream(t, WithStreamOverflowPolicy(StreamOverflowCoalesce))
+		<-emitted
+
+		deltas, final := collect(events)
+		assert.Len(t, deltas, cap(events)+1)
+		assert.Equal(t, want.String(), strings.Join(deltas, ""))
+		assert.Equal(t, want.String(), final.Content)
+		assert.Equal(t, n, final.ChunkCount)
+	})
+
+	t.Run("drop_oldest keeps the latest deltas", func(t *testing.T) {
+		events, emitted := stream(t, WithStreamOverflowPolicy(StreamOverflowDropOldest))
+		<-emitted
+
+		deltas, final := collect(events)
+		require.Len(t, deltas, cap(events))
+		assert.Equal(t, fmt.Sprintf("%d,", n-cap(events)), deltas[0])
+		assert.Equal(t, fmt.Sprintf("%d,", n-1), deltas[len(deltas)-1])
+		assert.Equal(t, want.String(), final.Content)
+		assert.Equal(t, n, final.ChunkCount)
+	})
+
+	t.Run("rejects unknown policies", func(t *testing.T) {
+		_, err := New(WithStreamOverflowPolicy("latest"))
+		require.Error(t, err)
+	})
+}
+
+func TestQueryStream_ConcurrentEmissionOrdering(t *testing.T) {
+	const (
+		emitters = 8
+		perEmit  = 200
+	)
+
+	for _, policy := range []StreamOverflowPolicy{StreamOverflowBlock, StreamOverflowCoalesce} {
+		t.Run(string(policy), func(t *testing.T) {
+			sess := &mockSDKSession{id: "stress"}
+			sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+				go func() {
+					var wg sync.WaitGroup
+					for g := range emitters {
+						wg.Go(func() {
+							for i := range perEmit {
+								sess.emit(&copilot.SessionEvent{
+									Type: copilot.AssistantMessageDelta,
+									Data: copilot.Data{DeltaContent: ptr(fmt.Sprintf("%d:%d;", g, i))},
+								})
+							}
+						})
+					}
+					wg.Wait()
+					sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+				}()
+				return testMsgID, nil
+			}
+			client := newTestClient(&mockSDKClient{
+				createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+			}, WithStreamOverflowPolicy(policy))
+
+			events, _, err := client.QueryStream(t.Context(), "", "hi")
+			require.NoError(t, err)
+
+			var (
+				streamed strings.Builder
+				final    StreamEvent
+			)
+			for evt := range events {
+				if evt.IsFinal {
+					final = evt
+					continue
+				}
+				require.False(t, final.IsFinal, "no delta after the final event")
+				streamed.WriteString(evt.DeltaContent)
+			}
+
+			require.True(t, final.IsFinal)
+			assert.Equal(t, emitters*perEmit, final.ChunkCount)
+			assert.Equal(t, final.Content, streamed.String(), "deltas arrive in accumulation order")
+
+			// Each emitter's deltas stay in the order it sent them.
+			next := make([]int, emitters)
+			for _, chunk := range strings.Split(strings.TrimSuffix(streamed.String(), ";"), ";") {
+				var g, i int
+				_, err := fmt.Sscanf(chunk, "%d:%d", &g, &i)
+				require.NoError(t, err)
+				require.Equal(t, next[g], i, "emitter %d out of order", g)
+				next[g]++
+			}
+			for g := range emitters {
+				assert.Equal(t, perEmit, next[g])
+			}
+		})
+	}
+}
+
+// syncSession emits events synchronously from within Send, before it returns.
+func syncSession(id string, events ...copilot.SessionEvent) *mockSDKSession {
+	sess := &mockSDKSession{id: id}
+	sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+		for i := range events {
+			sess.emit(&events[i])
+		}
+		return testMsgID, nil
+	}
+	return sess
+}
+
+func TestSynchronousEventsFromSend(t *testing.T) {
+	reply := []copilot.SessionEvent{
+		{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("sync ")}},
+		{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("reply")}},
+		{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("sync reply")}},
+		{Type: copilot.SessionIdle},
+	}
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return syncSession("sync", reply...), nil
+		},
+	})
+
+	t.Run("query", func(t *testing.T) {
+		result, err := client.Query(t.Context(), "hi")
+		require.NoError(t, err)
+		assert.Equal(t, "sync reply", result.Content)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		events, _, err := client.QueryStream(t.Context(), "", "hi")
+		require.NoError(t, err)
+
+		var deltas []string
+		var final StreamEvent
+		for e := range events {
+			if e.IsFinal {
+				final = e
+			} else {
+				deltas = append(deltas, e.DeltaContent)
+			}
+		}
+		assert.Equal(t, []string{"sync ", "reply"}, deltas)
+		assert.Equal(t, "sync reply", final.Content)
+	})
+
+	t.Run("subscribe", func(t *testing.T) {
+		events, _, err := client.Subscribe(t.Context(), "", "hi")
+		require.NoError(t, err)
+
+		var types []copilot.SessionEventType
+		for e := range events {
+			types = append(types, e.Type)
+		}
+		assert.Equal(t, []copilot.SessionEventType{
+			copilot.AssistantMessageDelta, copilot.AssistantMessageDelta, copilot.AssistantMessage, copilot.SessionIdle,
+		}, types)
+	})
+}
+
+func TestQueryWithSession_EventsAfterError(t *testing.T) {
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return syncSession("late",
+				copilot.SessionEvent{Type: copilot.SessionError, Data: copilot.Data{Message: ptr("boom")}},
+				copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("too late")}},
+				copilot.SessionEvent{Type: copilot.SessionIdle},
+				copilot.SessionEvent{Type: copilot.SessionError, Data: copilot.Data{Message: ptr("again")}},
+			), nil
+		},
+	})
+
+	_, err := client.Query(t.Context(), "hi")
+	require.EqualError(t, err, "copilot: boom")
+}
+
+func TestWithPromptTemplate(t *testing.T) {
+	var sent []string
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			sess := providerSession("tmpl", "ok", "")
+			send := sess.sendFn
+			sess.sendFn = func(ctx context.Context, opts copilot.MessageOptions) (string, error) {
+				sent = append(sent, opts.Prompt)
+				return send(ctx, opts)
+			}
+			return sess, nil
+		},
+	}
+	client := newTestClient(mock, WithPromptTemplate(`Answer in {{or .Lang "JSON"}}: {{.Prompt}}`))
+
+	_, err := client.QueryWithSession(t.Context(), "", "list colors")
+	require.NoError(t, err)
+
+	_, err = client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "list fruits", TemplateVars: map[string]any{"Lang": "YAML"}})
+	require.NoError(t, err)
+
+	events, _, err := client.QueryStream(t.Context(), "", "list trees")
+	require.NoError(t, err)
+	drain(events)
+
+	assert.Equal(t, []string{
+		"Answer in JSON: list colors",
+		"Answer in YAML: list fruits",
+		"Answer in JSON: list trees",
+	}, sent)
+}
+
+func TestWithPromptTemplate_Errors(t *testing.T) {
+	_, err := New(WithPromptTemplate("{{.Prompt"))
+	require.ErrorContains(t, err, "parsing prompt template")
+
+	client := newTestClient(&mockSDKClient{}, WithPromptTemplate("{{index .Prompt 99}}"))
+	_, err = client.Query(t.Context(), "hi")
+	require.ErrorContains(t, err, "rendering prompt template")
+
+	limited := newTestClient(&mockSDKClient{}, WithPromptTemplate("Please answer: {{.Prompt}}"), WithMaxPromptLength(10))
+	_, err = limited.Query(t.Context(), "hi")
+	require.ErrorIs(t, err, ErrPromptTooLong)
+}
+
+func TestClient_InFlight(t *testing.T) {
+	t.Run("query until canceled", func(t *testing.T) {
+		sess, _ := silentSession()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+		ctx, cancel := context.WithCancel(t.Context())
+
+		done := make(chan error)
+		go func() {
+			_, err := client.Query(ctx, "hi")
+			done <- err
+		}()
+
+		assert.Eventually(t, func() bool { return client.InFlight() == 1 }, time.Second, time.Millisecond)
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+		assert.Zero(t, client.InFlight())
+	})
+
+	t.Run("stream until canceled", func(t *testing.T) {
+		sess, _ := silentSession()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+		ctx, cancel := context.WithCancel(t.Context())
+
+		events, _, err := client.QueryStream(ctx, "", "hi")
+		require.NoError(t, err)
+		assert.Equal(t, 1, client.InFlight())
+
+		cancel()
+		assert.Eventually(t, func() bool { return client.InFlight() == 0 }, time.Second, time.Millisecond)
+		drain(events)
+	})
+
+	t.Run("stream until complete", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return providerSession("s1", "ok", ""), nil
+			},
+		})
+
+		events, _, err := client.QueryStream(t.Context(), "", "hi")
+		require.NoError(t, err)
+		drain(events)
+		assert.Eventually(t, func() bool { return client.InFlight() == 0 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return nil, errors.New("create failed")
+			},
+		})
+
+		_, err := client.Query(t.Context(), "")
+		require.ErrorIs(t, err, ErrEmptyPrompt)
+		_, err = client.Query(t.Context(), "hi")
+		require.Error(t, err)
+		_, _, err = client.QueryStream(t.Context(), "", "hi")
+		require.Error(t, err)
+		assert.Zero(t, client.InFlight())
+	})
+}
+
+func TestFirstTokenTimeout_Query(t *testing.T) {
+	t.Run("aborts a silent session", func(t *testing.T) {
+		sess, aborted := silentSession()
+		clk := newFakeClock()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		}, WithFirstTokenTimeout(20*time.Millisecond), withClock(clk))
+
+		_, err := client.Query(t.Context(), "hi")
+
+		require.ErrorIs(t, err, ErrFirstTokenTimeout)
+		assert.Equal(t, http.StatusGatewayTimeout, errorStatus(err))
+		assert.Equal(t, []time.Duration{20 * time.Millisecond}, clk.Waits())
+		<-aborted
+	})
+
+	t.Run("first token disarms the watchdog", func(t *testing.T) {
+		release := make(chan struct{})
+		sess, delivered := heldSession(release)
+		clk := newManualClock()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		}, WithFirstTokenTimeout(20*time.Millisecond), withClock(clk))
+		expireAfter(clk, delivered, release)
+
+		result, err := client.Query(t.Context(), "hi")
+
+		require.NoError(t, err)
+		assert.Equal(t, "hello", result.Content)
+	})
+}
+
+func TestFirstTokenTimeout_Stream(t *testing.T) {
+	t.Run("aborts a silent session", func(t *testing.T) {
+		sess, aborted := silentSession()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		}, WithFirstTokenTimeout(20*time.Millisecond), withClock(newFakeClock()))
+
+		events, _, err := client.QueryStream(t.Context(), "", "hi")
+		require.NoError(t, err)
+
+		var got []StreamEvent
+		for e := range events {
+			got = append(got, e)
+		}
+		require.Len(t, got, 1)
+		require.ErrorIs(t, got[0].Error, ErrFirstTokenTimeout)
+		<-aborted
+	})
+
+	t.Run("first token disarms the watchdog", func(t *testing.T) {
+		release := make(chan struct{})
+		sess, delivered := heldSession(release)
+		clk := newManualClock()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		}, WithFirstTokenTimeout(20*time.Millisecond), withClock(clk))
+		expireAfter(clk, delivered, release)
+
+		events, _, err := client.QueryStream(t.Context(), "", "hi")
+		require.NoError(t, err)
+
+		var last StreamEvent
+		for e := range events {
+			last = e
+		}
+		require.NoError(t, last.Error)
+		assert.True(t, last.IsFinal)
+		assert.Equal(t, "hello", last.Content)
+	})
+}
+
+func TestWithFirstTokenTimeout_Validation(t *testing.T) {
+	_, err := New(WithFirstTokenTimeout(0))
+	require.Error(t, err)
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Run("forwards raw events until idle", func(t *testing.T) {
+		sess := streamSession("sub-sess",
+			copilot.SessionEvent{Type: copilot.AssistantTurnStart},
+			copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("a")}},
+			copilot.SessionEvent{Type: copilot.ToolExecutionStart},
+			copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("a")}},
+			copilot.SessionEvent{Type: copilot.SessionIdle},
+			copilot.SessionEvent{Type: copilot.AssistantTurnStart},
+		)
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+
+		events, sid, err := client.Subscribe(t.Context(), "", "hi")
+		require.NoError(t, err)
+		assert.Equal(t, "sub-sess", sid)
+
+		var types []copilot.SessionEventType
+		for e := range events {
+			types = append(types, e.Type)
+		}
+		assert.Equal(t, []copilot.SessionEventType{
+			copilot.AssistantTurnStart, copilot.AssistantMessageDelta, copilot.ToolExecutionStart,
+			copilot.AssistantMessage, copilot.SessionIdle,
+		}, types)
+	})
+
+	t.Run("closes after a session error", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return providerSession("s1", "", "boom"), nil
+			},
+		})
+
+		events, _, err := client.Subscribe(t.Context(), "", "hi")
+		require.NoError(t, err)
+
+		var got []copilot.SessionEvent
+		for e := range events {
+			got = append(got, e)
+		}
+		require.Len(t, got, 1)
+		assert.Equal(t, copilot.SessionError, got[0].Type)
+		assert.Equal(t, "boom", *got[0].Data.Message)
+	})
+
+	t.Run("cancel closes and aborts", func(t *testing.T) {
+		sess, aborted := silentSession()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		events, _, err := client.Subscribe(ctx, "", "hi")
+		require.NoError(t, err)
+		cancel()
+
+		for range events {
+			t.Fatal("no events expected")
+		}
+		<-aborted
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		client, err := New()
+		require.NoError(t, err)
+
+		_, _, err = client.Subscribe(t.Context(), "", "hi")
+		require.ErrorIs(t, err, ErrNotConnected)
+	})
+}
+
 func TestQueryStream_DeltaWithNilContent(t *testing.T) {
 	sess := &mockSDKSession{id: "stream-nil-delta"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -442,6 +1728,40 @@ func TestClient_Start_Success(t *testing.T) {
 	err := client.Start(t.Context())
 	require.NoError(t, err)
 	assert.True(t, client.IsConnected())
+	assert.Positive(t, client.uptime())
+
+	require.NoError(t, client.Stop())
+	assert.Zero(t, client.uptime())
+}
+
+func TestClient_Start_NonRetryableError(t *testing.T) {
+	errAuth := errors.New("authentication rejected")
+	attempts := 0
+	mock := &mockSDKClient{
+		startFn: func(_ context.Context) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("not ready yet")
+			}
+			return errAuth
+		},
+	}
+
+	c := defaultCfg()
+	c.retryAttempts = 5
+	c.retryDelay = time.Millisecond
+	require.NoError(t, WithStartRetryPredicate(func(err error) bool { return !errors.Is(err, errAuth) })(c))
+
+	client := &Client{cfg: c, sdk: mock}
+
+	err := client.Start(t.Context())
+	require.ErrorIs(t, err, ErrSidecarUnavailable)
+	require.ErrorIs(t, err, errAuth)
+	assert.Equal(t, 2, attempts)
+	assert.False(t, client.IsConnected())
+
+	_, err = New(WithStartRetryPredicate(nil))
+	require.Error(t, err)
 }
 
 func TestClient_Start_SuccesAfterRetries(t *testing.T) {
@@ -498,47 +1818,610 @@ func TestClient_Stop_WithError(t *testing.T) {
 		},
 	}
 
-	client := newTestClient(mock)
-	err := client.Stop()
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "stop failed")
-	assert.False(t, client.IsConnected())
+	client := newTestClient(mock)
+	err := client.Stop()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stop failed")
+	assert.False(t, client.IsConnected())
+}
+
+func TestClient_StopContext(t *testing.T) {
+	t.Run("sdk stop hangs past the deadline", func(t *testing.T) {
+		unblock := make(chan struct{})
+		stopped := make(chan struct{})
+		client := newTestClient(&mockSDKClient{stopFn: func() error {
+			defer close(stopped)
+			<-unblock
+			return nil
+		}})
+
+		ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+		defer cancel()
+		err := client.StopContext(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, client.IsConnected())
+		require.NoError(t, client.StopContext(t.Context()), "already stopped")
+
+		close(unblock)
+		<-stopped
+	})
+
+	t.Run("sdk stop completes in time", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{stopFn: func() error { return errors.New("stop failed") }})
+
+		err := client.StopContext(t.Context())
+		require.EqualError(t, err, "stop failed")
+		assert.False(t, client.IsConnected())
+	})
+}
+
+func TestClient_StopStrict(t *testing.T) {
+	t.Run("never started", func(t *testing.T) {
+		client, err := New()
+		require.NoError(t, err)
+
+		require.ErrorIs(t, client.StopStrict(), ErrAlreadyStopped)
+		require.NoError(t, client.Stop(), "Stop keeps returning nil")
+	})
+
+	t.Run("running, stopped, restarted", func(t *testing.T) {
+		var stops atomic.Int32
+		mock := &mockSDKClient{stopFn: func() error {
+			stops.Add(1)
+			return nil
+		}}
+		client := newTestClient(mock)
+
+		require.NoError(t, client.StopStrict())
+		require.ErrorIs(t, client.StopStrict(), ErrAlreadyStopped)
+		require.NoError(t, client.Start(t.Context()))
+		require.NoError(t, client.StopStrict())
+		assert.Equal(t, int32(2), stops.Load())
+	})
+
+	t.Run("concurrent calls stop once", func(t *testing.T) {
+		var stops atomic.Int32
+		mock := &mockSDKClient{stopFn: func() error {
+			stops.Add(1)
+			return nil
+		}}
+		client := newTestClient(mock)
+
+		var (
+			wg        sync.WaitGroup
+			succeeded atomic.Int32
+		)
+		for range 8 {
+			wg.Go(func() {
+				if err := client.StopStrict(); err == nil {
+					succeeded.Add(1)
+				} else {
+					assert.ErrorIs(t, err, ErrAlreadyStopped)
+				}
+			})
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), succeeded.Load())
+		assert.Equal(t, int32(1), stops.Load())
+	})
+
+	t.Run("sdk error is returned", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{stopFn: func() error { return errors.New("stop failed") }})
+
+		err := client.StopStrict()
+		require.Error(t, err)
+		require.NotErrorIs(t, err, ErrAlreadyStopped)
+		assert.False(t, client.IsConnected())
+	})
+}
+
+func TestWithShutdownContext_StopsOnCancel(t *testing.T) {
+	var stops atomic.Int32
+	mock := &mockSDKClient{
+		stopFn: func() error {
+			stops.Add(1)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	c := defaultCfg()
+	require.NoError(t, WithShutdownContext(ctx)(c))
+	client := newClient(c, mock)
+
+	require.NoError(t, client.Start(t.Context()))
+	assert.True(t, client.IsConnected())
+
+	cancel()
+	require.Eventually(t, func() bool { return !client.IsConnected() }, time.Second, time.Millisecond)
+
+	// A later manual Stop is a no-op.
+	require.NoError(t, client.Stop())
+	assert.Equal(t, int32(1), stops.Load())
+}
+
+func TestWithShutdownContext_ManualStopFirst(t *testing.T) {
+	var stops atomic.Int32
+	mock := &mockSDKClient{
+		stopFn: func() error {
+			stops.Add(1)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	c := defaultCfg()
+	require.NoError(t, WithShutdownContext(ctx)(c))
+	client := newClient(c, mock)
+
+	require.NoError(t, client.Start(t.Context()))
+	require.NoError(t, client.Stop())
+	assert.Nil(t, client.shutdownDone)
+
+	// The watcher is gone, so canceling later does not stop again.
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(1), stops.Load())
+}
+
+// ---------------------------------------------------------------------------
+// Ping — connected path
+// ---------------------------------------------------------------------------
+
+func TestClient_Ping_Success(t *testing.T) {
+	mock := &mockSDKClient{
+		pingFn: func(_ context.Context, _ string) (*copilot.PingResponse, error) {
+			return &copilot.PingResponse{Message: "pong"}, nil
+		},
+	}
+
+	client := newTestClient(mock)
+	err := client.Ping(t.Context())
+	assert.NoError(t, err)
+}
+
+func TestClient_PingMessage(t *testing.T) {
+	var got string
+	mock := &mockSDKClient{
+		pingFn: func(_ context.Context, message string) (*copilot.PingResponse, error) {
+			got = message
+			return &copilot.PingResponse{Message: message}, nil
+		},
+	}
+
+	client := newTestClient(mock)
+	require.NoError(t, client.PingMessage(t.Context(), "are you there?"))
+	assert.Equal(t, "are you there?", got)
+
+	require.NoError(t, client.Ping(t.Context()))
+	assert.Equal(t, "health", got)
+}
+
+func TestClient_Ping_Timeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	mock := &mockSDKClient{
+		pingFn: func(_ context.Context, _ string) (*copilot.PingResponse, error) {
+			<-unblock // a hung sidecar that ignores the context
+			return &copilot.PingResponse{}, nil
+		},
+	}
+
+	client := newTestClient(mock, WithPingTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	err := client.Ping(t.Context())
+	require.ErrorIs(t, err, ErrPingTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	err = client.Ping(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrPingTimeout)
+
+	handler := NewHealthHandler(client)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "did not answer ping")
+}
+
+func TestWithPingTimeout_Validation(t *testing.T) {
+	_, err := New(WithPingTimeout(0))
+	require.Error(t, err)
+}
+
+// ---------------------------------------------------------------------------
+// DestroySession — connected path
+// ---------------------------------------------------------------------------
+
+func TestClient_DestroySession_Success(t *testing.T) {
+	deleted := ""
+	mock := &mockSDKClient{
+		deleteFn: func(_ context.Context, sessionID string) error {
+			deleted = sessionID
+			return nil
+		},
+	}
+
+	client := newTestClient(mock)
+	err := client.DestroySession(t.Context(), "sess-to-delete")
+
+	require.NoError(t, err)
+	assert.Equal(t, "sess-to-delete", deleted)
+}
+
+// ---------------------------------------------------------------------------
+// ResetSession
+// ---------------------------------------------------------------------------
+
+func TestClient_ResetSession(t *testing.T) {
+	var calls []string
+	var created *copilot.SessionConfig
+	mock := &mockSDKClient{
+		deleteFn: func(_ context.Context, sessionID string) error {
+			calls = append(calls, "delete:"+sessionID)
+			return nil
+		},
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			calls = append(calls, "create:"+cfg.SessionID)
+			created = cfg
+			return &mockSDKSession{id: cfg.SessionID}, nil
+		},
+	}
+	client := newTestClient(mock,
+		WithModel("gpt-5"),
+		WithBYOK(ProviderOpenAI, "https://api.openai.com/v1", "sk-test"),
+		WithTools(ToolDefinition{Name: "t1", Handler: func(map[string]any) (string, error) { return "", nil }}),
+	)
+
+	require.NoError(t, client.ResetSession(t.Context(), "kiosk-1"))
+
+	assert.Equal(t, []string{"delete:kiosk-1", "create:kiosk-1"}, calls)
+	require.NotNil(t, created)
+	assert.Equal(t, "gpt-5", created.Model)
+	require.NotNil(t, created.Provider)
+	assert.Equal(t, "https://api.openai.com/v1", created.Provider.BaseURL)
+	require.Len(t, created.Tools, 1)
+	assert.Contains(t, client.sessions, "kiosk-1")
+}
+
+func TestClient_ResetSession_Errors(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	t.Run("empty session ID", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{})
+		require.ErrorIs(t, client.ResetSession(t.Context(), ""), ErrEmptySessionID)
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{})
+		client.connected = false
+		require.ErrorIs(t, client.ResetSession(t.Context(), "s1"), ErrNotConnected)
+	})
+
+	t.Run("delete fails", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{
+			deleteFn: func(context.Context, string) error { return errBoom },
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				t.Fatal("session should not be recreated")
+				return nil, nil
+			},
+		})
+		err := client.ResetSession(t.Context(), "s1")
+		require.ErrorIs(t, err, errBoom)
+		assert.Contains(t, err.Error(), "deleting session")
+	})
+
+	t.Run("create fails", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return nil, errBoom },
+		})
+		err := client.ResetSession(t.Context(), "s1")
+		require.ErrorIs(t, err, errBoom)
+		assert.Contains(t, err.Error(), "recreating session")
+	})
+}
+
+// ---------------------------------------------------------------------------
+// DestroyAllSessions
+// ---------------------------------------------------------------------------
+
+func TestClient_DestroyAllSessions(t *testing.T) {
+	var created atomic.Int32
+	var mu sync.Mutex
+	var deleted []string
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return &mockSDKSession{id: fmt.Sprintf("sess-%d", created.Add(1))}, nil
+		},
+		deleteFn: func(_ context.Context, sessionID string) error {
+			mu.Lock()
+			deleted = append(deleted, sessionID)
+			mu.Unlock()
+			return nil
+		},
+	}
+	client := newTestClient(mock)
+
+	for range 3 {
+		_, err := client.getOrCreateSession(t.Context(), "", "")
+		require.NoError(t, err)
+	}
+	require.NoError(t, client.DestroySession(t.Context(), "sess-2"))
+
+	require.NoError(t, client.DestroyAllSessions(t.Context()))
+	assert.ElementsMatch(t, []string{"sess-2", "sess-1", "sess-3"}, deleted)
+	assert.Empty(t, client.sessions)
+
+	// Nothing left to destroy.
+	deleted = nil
+	require.NoError(t, client.DestroyAllSessions(t.Context()))
+	assert.Empty(t, deleted)
+}
+
+func TestClient_DestroyAllSessions_JoinsErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+	mock := &mockSDKClient{
+		deleteFn: func(_ context.Context, sessionID string) error {
+			if sessionID == "sess-ok" {
+				return nil
+			}
+			return errBoom
+		},
+	}
+	client := newTestClient(mock)
+	client.trackSession("sess-ok")
+	client.trackSession("sess-bad-1")
+	client.trackSession("sess-bad-2")
+
+	err := client.DestroyAllSessions(t.Context())
+	require.ErrorIs(t, err, errBoom)
+	assert.Contains(t, err.Error(), "sess-bad-1")
+	assert.Contains(t, err.Error(), "sess-bad-2")
+
+	// Failed sessions stay tracked for a retry.
+	assert.Len(t, client.sessions, 2)
+	assert.NotContains(t, client.sessions, "sess-ok")
+}
+
+func TestClient_DestroyAllSessions_NoSessions(t *testing.T) {
+	client := newTestClient(&mockSDKClient{
+		deleteFn: func(_ context.Context, _ string) error {
+			t.Fatal("DeleteSession should not be called")
+			return nil
+		},
+	})
+
+	require.NoError(t, client.DestroyAllSessions(t.Context()))
+}
+
+// ---------------------------------------------------------------------------
+// ListModels
+// ---------------------------------------------------------------------------
+
+func TestClient_ListModels(t *testing.T) {
+	mock := &mockSDKClient{
+		modelsFn: func(_ context.Context) ([]copilot.ModelInfo, error) {
+			return []copilot.ModelInfo{
+				{
+					ID:   "gpt-5",
+					Name: "GPT-5",
+					Capabilities: copilot.ModelCapabilities{
+						Supports: copilot.ModelSupports{Vision: true, ReasoningEffort: true},
+						Limits: copilot.ModelLimits{
+							MaxContextWindowTokens: 400000,
+							MaxPromptTokens:        ptr(272000),
+						},
+					},
+				},
+				{ID: "gpt-4o", Name: "GPT-4o"},
+			}, nil
+		},
+	}
+
+	client := newTestClient(mock)
+	models, err := client.ListModels(t.Context())
+
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.Equal(t, ModelInfo{
+		ID:                      "gpt-5",
+		Name:                    "GPT-5",
+		ContextWindow:           400000,
+		MaxPromptTokens:         272000,
+		SupportsVision:          true,
+		SupportsReasoningEffort: true,
+	}, models[0])
+	assert.Equal(t, "gpt-4o", models[1].ID)
+	assert.Zero(t, models[1].MaxPromptTokens)
+}
+
+func TestClient_ListModels_Errors(t *testing.T) {
+	t.Run("not connected", func(t *testing.T) {
+		client := &Client{cfg: defaultCfg(), sdk: &mockSDKClient{}}
+		_, err := client.ListModels(t.Context())
+		require.ErrorIs(t, err, ErrNotConnected)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		mock := &mockSDKClient{
+			modelsFn: func(_ context.Context) ([]copilot.ModelInfo, error) {
+				return nil, fmt.Errorf("%w: method not found", ErrUnsupported)
+			},
+		}
+		client := newTestClient(mock)
+		_, err := client.ListModels(t.Context())
+		require.ErrorIs(t, err, ErrUnsupported)
+	})
+}
+
+func TestIsMethodNotFound(t *testing.T) {
+	assert.True(t, isMethodNotFound(fmt.Errorf("JSON-RPC Error -32601: Method not found: models.list")))
+	assert.False(t, isMethodNotFound(fmt.Errorf("JSON-RPC Error -32603: internal error")))
+}
+
+func TestIsSessionNotFound(t *testing.T) {
+	assert.True(t, isSessionNotFound(fmt.Errorf("JSON-RPC Error -32603: Session not found: abc")))
+	assert.False(t, isSessionNotFound(fmt.Errorf("JSON-RPC Error -32601: Method not found: session.resume")))
+	assert.False(t, isSessionNotFound(fmt.Errorf("connection reset")))
+}
+
+func TestGetOrCreateSession_AutoRecreate(t *testing.T) {
+	notFound := fmt.Errorf("%w: session gone", ErrSessionNotFound)
+	newMock := func() *mockSDKClient {
+		return &mockSDKClient{
+			resumeFn: func(context.Context, string, *copilot.ResumeSessionConfig) (SDKSession, error) {
+				return nil, notFound
+			},
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return &mockSDKSession{id: "fresh"}, nil
+			},
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		client := newTestClient(newMock())
+		_, err := client.getOrCreateSession(t.Context(), "evicted", "")
+		require.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		client := newTestClient(newMock(), WithAutoRecreateSession(true))
+		sess, err := client.getOrCreateSession(t.Context(), "evicted", "")
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", sess.ID())
+		assert.Contains(t, client.sessions, "fresh")
+	})
+
+	t.Run("other resume errors still fail", func(t *testing.T) {
+		mock := newMock()
+		mock.resumeFn = func(context.Context, string, *copilot.ResumeSessionConfig) (SDKSession, error) {
+			return nil, errors.New("connection reset")
+		}
+		client := newTestClient(mock, WithAutoRecreateSession(true))
+		_, err := client.getOrCreateSession(t.Context(), "s1", "")
+		require.EqualError(t, err, "connection reset")
+	})
 }
 
 // ---------------------------------------------------------------------------
-// Ping — connected path
+// CreateSession
 // ---------------------------------------------------------------------------
 
-func TestClient_Ping_Success(t *testing.T) {
-	mock := &mockSDKClient{
-		pingFn: func(_ context.Context, _ string) (*copilot.PingResponse, error) {
-			return &copilot.PingResponse{Message: "pong"}, nil
-		},
-	}
-
-	client := newTestClient(mock)
-	err := client.Ping(t.Context())
-	assert.NoError(t, err)
+func TestClient_CreateSession(t *testing.T) {
+	t.Run("creates without sending and is reused", func(t *testing.T) {
+		sess := streamSession("warm",
+			copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("hi there")}},
+			copilot.SessionEvent{Type: copilot.SessionIdle},
+		)
+		var (
+			created   *copilot.SessionConfig
+			resumedID string
+		)
+		mock := &mockSDKClient{
+			createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+				created = cfg
+				return &mockSDKSession{id: "warm", sendFn: func(context.Context, copilot.MessageOptions) (string, error) {
+					t.Error("CreateSession must not send a message")
+					return "", nil
+				}}, nil
+			},
+			resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+				resumedID = sessionID
+				return sess, nil
+			},
+		}
+		client := newTestClient(mock, WithModel("gpt-5"), WithSystemMessage("Be brief."), WithTools(
+			ToolDefinition{Name: "lookup", Handler: func(map[string]any) (string, error) { return "", nil }},
+		))
+
+		id, err := client.CreateSession(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "warm", id)
+		require.NotNil(t, created)
+		assert.Equal(t, "gpt-5", created.Model)
+		require.Len(t, created.Tools, 1)
+		require.NotNil(t, created.SystemMessage)
+		assert.Equal(t, "Be brief.", created.SystemMessage.Content)
+		client.sessionsMu.Lock()
+		assert.Contains(t, client.sessions, "warm")
+		client.sessionsMu.Unlock()
+
+		result, err := client.QueryWithSession(t.Context(), id, "hello")
+		require.NoError(t, err)
+		assert.Equal(t, "warm", resumedID)
+		assert.Equal(t, "hi there", result.Content)
+	})
+
+	t.Run("reports creation failure", func(t *testing.T) {
+		mock := &mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return nil, errors.New("quota exceeded")
+			},
+		}
+		_, err := newTestClient(mock).CreateSession(t.Context())
+		require.EqualError(t, err, "session setup: quota exceeded")
+	})
+
+	t.Run("requires connection", func(t *testing.T) {
+		client := &Client{cfg: defaultCfg(), sdk: &mockSDKClient{}}
+		_, err := client.CreateSession(t.Context())
+		require.ErrorIs(t, err, ErrNotConnected)
+	})
 }
 
 // ---------------------------------------------------------------------------
-// DestroySession — connected path
+// TouchSession
 // ---------------------------------------------------------------------------
 
-func TestClient_DestroySession_Success(t *testing.T) {
-	deleted := ""
-	mock := &mockSDKClient{
-		deleteFn: func(_ context.Context, sessionID string) error {
-			deleted = sessionID
-			return nil
-		},
-	}
+func TestClient_TouchSession(t *testing.T) {
+	t.Run("resumes without sending", func(t *testing.T) {
+		sess := &mockSDKSession{id: "alive"}
+		sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+			t.Error("TouchSession must not send a message")
+			return "", nil
+		}
 
-	client := newTestClient(mock)
-	err := client.DestroySession(t.Context(), "sess-to-delete")
+		var resumedID string
+		var resumeCfg *copilot.ResumeSessionConfig
+		mock := &mockSDKClient{
+			resumeFn: func(_ context.Context, sessionID string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
+				resumedID = sessionID
+				resumeCfg = cfg
+				return sess, nil
+			},
+		}
 
-	require.NoError(t, err)
-	assert.Equal(t, "sess-to-delete", deleted)
+		client := newTestClient(mock, WithModel("gpt-5"))
+		require.NoError(t, client.TouchSession(t.Context(), "alive"))
+		assert.Equal(t, "alive", resumedID)
+		assert.Equal(t, "gpt-5", resumeCfg.Model)
+	})
+
+	t.Run("reports resume failure", func(t *testing.T) {
+		mock := &mockSDKClient{
+			resumeFn: func(_ context.Context, _ string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+				return nil, fmt.Errorf("session not found")
+			},
+		}
+
+		err := newTestClient(mock).TouchSession(t.Context(), "gone")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "session not found")
+	})
+
+	t.Run("rejects empty session ID", func(t *testing.T) {
+		err := newTestClient(&mockSDKClient{}).TouchSession(t.Context(), "")
+		require.ErrorIs(t, err, ErrEmptySessionID)
+	})
+
+	t.Run("requires connection", func(t *testing.T) {
+		client := &Client{cfg: defaultCfg(), sdk: &mockSDKClient{}}
+		require.ErrorIs(t, client.TouchSession(t.Context(), "x"), ErrNotConnected)
+	})
 }
 
 // ---------------------------------------------------------------------------
@@ -575,7 +2458,7 @@ func TestNewHealthHandler_Healthy(t *testing.T) {
 func TestNewQueryHandler_Success(t *testing.T) {
 	sess := &mockSDKSession{id: "handler-sess"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -612,7 +2495,7 @@ func TestNewQueryHandler_Success(t *testing.T) {
 func TestNewQueryHandler_WithSessionID(t *testing.T) {
 	sess := &mockSDKSession{id: "existing-handler-sess"}
 	mock := &mockSDKClient{
-		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (sdkSession, error) {
+		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
 			assert.Equal(t, "existing-handler-sess", sessionID)
 			return sess, nil
 		},
@@ -653,7 +2536,7 @@ func TestNewQueryHandler_WithSessionID(t *testing.T) {
 func TestNewStreamHandler_SuccessfulStream(t *testing.T) {
 	sess := &mockSDKSession{id: "sse-sess"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -694,12 +2577,61 @@ func TestNewStreamHandler_SuccessfulStream(t *testing.T) {
 	assert.Contains(t, sseBody, `"delta":"chunk2"`)
 	assert.Contains(t, sseBody, `"final":true`)
 	assert.Contains(t, sseBody, `"content":"chunk1chunk2"`)
+	assert.Contains(t, sseBody, `"chunk_count":2`)
+	assert.Contains(t, sseBody, `"elapsed_ms":`)
+}
+
+func TestNewStreamHandler_OpenEventPrecedesDeltas(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return streamSession("sse-open",
+				copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("hi")}},
+				copilot.SessionEvent{Type: copilot.SessionIdle},
+			), nil
+		},
+	}
+	handler := NewStreamHandler(newTestClient(mock))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/copilot/stream", strings.NewReader(testPromptBody))
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Body.String(),
+		"id: sse-open:0\nevent: open\ndata: {\"session_id\":\"sse-open\"}\n\n"+
+			"id: sse-open:1\ndata: {\"delta\":\"hi\""), rec.Body.String())
+}
+
+func TestNewStreamHandler_LastEventIDResumesSession(t *testing.T) {
+	var resumed string
+	mock := &mockSDKClient{
+		resumeFn: func(_ context.Context, id string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+			resumed = id
+			return streamSession(id,
+				copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("again")}},
+				copilot.SessionEvent{Type: copilot.SessionIdle},
+			), nil
+		},
+	}
+	handler := NewStreamHandler(newTestClient(mock))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/copilot/stream", bytes.NewReader([]byte(`{"prompt": "go on"}`)))
+	req.Header.Set("Last-Event-ID", "sse-sess:4")
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "sse-sess", resumed)
+	assert.Contains(t, rec.Body.String(), "id: sse-sess:1\ndata: {\"delta\":\"again\"")
+	assert.Contains(t, rec.Body.String(), "id: sse-sess:2\n")
 }
 
 func TestNewStreamHandler_ErrorEvent(t *testing.T) {
 	sess := &mockSDKSession{id: "sse-err-sess"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -729,10 +2661,134 @@ func TestNewStreamHandler_ErrorEvent(t *testing.T) {
 	assert.Contains(t, sseBody, "something broke")
 }
 
+// hangingStreamClient returns a client whose session emits one delta and then
+// never finishes, and a channel that is closed when the session is aborted.
+func hangingStreamClient() (*Client, <-chan struct{}) {
+	aborted := make(chan struct{})
+	sess := streamSession("sse-hang",
+		copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("first")}},
+	)
+	var once sync.Once
+	sess.abortFn = func(context.Context) error {
+		once.Do(func() { close(aborted) })
+		return nil
+	}
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+	})
+	return client, aborted
+}
+
+// cancelOnWrite cancels the request once the response body contains marker.
+type cancelOnWrite struct {
+	*httptest.ResponseRecorder
+	marker string
+	cancel context.CancelFunc
+}
+
+func (w *cancelOnWrite) Write(b []byte) (int, error) {
+	n, err := w.ResponseRecorder.Write(b)
+	if strings.Contains(string(b), w.marker) {
+		w.cancel()
+	}
+	return n, err
+}
+
+func TestNewStreamHandler_ClientDisconnect(t *testing.T) {
+	client, aborted := hangingStreamClient()
+	handler := NewStreamHandler(client)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/api/copilot/stream", strings.NewReader(testPromptBody))
+	rec := &cancelOnWrite{ResponseRecorder: httptest.NewRecorder(), marker: "first", cancel: cancel}
+
+	done := make(chan struct{})
+	go func() {
+		handler(rec, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler did not return after the client disconnected")
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("session was not aborted")
+	}
+	assert.NotContains(t, rec.Body.String(), `"final"`)
+}
+
+// brokenStreamWriter accepts headers but fails every body write, like a
+// connection that died without the request context noticing yet.
+type brokenStreamWriter struct {
+	header http.Header
+}
+
+func (w *brokenStreamWriter) Header() http.Header       { return w.header }
+func (w *brokenStreamWriter) WriteHeader(int)           {}
+func (w *brokenStreamWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+func (w *brokenStreamWriter) Flush()                    {}
+
+func TestNewStreamHandler_WriteErrorAbortsSession(t *testing.T) {
+	client, aborted := hangingStreamClient()
+	handler := NewStreamHandler(client)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/copilot/stream", strings.NewReader(testPromptBody))
+	handler(&brokenStreamWriter{header: make(http.Header)}, req)
+
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("session was not aborted after the write failed")
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	t.Run("query handler returns 504", func(t *testing.T) {
+		client, aborted := hangingStreamClient()
+		require.NoError(t, WithHandlerTimeout(30*time.Millisecond)(client.cfg))
+		handler := NewQueryHandler(client)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/copilot/query", strings.NewReader(testPromptBody))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+		select {
+		case <-aborted:
+		case <-time.After(time.Second):
+			t.Fatal("session was not aborted")
+		}
+	})
+
+	t.Run("stream handler ends the stream with an error", func(t *testing.T) {
+		client, aborted := hangingStreamClient()
+		require.NoError(t, WithHandlerTimeout(30*time.Millisecond)(client.cfg))
+		handler := NewStreamHandler(client)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/copilot/stream", strings.NewReader(testPromptBody))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		body := rec.Body.String()
+		assert.Contains(t, body, `"delta":"first"`)
+		assert.Contains(t, body, `data: {"error":"handler timeout exceeded","session_id":"sse-hang"}`)
+		select {
+		case <-aborted:
+		case <-time.After(time.Second):
+			t.Fatal("session was not aborted")
+		}
+	})
+}
+
 func TestNewStreamHandler_WithSessionID(t *testing.T) {
 	sess := &mockSDKSession{id: "sse-resume"}
 	mock := &mockSDKClient{
-		resumeFn: func(_ context.Context, _ string, _ *copilot.ResumeSessionConfig) (sdkSession, error) {
+		resumeFn: func(_ context.Context, _ string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -772,7 +2828,7 @@ func TestGetOrCreateSession_CreateWithTools(t *testing.T) {
 	var capturedConfig *copilot.SessionConfig
 
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
 			capturedConfig = cfg
 			return expectedSess, nil
 		},
@@ -785,7 +2841,7 @@ func TestGetOrCreateSession_CreateWithTools(t *testing.T) {
 	}
 
 	client := newTestClient(mock, WithTools(tool), WithStreaming(true), WithModel("gpt-5"))
-	sess, err := client.getOrCreateSession(t.Context(), "")
+	sess, err := client.getOrCreateSession(t.Context(), "", "")
 
 	require.NoError(t, err)
 	assert.Equal(t, "tools-sess", sess.ID())
@@ -801,7 +2857,7 @@ func TestGetOrCreateSession_ResumeWithBYOK(t *testing.T) {
 	var capturedConfig *copilot.ResumeSessionConfig
 
 	mock := &mockSDKClient{
-		resumeFn: func(_ context.Context, _ string, cfg *copilot.ResumeSessionConfig) (sdkSession, error) {
+		resumeFn: func(_ context.Context, _ string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
 			capturedConfig = cfg
 			return expectedSess, nil
 		},
@@ -812,7 +2868,7 @@ func TestGetOrCreateSession_ResumeWithBYOK(t *testing.T) {
 		WithAzureAPIVersion("2024-10-21"),
 		WithSystemMessage("You help."),
 	)
-	sess, err := client.getOrCreateSession(t.Context(), "existing")
+	sess, err := client.getOrCreateSession(t.Context(), "existing", "")
 
 	require.NoError(t, err)
 	assert.Equal(t, "byok-sess", sess.ID())
@@ -828,14 +2884,14 @@ func TestGetOrCreateSession_ResumeWithoutBYOK(t *testing.T) {
 	var capturedConfig *copilot.ResumeSessionConfig
 
 	mock := &mockSDKClient{
-		resumeFn: func(_ context.Context, _ string, cfg *copilot.ResumeSessionConfig) (sdkSession, error) {
+		resumeFn: func(_ context.Context, _ string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
 			capturedConfig = cfg
 			return expectedSess, nil
 		},
 	}
 
 	client := newTestClient(mock) // default GitHub auth
-	sess, err := client.getOrCreateSession(t.Context(), "resume-id")
+	sess, err := client.getOrCreateSession(t.Context(), "resume-id", "")
 
 	require.NoError(t, err)
 	assert.Equal(t, "gh-sess", sess.ID())
@@ -844,6 +2900,120 @@ func TestGetOrCreateSession_ResumeWithoutBYOK(t *testing.T) {
 	assert.Nil(t, capturedConfig.SystemMessage)
 }
 
+func TestGetOrCreateSession_ConfigHooks(t *testing.T) {
+	var (
+		created *copilot.SessionConfig
+		resumed *copilot.ResumeSessionConfig
+	)
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			created = cfg
+			return &mockSDKSession{id: "new"}, nil
+		},
+		resumeFn: func(_ context.Context, id string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
+			resumed = cfg
+			return &mockSDKSession{id: id}, nil
+		},
+	}
+	client := newTestClient(mock,
+		WithModel("gpt-4o"),
+		WithSessionConfigHook(func(cfg *copilot.SessionConfig) {
+			cfg.ReasoningEffort = "high"
+			cfg.Model += "-mini"
+		}),
+		WithSessionConfigHook(func(cfg *copilot.SessionConfig) { cfg.WorkingDirectory = "/srv/" + cfg.Model }),
+		WithResumeConfigHook(func(cfg *copilot.ResumeSessionConfig) { cfg.Streaming = false }),
+		WithStreaming(true),
+	)
+
+	_, err := client.getOrCreateSession(t.Context(), "", "gpt-5")
+	require.NoError(t, err)
+	require.NotNil(t, created)
+	assert.Equal(t, "high", created.ReasoningEffort)
+	assert.Equal(t, "gpt-5-mini", created.Model, "hooks run after the per-query model override")
+	assert.Equal(t, "/srv/gpt-5-mini", created.WorkingDirectory, "hooks run in registration order")
+
+	_, err = client.getOrCreateSession(t.Context(), "existing", "")
+	require.NoError(t, err)
+	require.NotNil(t, resumed)
+	assert.False(t, resumed.Streaming)
+
+	_, err = New(WithSessionConfigHook(nil))
+	require.Error(t, err)
+	_, err = New(WithResumeConfigHook(nil))
+	require.Error(t, err)
+}
+
+func TestGetOrCreateSession_ToolChoice(t *testing.T) {
+	search := ToolDefinition{Name: "search", Handler: func(_ map[string]any) (string, error) { return "", nil }}
+	fetch := ToolDefinition{Name: "fetch", Handler: func(_ map[string]any) (string, error) { return "", nil }}
+
+	tests := []struct {
+		name          string
+		choice        string
+		wantTools     int
+		wantAvailable []string
+	}{
+		{name: "auto", choice: ToolChoiceAuto, wantTools: 2},
+		{name: "none", choice: ToolChoiceNone, wantTools: 0, wantAvailable: []string{noToolsAllowed}},
+		{name: "required", choice: ToolChoiceRequired, wantTools: 2, wantAvailable: []string{"search", "fetch"}},
+		{name: "named tool", choice: "fetch", wantTools: 2, wantAvailable: []string{"fetch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *copilot.SessionConfig
+			var resumed *copilot.ResumeSessionConfig
+			mock := &mockSDKClient{
+				createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+					created = cfg
+					return &mockSDKSession{id: "new"}, nil
+				},
+				resumeFn: func(_ context.Context, _ string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
+					resumed = cfg
+					return &mockSDKSession{id: "old"}, nil
+				},
+			}
+
+			client := newTestClient(mock, WithTools(search, fetch), WithToolChoice(tt.choice))
+
+			_, err := client.getOrCreateSession(t.Context(), "", "")
+			require.NoError(t, err)
+			assert.Len(t, created.Tools, tt.wantTools)
+			assert.Equal(t, tt.wantAvailable, created.AvailableTools)
+
+			_, err = client.getOrCreateSession(t.Context(), "old", "")
+			require.NoError(t, err)
+			assert.Len(t, resumed.Tools, tt.wantTools)
+			assert.Equal(t, tt.wantAvailable, resumed.AvailableTools)
+		})
+	}
+}
+
+func TestGetOrCreateSession_ToolChoiceRequiredWithoutTools(t *testing.T) {
+	var calls int
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			calls++
+			return &mockSDKSession{id: "new"}, nil
+		},
+		resumeFn: func(context.Context, string, *copilot.ResumeSessionConfig) (SDKSession, error) {
+			calls++
+			return &mockSDKSession{id: "old"}, nil
+		},
+	}
+	search := ToolDefinition{Name: "search", Handler: func(_ map[string]any) (string, error) { return "", nil }}
+	client := newTestClient(mock, WithTools(search), WithToolChoice(ToolChoiceRequired))
+	// An empty allow-list would let the session use every built-in tool.
+	client.cfg.tools = nil
+
+	_, err := client.getOrCreateSession(t.Context(), "", "")
+	require.ErrorIs(t, err, ErrUnknownToolChoice)
+	_, err = client.getOrCreateSession(t.Context(), "old", "")
+	require.ErrorIs(t, err, ErrUnknownToolChoice)
+	assert.Zero(t, calls, "no session is opened")
+}
+
 // ---------------------------------------------------------------------------
 // Query (convenience wrapper)
 // ---------------------------------------------------------------------------
@@ -851,7 +3021,7 @@ func TestGetOrCreateSession_ResumeWithoutBYOK(t *testing.T) {
 func TestQuery_DelegatesToQueryWithSession(t *testing.T) {
 	sess := &mockSDKSession{id: "query-sess"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -882,7 +3052,7 @@ func TestQuery_DelegatesToQueryWithSession(t *testing.T) {
 func TestNewQueryHandler_ErrSidecarUnavailable(t *testing.T) {
 	sess := &mockSDKSession{id: "sidecar-sess"}
 	mock := &mockSDKClient{
-		createFn: func(_ context.Context, _ *copilot.SessionConfig) (sdkSession, error) {
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
 			return sess, nil
 		},
 	}
@@ -941,7 +3111,8 @@ func TestBuildSessionConfig_WithAllOptions(t *testing.T) {
 		WithTools(tool),
 	)
 
-	sc := client.buildSessionConfig()
+	sc, err := client.buildSessionConfig("")
+	require.NoError(t, err)
 
 	assert.Equal(t, "gpt-5", sc.Model)
 	assert.True(t, sc.Streaming)
@@ -951,3 +3122,330 @@ func TestBuildSessionConfig_WithAllOptions(t *testing.T) {
 	assert.Equal(t, "anthropic", sc.Provider.Type)
 	require.Len(t, sc.Tools, 1)
 }
+
+// ---------------------------------------------------------------------------
+// RegisterTool / UnregisterTool — dynamic tool registry
+// ---------------------------------------------------------------------------
+
+func TestClient_RegisterTool(t *testing.T) {
+	var capturedConfig *copilot.SessionConfig
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			capturedConfig = cfg
+			return &mockSDKSession{id: "dyn-sess"}, nil
+		},
+	}
+
+	base := ToolDefinition{Name: "base", Handler: func(_ map[string]any) (string, error) { return "", nil }}
+	extra := ToolDefinition{Name: "extra", Handler: func(_ map[string]any) (string, error) { return "", nil }}
+
+	client := newTestClient(mock, WithTools(base))
+
+	require.NoError(t, client.RegisterTool(extra))
+	_, err := client.getOrCreateSession(t.Context(), "", "")
+	require.NoError(t, err)
+	require.Len(t, capturedConfig.Tools, 2)
+	assert.Equal(t, "extra", capturedConfig.Tools[1].Name)
+
+	err = client.RegisterTool(extra)
+	require.ErrorIs(t, err, ErrDuplicateTool)
+
+	removed, err := client.UnregisterTool("base")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = client.UnregisterTool("base")
+	require.NoError(t, err)
+	assert.False(t, removed)
+	_, err = client.getOrCreateSession(t.Context(), "", "")
+	require.NoError(t, err)
+	require.Len(t, capturedConfig.Tools, 1)
+	assert.Equal(t, "extra", capturedConfig.Tools[0].Name)
+}
+
+func TestClient_UnregisterTool_ToolChoice(t *testing.T) {
+	handler := func(_ map[string]any) (string, error) { return "", nil }
+	search := ToolDefinition{Name: "search", Handler: handler}
+	fetch := ToolDefinition{Name: "fetch", Handler: handler}
+
+	t.Run("last tool under required", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{}, WithTools(search, fetch), WithToolChoice(ToolChoiceRequired))
+
+		removed, err := client.UnregisterTool("search")
+		require.NoError(t, err)
+		assert.True(t, removed)
+
+		removed, err = client.UnregisterTool("fetch")
+		require.ErrorIs(t, err, ErrUnknownToolChoice)
+		assert.False(t, removed)
+		tools, available, err := client.sessionTools()
+		require.NoError(t, err)
+		assert.Len(t, tools, 1)
+		assert.Equal(t, []string{"fetch"}, available)
+	})
+
+	t.Run("named tool", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{}, WithTools(search, fetch), WithToolChoice("fetch"))
+
+		removed, err := client.UnregisterTool("fetch")
+		require.ErrorIs(t, err, ErrUnknownToolChoice)
+		assert.False(t, removed)
+
+		removed, err = client.UnregisterTool("search")
+		require.NoError(t, err)
+		assert.True(t, removed)
+		tools, _, err := client.sessionTools()
+		require.NoError(t, err)
+		require.Len(t, tools, 1)
+		assert.Equal(t, "fetch", tools[0].Name)
+	})
+}
+
+func TestClient_RegisterTool_EmptyName(t *testing.T) {
+	client := newTestClient(&mockSDKClient{})
+	err := client.RegisterTool(ToolDefinition{})
+	require.Error(t, err)
+}
+
+// ---------------------------------------------------------------------------
+// WithMaxConcurrentSessions
+// ---------------------------------------------------------------------------
+
+func TestClient_MaxConcurrentSessions(t *testing.T) {
+	var (
+		created  = make(chan *mockSDKSession, 2)
+		sessions atomic.Int32
+	)
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			sess := &mockSDKSession{id: fmt.Sprintf("slot-%d", sessions.Add(1))}
+			created <- sess
+			return sess, nil
+		},
+	}
+
+	client := newTestClient(mock, WithMaxConcurrentSessions(1))
+
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := client.Query(t.Context(), "first")
+		firstDone <- err
+	}()
+	first := <-created
+
+	secondDone := make(chan error, 1)
+	go func() {
+		_, err := client.Query(t.Context(), "second")
+		secondDone <- err
+	}()
+
+	// The second query must wait for the first to release its slot.
+	select {
+	case <-created:
+		t.Fatal("second session was created while the limit was reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+	require.NoError(t, <-firstDone)
+
+	second := <-created
+	second.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+	require.NoError(t, <-secondDone)
+}
+
+func TestClient_MaxConcurrentSessions_Timeout(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return &mockSDKSession{id: "held"}, nil
+		},
+	}
+
+	client := newTestClient(mock, WithMaxConcurrentSessions(1))
+
+	// Hold the only slot with a stream that never completes.
+	_, _, err := client.QueryStream(t.Context(), "", "hold")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 30*time.Millisecond)
+	defer cancel()
+
+	_, err = client.Query(ctx, "blocked")
+	require.ErrorIs(t, err, ErrTooManySessions)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// ---------------------------------------------------------------------------
+// WithRawEvents
+// ---------------------------------------------------------------------------
+
+func TestQueryStream_RawEvents(t *testing.T) {
+	emitAll := func(sess *mockSDKSession) {
+		sess.emit(&copilot.SessionEvent{
+			Type: copilot.ToolExecutionStart,
+			Data: copilot.Data{ToolName: ptr("search")},
+		})
+		sess.emit(&copilot.SessionEvent{
+			Type: copilot.AssistantMessageDelta,
+			Data: copilot.Data{DeltaContent: ptr("hi")},
+		})
+		sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+	}
+
+	collect := func(t *testing.T, opts ...Option) []StreamEvent {
+		t.Helper()
+		sess := &mockSDKSession{id: "raw-sess"}
+		sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+			go emitAll(sess)
+			return testMsgID, nil
+		}
+		mock := &mockSDKClient{
+			createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+				return sess, nil
+			},
+		}
+
+		events, _, err := newTestClient(mock, opts...).QueryStream(t.Context(), "", "hi")
+		require.NoError(t, err)
+
+		var out []StreamEvent
+		for evt := range events {
+			out = append(out, evt)
+		}
+		return out
+	}
+
+	t.Run("ignored by default", func(t *testing.T) {
+		out := collect(t)
+		require.Len(t, out, 2)
+		assert.Nil(t, out[0].Raw)
+		assert.Equal(t, "hi", out[0].DeltaContent)
+	})
+
+	t.Run("forwarded when enabled", func(t *testing.T) {
+		out := collect(t, WithRawEvents(true))
+		require.Len(t, out, 3)
+		require.NotNil(t, out[0].Raw)
+		assert.Equal(t, copilot.ToolExecutionStart, out[0].Raw.Type)
+		assert.Equal(t, "search", *out[0].Raw.Data.ToolName)
+		assert.Equal(t, "hi", out[1].DeltaContent)
+		assert.True(t, out[2].IsFinal)
+	})
+}
+
+// ---------------------------------------------------------------------------
+// Reasoning deltas
+// ---------------------------------------------------------------------------
+
+func newReasoningSession() *mockSDKSession {
+	sess := &mockSDKSession{id: "think-sess"}
+	sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+		go func() {
+			sess.emit(&copilot.SessionEvent{
+				Type: copilot.AssistantReasoningDelta,
+				Data: copilot.Data{DeltaContent: ptr("let me think")},
+			})
+			sess.emit(&copilot.SessionEvent{
+				Type: copilot.AssistantMessageDelta,
+				Data: copilot.Data{DeltaContent: ptr("answer")},
+			})
+			sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+		}()
+		return testMsgID, nil
+	}
+	return sess
+}
+
+func TestQueryStream_ReasoningDeltas(t *testing.T) {
+	sess := newReasoningSession()
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return sess, nil
+		},
+	}
+
+	events, _, err := newTestClient(mock).QueryStream(t.Context(), "", "why?")
+	require.NoError(t, err)
+
+	var collected []StreamEvent
+	for evt := range events {
+		collected = append(collected, evt)
+	}
+
+	require.Len(t, collected, 3)
+	assert.Equal(t, "let me think", collected[0].ReasoningDelta)
+	assert.Empty(t, collected[0].DeltaContent)
+	assert.Equal(t, "answer", collected[1].DeltaContent)
+	assert.True(t, collected[2].IsFinal)
+	assert.Equal(t, "answer", collected[2].Content, "reasoning must not leak into the final content")
+	assert.Equal(t, 1, collected[2].ChunkCount)
+}
+
+func TestNewStreamHandler_ReasoningEvent(t *testing.T) {
+	sess := newReasoningSession()
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return sess, nil
+		},
+	}
+
+	handler := NewStreamHandler(newTestClient(mock))
+	req := httptest.NewRequest(http.MethodPost, "/api/copilot/stream", strings.NewReader(`{"prompt": "why?"}`))
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	sseBody := rec.Body.String()
+	assert.Contains(t, sseBody, "event: reasoning\ndata: {\"reasoning\":\"let me think\"")
+	assert.Contains(t, sseBody, `"delta":"answer"`)
+	assert.Contains(t, sseBody, `"content":"answer"`)
+}
+
+// ---------------------------------------------------------------------------
+// WithBeforeQuery / WithAfterQuery
+// ---------------------------------------------------------------------------
+
+func TestQueryWithSession_Hooks(t *testing.T) {
+	sess := &mockSDKSession{id: "hook-sess"}
+	sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+		go func() {
+			sess.emit(&copilot.SessionEvent{
+				Type: copilot.AssistantMessage,
+				Data: copilot.Data{Content: ptr("audited")},
+			})
+			sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+		}()
+		return testMsgID, nil
+	}
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return sess, nil
+		},
+	}
+
+	var calls []string
+	client := newTestClient(mock,
+		WithBeforeQuery(func(_ context.Context, prompt, sessionID string) {
+			calls = append(calls, "before:"+prompt+":"+sessionID)
+		}),
+		WithAfterQuery(func(_ context.Context, result *QueryResult, err error) {
+			if err != nil {
+				calls = append(calls, "after-err:"+err.Error())
+				return
+			}
+			calls = append(calls, "after:"+result.Content)
+		}),
+	)
+
+	_, err := client.Query(t.Context(), "audit me")
+	require.NoError(t, err)
+
+	_, err = client.Query(t.Context(), "")
+	require.ErrorIs(t, err, ErrEmptyPrompt)
+
+	assert.Equal(t, []string{
+		"before:audit me:",
+		"after:audited",
+		"before::",
+		"after-err:" + ErrEmptyPrompt.Error(),
+	}, calls)
+}
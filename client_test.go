@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	copilot "github.com/github/copilot-sdk/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -77,6 +78,35 @@ func TestNew(t *testing.T) {
 	})
 }
 
+func TestClient_Getters(t *testing.T) {
+	tool := ToolDefinition{Name: "t1", Handler: func(_ map[string]any) (string, error) { return "", nil }}
+
+	client, err := New(
+		WithCLIURL("sidecar:9000"),
+		WithModel("gpt-5"),
+		WithLogLevel("debug"),
+		WithStreaming(true),
+		WithBYOK(ProviderAnthropic, "https://api.anthropic.com/v1", "ant-key"),
+		WithTools(tool),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "sidecar:9000", client.CLIURL())
+	assert.Equal(t, "gpt-5", client.Model())
+	assert.Equal(t, "debug", client.LogLevel())
+	assert.True(t, client.Streaming())
+	assert.Equal(t, AuthModeBYOK, client.AuthMode())
+	assert.Equal(t, ProviderAnthropic, client.ProviderType())
+
+	tools := client.Tools()
+	require.Len(t, tools, 1)
+	assert.Equal(t, "t1", tools[0].Name)
+
+	// Mutating the returned slice must not affect the client.
+	tools[0].Name = "changed"
+	assert.Equal(t, "t1", client.Tools()[0].Name)
+}
+
 func TestNew_ValidationErrors(t *testing.T) {
 	t.Run("validate fails after options succeed", func(t *testing.T) {
 		// Custom option that clears cliURL — option itself succeeds but validate fails.
@@ -122,6 +152,65 @@ func TestNew_ValidationErrors(t *testing.T) {
 		require.Error(t, err)
 		assert.ErrorIs(t, err, ErrMissingProviderBaseURL)
 	})
+
+	t.Run("tool choice naming an unknown tool", func(t *testing.T) {
+		_, err := New(WithToolChoice("missing_tool"))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrUnknownToolChoice)
+	})
+
+	t.Run("required tool choice without tools", func(t *testing.T) {
+		_, err := New(WithToolChoice(ToolChoiceRequired))
+		require.ErrorIs(t, err, ErrUnknownToolChoice)
+	})
+
+	t.Run("nil query hooks", func(t *testing.T) {
+		_, err := New(WithBeforeQuery(nil))
+		require.Error(t, err)
+
+		_, err = New(WithAfterQuery(nil))
+		require.Error(t, err)
+	})
+
+	t.Run("empty tool choice", func(t *testing.T) {
+		_, err := New(WithToolChoice(""))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "tool choice must not be empty")
+	})
+
+	t.Run("nil client options hook", func(t *testing.T) {
+		_, err := New(WithClientOptionsHook(nil))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "client options hook must not be nil")
+	})
+
+	t.Run("unknown log level", func(t *testing.T) {
+		_, err := New(WithLogLevel("verbose"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid log level "verbose"`)
+	})
+
+	t.Run("nil shutdown context", func(t *testing.T) {
+		_, err := New(WithShutdownContext(nil)) //nolint:staticcheck // testing nil rejection
+		require.Error(t, err)
+	})
+
+	t.Run("zero handler timeout", func(t *testing.T) {
+		_, err := New(WithHandlerTimeout(0))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "handler timeout must be positive")
+	})
+
+	t.Run("negative max prompt length", func(t *testing.T) {
+		_, err := New(WithMaxPromptLength(-1))
+		require.Error(t, err)
+	})
+
+	t.Run("nil logger", func(t *testing.T) {
+		_, err := New(WithLogger(nil))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "logger must not be nil")
+	})
 }
 
 func TestClient_DisconnectedState(t *testing.T) {
@@ -229,7 +318,8 @@ func TestBuildSessionConfig(t *testing.T) {
 		client, err := New(WithModel("gpt-4o"), WithStreaming(true))
 		require.NoError(t, err)
 
-		sc := client.buildSessionConfig()
+		sc, err := client.buildSessionConfig("")
+		require.NoError(t, err)
 		assert.Equal(t, "gpt-4o", sc.Model)
 		assert.True(t, sc.Streaming)
 		assert.Nil(t, sc.SystemMessage)
@@ -237,11 +327,27 @@ func TestBuildSessionConfig(t *testing.T) {
 		assert.Nil(t, sc.Tools)
 	})
 
+	t.Run("tool choice none allows no tool", func(t *testing.T) {
+		client, err := New(WithToolChoice(ToolChoiceNone), WithTools(ToolDefinition{
+			Name:    "search",
+			Handler: func(map[string]any) (string, error) { return "", nil },
+		}))
+		require.NoError(t, err)
+
+		sc, err := client.buildSessionConfig("")
+		require.NoError(t, err)
+		assert.Empty(t, sc.Tools)
+		assert.Equal(t, []string{noToolsAllowed}, sc.AvailableTools,
+			"a non-empty allow-list, since the SDK drops an empty one and allows every built-in tool")
+		assert.Empty(t, sc.ExcludedTools)
+	})
+
 	t.Run("config with system message", func(t *testing.T) {
 		client, err := New(WithSystemMessage("You are an assistant."))
 		require.NoError(t, err)
 
-		sc := client.buildSessionConfig()
+		sc, err := client.buildSessionConfig("")
+		require.NoError(t, err)
 		require.NotNil(t, sc.SystemMessage)
 		assert.Equal(t, "append", sc.SystemMessage.Mode)
 		assert.Equal(t, "You are an assistant.", sc.SystemMessage.Content)
@@ -253,7 +359,8 @@ func TestBuildSessionConfig(t *testing.T) {
 		)
 		require.NoError(t, err)
 
-		sc := client.buildSessionConfig()
+		sc, err := client.buildSessionConfig("")
+		require.NoError(t, err)
 		require.NotNil(t, sc.Provider)
 		assert.Equal(t, "openai", sc.Provider.Type)
 		assert.Equal(t, "https://api.openai.com/v1", sc.Provider.BaseURL)
@@ -269,7 +376,8 @@ func TestBuildSessionConfig(t *testing.T) {
 		client, err := New(WithTools(tool))
 		require.NoError(t, err)
 
-		sc := client.buildSessionConfig()
+		sc, err := client.buildSessionConfig("")
+		require.NoError(t, err)
 		require.Len(t, sc.Tools, 1)
 		assert.Equal(t, "lookup", sc.Tools[0].Name)
 	})
@@ -360,6 +468,22 @@ func TestSDKTools(t *testing.T) {
 		assert.Equal(t, "tool_a", tools[0].Name)
 		assert.Equal(t, "tool_b", tools[1].Name)
 	})
+
+	t.Run("includes typed tools after definitions", func(t *testing.T) {
+		td := ToolDefinition{
+			Name:    "tool_a",
+			Handler: func(_ map[string]any) (string, error) { return "a", nil },
+		}
+		typed := WithTypedTool("tool_t", "Typed", func(struct{}, context.Context) (any, error) { return "t", nil })
+
+		client, err := New(WithTools(td), typed)
+		require.NoError(t, err)
+
+		tools := client.sdkTools()
+		require.Len(t, tools, 2)
+		assert.Equal(t, "tool_a", tools[0].Name)
+		assert.Equal(t, "tool_t", tools[1].Name)
+	})
 }
 
 func TestWithGitHubAuth(t *testing.T) {
@@ -377,6 +501,53 @@ func TestWithGitHubAuth_OverridesBYOK(t *testing.T) {
 	assert.Equal(t, AuthModeGitHub, client.cfg.authMode)
 }
 
+func TestWithLogLevel_WarnAndTrace(t *testing.T) {
+	for _, level := range []string{"warn", "trace"} {
+		client, err := New(WithLogLevel(level))
+		require.NoError(t, err)
+		assert.Equal(t, level, client.LogLevel())
+		assert.Equal(t, level, client.cfg.clientOptions().LogLevel, "forwarded to the SDK")
+	}
+}
+
+func TestWithClientOptionsHook(t *testing.T) {
+	var calls []string
+	client, err := New(
+		WithCLIURL("localhost:9999"),
+		WithClientOptionsHook(func(opts *copilot.ClientOptions) {
+			calls = append(calls, "first:"+opts.CLIUrl)
+			opts.CLIUrl = "localhost:1234"
+		}),
+		WithClientOptionsHook(func(opts *copilot.ClientOptions) {
+			calls = append(calls, "second:"+opts.CLIUrl)
+			opts.Env = []string{"FOO=bar"}
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first:localhost:9999", "second:localhost:1234"}, calls,
+		"hooks run in order after the package's own mapping")
+
+	opts := client.cfg.clientOptions()
+	assert.Equal(t, "localhost:1234", opts.CLIUrl)
+	assert.Equal(t, []string{"FOO=bar"}, opts.Env)
+	assert.Equal(t, "localhost:9999", client.CLIURL(), "the client's own config is untouched")
+}
+
+func TestWithSDKClient(t *testing.T) {
+	var started bool
+	client, err := New(WithSDKClient(&mockSDKClient{
+		startFn: func(context.Context) error { started = true; return nil },
+	}))
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(t.Context()))
+	assert.True(t, started, "the client starts the given SDK client")
+	assert.True(t, client.IsConnected())
+
+	_, err = New(WithSDKClient(nil))
+	require.Error(t, err)
+}
+
 func TestClient_Start(t *testing.T) {
 	t.Run("returns ErrAlreadyConnected when already connected", func(t *testing.T) {
 		client, err := New()
@@ -523,3 +694,23 @@ func TestClient_DestroySession_Connected(t *testing.T) {
 	err = client.DestroySession(t.Context(), "sess-123")
 	assert.Error(t, err)
 }
+
+func TestWithSystemMessages(t *testing.T) {
+	client, err := New(
+		WithSystemMessage("You are an inventory assistant."),
+		WithSystemMessages("Tenant policy: never quote prices.", ""),
+		WithSystemMessages("Use check_stock for stock questions."),
+	)
+	require.NoError(t, err)
+
+	sc, err := client.buildSessionConfig("")
+	require.NoError(t, err)
+	require.NotNil(t, sc.SystemMessage)
+	assert.Equal(t,
+		"You are an inventory assistant.\nTenant policy: never quote prices.\nUse check_stock for stock questions.",
+		sc.SystemMessage.Content)
+
+	client, err = New(WithSystemMessages("persona", "policy"), WithSystemMessage("replaced"))
+	require.NoError(t, err)
+	assert.Equal(t, "replaced", client.cfg.systemMessage)
+}
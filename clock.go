@@ -0,0 +1,17 @@
+package copilotcli
+
+import "time"
+
+// clock abstracts the passage of time for the retry backoffs, timeouts, rate
+// limits, uptime, and measured latencies, so tests can run them without
+// sleeping.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
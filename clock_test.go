@@ -0,0 +1,176 @@
+package copilotcli
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock whose After fires immediately, advancing Now by the
+// requested duration and recording it.
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waits = append(f.waits, d)
+	f.now = f.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- f.now
+	return ch
+}
+
+// Advance moves Now forward by d.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Waits returns the durations passed to After so far.
+func (f *fakeClock) Waits() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration(nil), f.waits...)
+}
+
+// manualClock is a clock whose After fires only when the test sends on fire.
+// fire holds one value, so firing does not wait for a receiver.
+type manualClock struct {
+	realClock
+	fire chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{fire: make(chan time.Time, 1)}
+}
+
+func (m *manualClock) After(time.Duration) <-chan time.Time { return m.fire }
+
+// withClock replaces the client's clock. Test-only.
+func withClock(c clock) Option {
+	return func(cfg *cfg) error {
+		cfg.clock = c
+		return nil
+	}
+}
+
+func TestStart_BackoffDelays(t *testing.T) {
+	clk := newFakeClock()
+	c := defaultCfg()
+	for _, opt := range []Option{withClock(clk), WithRetryAttempts(4), WithRetryDelay(time.Second)} {
+		require.NoError(t, opt(c))
+	}
+	client := &Client{cfg: c, sdk: &mockSDKClient{
+		startFn: func(context.Context) error { return errors.New("connection refused") },
+	}}
+
+	err := client.Start(t.Context())
+
+	require.ErrorIs(t, err, ErrSidecarUnavailable)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, clk.Waits())
+}
+
+func TestQueryRetries_BackoffDelays(t *testing.T) {
+	clk := newFakeClock()
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("s1", "", "429 Too Many Requests"), nil
+		},
+	}
+	client := newTestClient(mock, withClock(clk), WithQueryRetries(3), WithRetryDelay(time.Minute))
+
+	_, err := client.Query(t.Context(), "hi")
+
+	require.Error(t, err)
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute}, clk.Waits())
+}
+
+func TestUptime_UsesClock(t *testing.T) {
+	clk := newFakeClock()
+	c := defaultCfg()
+	require.NoError(t, withClock(clk)(c))
+	client := &Client{cfg: c, sdk: &mockSDKClient{}}
+
+	require.NoError(t, client.Start(t.Context()))
+	clk.Advance(90 * time.Second)
+
+	assert.Equal(t, 90*time.Second, client.uptime())
+}
+
+func TestQueryStream_TimingUsesClock(t *testing.T) {
+	clk := newFakeClock()
+	sess := &mockSDKSession{id: "timed"}
+	sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+		go func() {
+			clk.Advance(50 * time.Millisecond)
+			sess.emit(&copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("Hi")}})
+			clk.Advance(100 * time.Millisecond)
+			sess.emit(&copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("Hi")}})
+			sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+		}()
+		return testMsgID, nil
+	}
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+	}, withClock(clk))
+
+	events, _, err := client.QueryStream(t.Context(), "", "hi")
+	require.NoError(t, err)
+	var final StreamEvent
+	for evt := range events {
+		if evt.IsFinal {
+			final = evt
+		}
+	}
+	require.True(t, final.IsFinal)
+	assert.Equal(t, 50*time.Millisecond, final.FirstTokenLatency)
+	assert.Equal(t, 150*time.Millisecond, final.Elapsed)
+}
+
+type durationMetrics struct {
+	recordingMetrics
+	toolDurations []time.Duration
+}
+
+func (m *durationMetrics) ObserveToolCall(_ string, d time.Duration, _ bool) {
+	m.mu.Lock()
+	m.toolDurations = append(m.toolDurations, d)
+	m.mu.Unlock()
+}
+
+func TestInstrumentTool_UsesClock(t *testing.T) {
+	clk := newFakeClock()
+	metrics := &durationMetrics{}
+	tool := instrumentTool(copilot.Tool{
+		Name: "slow",
+		Handler: func(copilot.ToolInvocation) (copilot.ToolResult, error) {
+			clk.Advance(30 * time.Millisecond)
+			return copilot.ToolResult{ResultType: "success"}, nil
+		},
+	}, metrics, clk)
+
+	_, err := tool.Handler(copilot.ToolInvocation{})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{30 * time.Millisecond}, metrics.toolDurations)
+}
@@ -0,0 +1,94 @@
+package copilotcli
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCompression_GzipsHealth(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithCompression(true))
+	handler := NewHealthHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"healthy"}`, string(body))
+}
+
+func TestWithCompression_QueryHandler(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithCompression(true))
+	handler := NewQueryHandler(client)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/copilot/query", http.NoBody)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"error":"invalid request body"}`, string(body))
+}
+
+func TestWithCompression_NotRequested(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithCompression(true))
+	handler := NewHealthHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, identity")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.JSONEq(t, `{"status":"healthy"}`, rec.Body.String())
+}
+
+func TestWithCompression_Disabled(t *testing.T) {
+	client := newTestClient(&mockSDKClient{})
+	handler := NewHealthHandler(client)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Empty(t, rec.Header().Get("Vary"))
+	assert.JSONEq(t, `{"status":"healthy"}`, rec.Body.String())
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"GZIP":                true,
+		"deflate, gzip;q=0.5": true,
+		"gzip;q=0":            false,
+		"gzip; q=0.0":         false,
+		"br, identity":        false,
+		"x-gzip":              false,
+	}
+	for header, want := range tests {
+		assert.Equal(t, want, acceptsGzip(header), header)
+	}
+}
@@ -1,14 +1,27 @@
 package copilotcli
 
-import "time"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"text/template"
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
 
 const (
-	defaultCLIURL        = "localhost:4321"
-	defaultLogLevel      = "error"
-	defaultModel         = "gpt-4o"
-	defaultConnTimeout   = 10 * time.Second
-	defaultRetryAttempts = 5
-	defaultRetryDelay    = 500 * time.Millisecond
+	defaultCLIURL         = "localhost:4321"
+	defaultLogLevel       = "error"
+	defaultModel          = "gpt-4o"
+	defaultConnTimeout    = 10 * time.Second
+	defaultPingTimeout    = 5 * time.Second
+	defaultRetryAttempts  = 5
+	defaultRetryDelay     = 500 * time.Millisecond
+	defaultMaxConcurrency = 4
+	defaultMaxBatchSize   = 100
+	defaultErrorPrefix    = "copilot: "
 )
 
 // AuthMode defines how the Copilot CLI sidecar authenticates with the LLM provider.
@@ -36,6 +49,39 @@ const (
 	ProviderAnthropic ProviderType = "anthropic"
 )
 
+// Tool choice values accepted by WithToolChoice. Any other value names a
+// specific registered tool.
+const (
+	// ToolChoiceAuto lets the model decide whether to call a tool (the default).
+	ToolChoiceAuto = "auto"
+	// ToolChoiceNone forbids tool use: the session gets neither the client's
+	// custom tools nor the CLI's built-in ones.
+	ToolChoiceNone = "none"
+	// ToolChoiceRequired restricts the session to the client's custom tools.
+	ToolChoiceRequired = "required"
+)
+
+// StreamOverflowPolicy decides what QueryStream does with an answer delta
+// when the event channel is full because the consumer has fallen behind.
+// Whatever the policy, the final event carries the complete content (unless
+// WithStreamSuppressFinalContent is set) and its ChunkCount counts every
+// delta the model produced.
+type StreamOverflowPolicy string
+
+const (
+	// StreamOverflowBlock waits for the consumer, holding up the SDK event
+	// callback meanwhile (the default).
+	StreamOverflowBlock StreamOverflowPolicy = "block"
+	// StreamOverflowCoalesce buffers deltas while the channel is full and
+	// sends them merged into one delta once there is room, so the
+	// concatenated deltas still equal the full content.
+	StreamOverflowCoalesce StreamOverflowPolicy = "coalesce"
+	// StreamOverflowDropOldest discards the oldest queued event to make room,
+	// so consumers only ever see the most recent output. Dropped deltas are
+	// lost; rely on the final event's Content for the full answer.
+	StreamOverflowDropOldest StreamOverflowPolicy = "drop_oldest"
+)
+
 // cfg is the internal resolved configuration built from functional options.
 type cfg struct {
 	cliURL          string
@@ -46,8 +92,60 @@ type cfg struct {
 	connTimeout     time.Duration
 	retryAttempts   int
 	retryDelay      time.Duration
+	startRetryIf    func(error) bool
 	systemMessage   string
 	tools           []ToolDefinition
+	typedTools      []copilot.Tool
+	toolCtxs        *toolContexts
+	toolConcurrency int
+	maxToolRounds   int
+	toolChoice      string
+	maxConcurrency  int
+	maxSessions     int
+	rateLimitRPS    float64
+	rateLimitBurst  int
+	rateLimitKey    RateLimitKeyFunc
+	rawEvents       bool
+	idempotencyTTL  time.Duration
+	sseFields       sseFieldNames
+	compression     bool
+	metrics         Metrics
+	pingTimeout     time.Duration
+	logger          *slog.Logger
+	shutdownCtx     context.Context
+	contextWindow   int
+	tokenCounter    TokenCounter
+	autoRecreate    bool
+	fallbacks       []fallbackProvider
+	suppressFinal   bool
+	streamResume    bool
+	streamJSON      bool
+	overflow        StreamOverflowPolicy
+	streamBatch     time.Duration
+	clock           clock
+	promptTmpl      *template.Template
+	strictJSON      bool
+	sessionHooks    []func(*copilot.SessionConfig)
+	resumeHooks     []func(*copilot.ResumeSessionConfig)
+	clientHooks     []func(*copilot.ClientOptions)
+	recordPath      string
+	recordMode      RecorderMode
+	sdk             SDKClient
+	handlerTimeout  time.Duration
+	maxPromptLength int
+	maxBatchSize    int
+	queryRetries    int
+	auditor         QueryAuditor
+	auditContent    bool
+	jsonEncoder     func(any) ([]byte, error)
+	firstTokenWait  time.Duration
+	sessionIDCheck  func(string) error
+	costModel       CostModel
+	errorPrefix     string
+	beforeQuery     []BeforeQueryHook
+	afterQuery      []AfterQueryHook
+	sessionSave     SessionSaveFunc
+	sessionLoad     SessionLoadFunc
 	providerType    ProviderType
 	providerBaseURL string
 	providerAPIKey  string
@@ -56,21 +154,47 @@ type cfg struct {
 
 func defaultCfg() *cfg {
 	return &cfg{
-		cliURL:        defaultCLIURL,
-		logLevel:      defaultLogLevel,
-		model:         defaultModel,
-		authMode:      AuthModeGitHub,
-		connTimeout:   defaultConnTimeout,
-		retryAttempts: defaultRetryAttempts,
-		retryDelay:    defaultRetryDelay,
-		providerType:  ProviderOpenAI,
+		cliURL:         defaultCLIURL,
+		logLevel:       defaultLogLevel,
+		model:          defaultModel,
+		authMode:       AuthModeGitHub,
+		connTimeout:    defaultConnTimeout,
+		pingTimeout:    defaultPingTimeout,
+		logger:         slog.New(slog.DiscardHandler),
+		retryAttempts:  defaultRetryAttempts,
+		retryDelay:     defaultRetryDelay,
+		providerType:   ProviderOpenAI,
+		maxConcurrency: defaultMaxConcurrency,
+		maxBatchSize:   defaultMaxBatchSize,
+		sseFields:      defaultSSEFieldNames,
+		jsonEncoder:    json.Marshal,
+		errorPrefix:    defaultErrorPrefix,
+		overflow:       StreamOverflowBlock,
+		clock:          realClock{},
+		toolCtxs:       newToolContexts(),
+	}
+}
+
+// clientOptions returns the SDK client options New connects with, after
+// any WithClientOptionsHook hooks have run.
+func (c *cfg) clientOptions() *copilot.ClientOptions {
+	opts := &copilot.ClientOptions{
+		CLIUrl:   c.cliURL,
+		LogLevel: c.logLevel,
+	}
+	for _, hook := range c.clientHooks {
+		hook(opts)
 	}
+	return opts
 }
 
 func (c *cfg) validate() error {
 	if c.cliURL == "" {
 		return ErrMissingCLIURL
 	}
+	if err := c.validateToolChoice(); err != nil {
+		return err
+	}
 	if c.authMode == AuthModeBYOK {
 		if c.model == "" {
 			return ErrMissingModel
@@ -81,3 +205,28 @@ func (c *cfg) validate() error {
 	}
 	return nil
 }
+
+// validateToolChoice checks that a named tool choice refers to a registered tool.
+func (c *cfg) validateToolChoice() error {
+	switch c.toolChoice {
+	case "", ToolChoiceAuto, ToolChoiceNone:
+		return nil
+	case ToolChoiceRequired:
+		if len(c.tools) == 0 && len(c.typedTools) == 0 {
+			return fmt.Errorf("%w: %q requires at least one tool", ErrUnknownToolChoice, c.toolChoice)
+		}
+		return nil
+	default:
+		for _, td := range c.tools {
+			if td.Name == c.toolChoice {
+				return nil
+			}
+		}
+		for _, t := range c.typedTools {
+			if t.Name == c.toolChoice {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %q", ErrUnknownToolChoice, c.toolChoice)
+	}
+}
@@ -0,0 +1,33 @@
+// Package copilotclitest provides test doubles for code that uses package
+// copilotcli. It is meant for tests only: nothing here talks to a sidecar.
+package copilotclitest
+
+import (
+	"context"
+	"slices"
+
+	"github.com/kazan/copilotcli"
+)
+
+// NewFakeClient returns a *copilotcli.Client backed by a scripted, in-memory
+// fake of the sidecar, so handlers and business logic can be tested without
+// one. Each message sent, in any session, is answered with the next of
+// responses, in order, streamed as a single delta; once they run out,
+// queries fail with a session error.
+//
+// The client is already connected: queries work without calling Start, and
+// Start returns copilotcli.ErrAlreadyConnected. New sessions get the IDs
+// "fake-session-1", "fake-session-2", and so on, and any session ID can be
+// resumed. Tools are never called, and the client uses the default
+// configuration, with the fake passed to copilotcli.WithSDKClient.
+func NewFakeClient(responses ...string) *copilotcli.Client {
+	client, err := copilotcli.New(copilotcli.WithSDKClient(&fakeSDK{responses: slices.Clone(responses)}))
+	if err != nil {
+		panic("copilotclitest: " + err.Error())
+	}
+	// The fake starts instantly and cannot fail.
+	if err := client.Start(context.Background()); err != nil {
+		panic("copilotclitest: " + err.Error())
+	}
+	return client
+}
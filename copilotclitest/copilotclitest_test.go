@@ -0,0 +1,68 @@
+package copilotclitest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kazan/copilotcli"
+	"github.com/kazan/copilotcli/copilotclitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFakeClient(t *testing.T) {
+	t.Run("responses in order", func(t *testing.T) {
+		client := copilotclitest.NewFakeClient("first", "second", "third")
+
+		res, err := client.Query(t.Context(), "one")
+		require.NoError(t, err)
+		assert.Equal(t, "first", res.Content)
+		assert.Equal(t, "fake-session-1", res.SessionID)
+
+		res, err = client.QueryWithSession(t.Context(), res.SessionID, "two")
+		require.NoError(t, err)
+		assert.Equal(t, "second", res.Content)
+		assert.Equal(t, "fake-session-1", res.SessionID, "sessions can be continued")
+
+		events, sid, err := client.QueryStream(t.Context(), "", "three")
+		require.NoError(t, err)
+		assert.Equal(t, "fake-session-2", sid)
+		var deltas, content string
+		for evt := range events {
+			require.NoError(t, evt.Error)
+			deltas += evt.DeltaContent
+			if evt.IsFinal {
+				content = evt.Content
+			}
+		}
+		assert.Equal(t, "third", deltas)
+		assert.Equal(t, "third", content)
+
+		_, err = client.Query(t.Context(), "four")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no scripted response left")
+	})
+
+	t.Run("already connected", func(t *testing.T) {
+		client := copilotclitest.NewFakeClient()
+		assert.True(t, client.IsConnected())
+		require.ErrorIs(t, client.Start(t.Context()), copilotcli.ErrAlreadyConnected)
+	})
+
+	t.Run("handlers", func(t *testing.T) {
+		srv := httptest.NewServer(copilotcli.NewServeMux(copilotclitest.NewFakeClient("hello from the fake"), ""))
+		defer srv.Close()
+
+		resp, err := http.Post(srv.URL+"/api/copilot/query", "application/json", strings.NewReader(`{"prompt": "hi"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "hello from the fake", body["content"])
+	})
+}
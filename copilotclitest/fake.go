@@ -0,0 +1,117 @@
+package copilotclitest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/kazan/copilotcli"
+)
+
+// fakeSDK is a scripted copilotcli.SDKClient: each message sent in any of
+// its sessions is answered with the next of responses. Once they run out,
+// messages fail with a session error.
+type fakeSDK struct {
+	mu        sync.Mutex
+	responses []string
+	sessions  int
+}
+
+func (*fakeSDK) Start(context.Context) error { return nil }
+
+func (*fakeSDK) Stop() error { return nil }
+
+func (*fakeSDK) Ping(context.Context, string) (*copilot.PingResponse, error) {
+	return &copilot.PingResponse{}, nil
+}
+
+func (f *fakeSDK) CreateSession(context.Context, *copilot.SessionConfig) (copilotcli.SDKSession, error) {
+	f.mu.Lock()
+	f.sessions++
+	id := fmt.Sprintf("fake-session-%d", f.sessions)
+	f.mu.Unlock()
+	return &fakeSession{id: id, sdk: f}, nil
+}
+
+func (f *fakeSDK) ResumeSessionWithOptions(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (copilotcli.SDKSession, error) {
+	return &fakeSession{id: sessionID, sdk: f}, nil
+}
+
+func (*fakeSDK) DeleteSession(context.Context, string) error { return nil }
+
+func (*fakeSDK) ListModels(context.Context) ([]copilot.ModelInfo, error) {
+	return nil, fmt.Errorf("%w: the fake client has no models", copilotcli.ErrUnsupported)
+}
+
+// next returns the events answering the next message.
+func (f *fakeSDK) next() []copilot.SessionEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.responses) == 0 {
+		msg := "fake client has no scripted response left"
+		return []copilot.SessionEvent{{Type: copilot.SessionError, Data: copilot.Data{Message: &msg}}}
+	}
+	response := f.responses[0]
+	f.responses = f.responses[1:]
+	return []copilot.SessionEvent{
+		{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: &response}},
+		{Type: copilot.AssistantMessage, Data: copilot.Data{Content: &response}},
+		{Type: copilot.SessionIdle},
+	}
+}
+
+// fakeSession emits the SDK's next response after each Send, from another
+// goroutine, as the SDK does.
+type fakeSession struct {
+	id  string
+	sdk *fakeSDK
+
+	mu       sync.Mutex
+	handlers map[int]func(copilot.SessionEvent)
+	nextID   int
+	sent     int
+}
+
+func (s *fakeSession) ID() string { return s.id }
+
+func (s *fakeSession) On(handler func(copilot.SessionEvent)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[int]func(copilot.SessionEvent))
+	}
+	id := s.nextID
+	s.nextID++
+	s.handlers[id] = handler
+	return func() {
+		s.mu.Lock()
+		delete(s.handlers, id)
+		s.mu.Unlock()
+	}
+}
+
+func (s *fakeSession) Send(context.Context, copilot.MessageOptions) (string, error) {
+	events := s.sdk.next()
+	s.mu.Lock()
+	s.sent++
+	msgID := fmt.Sprintf("fake-message-%d", s.sent)
+	s.mu.Unlock()
+
+	go func() {
+		for _, event := range events {
+			s.mu.Lock()
+			handlers := make([]func(copilot.SessionEvent), 0, len(s.handlers))
+			for _, h := range s.handlers {
+				handlers = append(handlers, h)
+			}
+			s.mu.Unlock()
+			for _, h := range handlers {
+				h(event)
+			}
+		}
+	}()
+	return msgID, nil
+}
+
+func (*fakeSession) Abort(context.Context) error { return nil }
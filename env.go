@@ -0,0 +1,84 @@
+package copilotcli
+
+import (
+	"fmt"
+	"os"
+)
+
+// Environment variables read by NewFromEnv.
+const (
+	EnvCLIURL          = "COPILOT_CLI_URL"
+	EnvModel           = "COPILOT_MODEL"
+	EnvLogLevel        = "COPILOT_LOG_LEVEL"
+	EnvAuthMode        = "COPILOT_AUTH_MODE"
+	EnvProviderType    = "COPILOT_PROVIDER_TYPE"
+	EnvProviderBaseURL = "COPILOT_PROVIDER_BASE_URL"
+	EnvProviderAPIKey  = "COPILOT_PROVIDER_API_KEY"
+	EnvAzureAPIVersion = "COPILOT_AZURE_API_VERSION"
+)
+
+// NewFromEnv creates a Client configured from COPILOT_* environment variables.
+// Unset or empty variables fall back to the defaults used by New. Additional
+// options (e.g., WithTools) are applied after the environment and take precedence.
+//
+// COPILOT_AUTH_MODE is "github" (default) or "byok". In BYOK mode,
+// COPILOT_PROVIDER_TYPE ("openai", "azure", "anthropic"; default "openai") and
+// COPILOT_PROVIDER_BASE_URL select the provider.
+//
+// Errors identify the offending variable.
+func NewFromEnv(opts ...Option) (*Client, error) {
+	envOpts, err := optionsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return New(append(envOpts, opts...)...)
+}
+
+// optionsFromEnv translates the COPILOT_* environment variables into options.
+func optionsFromEnv() ([]Option, error) {
+	var opts []Option
+
+	if v := os.Getenv(EnvCLIURL); v != "" {
+		opts = append(opts, envOption(EnvCLIURL, WithCLIURL(v)))
+	}
+	if v := os.Getenv(EnvModel); v != "" {
+		opts = append(opts, envOption(EnvModel, WithModel(v)))
+	}
+	if v := os.Getenv(EnvLogLevel); v != "" {
+		opts = append(opts, envOption(EnvLogLevel, WithLogLevel(v)))
+	}
+	if v := os.Getenv(EnvAzureAPIVersion); v != "" {
+		opts = append(opts, envOption(EnvAzureAPIVersion, WithAzureAPIVersion(v)))
+	}
+
+	switch mode := AuthMode(os.Getenv(EnvAuthMode)); mode {
+	case "", AuthModeGitHub:
+		opts = append(opts, WithGitHubAuth())
+	case AuthModeBYOK:
+		providerType := ProviderOpenAI
+		if v := os.Getenv(EnvProviderType); v != "" {
+			providerType = ProviderType(v)
+		}
+		switch providerType {
+		case ProviderOpenAI, ProviderAzure, ProviderAnthropic:
+		default:
+			return nil, fmt.Errorf("%s: unknown provider type %q", EnvProviderType, providerType)
+		}
+		opts = append(opts, envOption(EnvProviderBaseURL,
+			WithBYOK(providerType, os.Getenv(EnvProviderBaseURL), os.Getenv(EnvProviderAPIKey))))
+	default:
+		return nil, fmt.Errorf("%s: unknown auth mode %q", EnvAuthMode, mode)
+	}
+
+	return opts, nil
+}
+
+// envOption wraps an option so its error names the environment variable it came from.
+func envOption(name string, opt Option) Option {
+	return func(c *cfg) error {
+		if err := opt(c); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package copilotcli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromEnv(t *testing.T) {
+	// Start every subtest from a clean environment regardless of the host.
+	for _, name := range []string{
+		EnvCLIURL, EnvModel, EnvLogLevel, EnvAuthMode,
+		EnvProviderType, EnvProviderBaseURL, EnvProviderAPIKey, EnvAzureAPIVersion,
+	} {
+		t.Setenv(name, "")
+	}
+
+	t.Run("defaults when unset", func(t *testing.T) {
+		client, err := NewFromEnv()
+		require.NoError(t, err)
+
+		assert.Equal(t, defaultCLIURL, client.cfg.cliURL)
+		assert.Equal(t, defaultModel, client.cfg.model)
+		assert.Equal(t, AuthModeGitHub, client.cfg.authMode)
+	})
+
+	t.Run("reads GitHub settings", func(t *testing.T) {
+		t.Setenv(EnvCLIURL, "sidecar:9000")
+		t.Setenv(EnvModel, "gpt-5")
+		t.Setenv(EnvLogLevel, "debug")
+
+		client, err := NewFromEnv()
+		require.NoError(t, err)
+
+		assert.Equal(t, "sidecar:9000", client.cfg.cliURL)
+		assert.Equal(t, "gpt-5", client.cfg.model)
+		assert.Equal(t, "debug", client.cfg.logLevel)
+	})
+
+	t.Run("reads BYOK settings", func(t *testing.T) {
+		t.Setenv(EnvAuthMode, "byok")
+		t.Setenv(EnvProviderType, "azure")
+		t.Setenv(EnvProviderBaseURL, "https://my.openai.azure.com")
+		t.Setenv(EnvProviderAPIKey, "az-key")
+		t.Setenv(EnvAzureAPIVersion, "2024-10-21")
+
+		client, err := NewFromEnv()
+		require.NoError(t, err)
+
+		assert.Equal(t, AuthModeBYOK, client.cfg.authMode)
+		assert.Equal(t, ProviderAzure, client.cfg.providerType)
+		assert.Equal(t, "https://my.openai.azure.com", client.cfg.providerBaseURL)
+		assert.Equal(t, "az-key", client.cfg.providerAPIKey)
+		assert.Equal(t, "2024-10-21", client.cfg.azureAPIVersion)
+	})
+
+	t.Run("explicit options take precedence", func(t *testing.T) {
+		t.Setenv(EnvModel, "gpt-5")
+
+		client, err := NewFromEnv(WithModel("claude-sonnet-4.5"))
+		require.NoError(t, err)
+		assert.Equal(t, "claude-sonnet-4.5", client.cfg.model)
+	})
+
+	t.Run("invalid auth mode names the variable", func(t *testing.T) {
+		t.Setenv(EnvAuthMode, "oauth")
+
+		_, err := NewFromEnv()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), EnvAuthMode)
+	})
+
+	t.Run("invalid provider type names the variable", func(t *testing.T) {
+		t.Setenv(EnvAuthMode, "byok")
+		t.Setenv(EnvProviderType, "cohere")
+		t.Setenv(EnvProviderBaseURL, "https://api.example.com")
+
+		_, err := NewFromEnv()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), EnvProviderType)
+	})
+
+	t.Run("BYOK without base URL names the variable", func(t *testing.T) {
+		t.Setenv(EnvAuthMode, "byok")
+
+		_, err := NewFromEnv()
+		require.ErrorIs(t, err, ErrMissingProviderBaseURL)
+		assert.Contains(t, err.Error(), EnvProviderBaseURL)
+	})
+}
@@ -1,6 +1,10 @@
 package copilotcli
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrNotConnected is returned when an operation requires an active connection to the sidecar.
@@ -9,18 +13,173 @@ var (
 	// ErrAlreadyConnected is returned when Start is called on an already-connected client.
 	ErrAlreadyConnected = errors.New("copilot client is already connected")
 
+	// ErrAlreadyStopped is returned by StopStrict when the client is not connected.
+	ErrAlreadyStopped = errors.New("copilot client is already stopped")
+
 	// ErrEmptyPrompt is returned when an empty prompt is passed to Query.
 	ErrEmptyPrompt = errors.New("prompt must not be empty")
 
+	// ErrContextTooLong is returned when a prompt's estimated size exceeds the WithContextWindow limit.
+	ErrContextTooLong = errors.New("prompt exceeds the model context window")
+
+	// ErrPromptTooLong is returned when a prompt exceeds the WithMaxPromptLength limit.
+	ErrPromptTooLong = errors.New("prompt exceeds the maximum length")
+
+	// ErrBatchTooLarge is returned when a batch has more prompts than the WithMaxBatchSize limit.
+	ErrBatchTooLarge = errors.New("batch exceeds the maximum size")
+
+	// ErrEmptySessionID is returned when an operation requires a session ID but none was given.
+	ErrEmptySessionID = errors.New("session ID must not be empty")
+
+	// ErrPingTimeout is returned when the sidecar does not answer a ping within the ping timeout.
+	ErrPingTimeout = errors.New("copilot CLI sidecar did not answer ping in time")
+
+	// ErrInvalidSessionID is returned when a session ID is rejected by the
+	// WithSessionIDValidator validator.
+	ErrInvalidSessionID = errors.New("invalid session ID")
+
+	// ErrSessionNotFound is returned when resuming a session the sidecar does not know.
+	ErrSessionNotFound = errors.New("copilot session not found")
+
 	// ErrSidecarUnavailable is returned when the sidecar cannot be reached after retries.
 	ErrSidecarUnavailable = errors.New("copilot CLI sidecar is unavailable after retries")
 
 	// ErrMissingModel is returned when BYOK auth mode is used without specifying a model.
 	ErrMissingModel = errors.New("model is required when using BYOK auth mode")
 
+	// ErrEmptyModel is returned when a per-query model override is blank.
+	ErrEmptyModel = errors.New("model override must not be blank")
+
 	// ErrMissingProviderBaseURL is returned when BYOK is used without a base URL.
 	ErrMissingProviderBaseURL = errors.New("provider base URL is required when using BYOK auth mode")
 
 	// ErrMissingCLIURL is returned when the CLI URL is empty after applying options.
 	ErrMissingCLIURL = errors.New("CLI URL must not be empty")
+
+	// ErrDuplicateTool is returned when registering a tool whose name is already in use.
+	ErrDuplicateTool = errors.New("a tool with this name is already registered")
+
+	// ErrUnknownToolChoice is returned when WithToolChoice names a tool that is not registered.
+	ErrUnknownToolChoice = errors.New("tool choice does not refer to a registered tool")
+
+	// ErrUnsupported is returned when the sidecar does not support the requested operation.
+	ErrUnsupported = errors.New("operation not supported by the copilot sidecar")
+
+	// ErrTooManySessions is returned when no session slot frees up before the context ends.
+	ErrTooManySessions = errors.New("too many concurrent sessions")
+
+	// ErrInvalidProviderOverride is returned when a per-request ProviderOverride
+	// has an unknown type or an unusable base URL.
+	ErrInvalidProviderOverride = errors.New("invalid provider override")
+
+	// ErrNoSessionPersistence is returned when a query sets a ConversationKey
+	// on a client without WithSessionPersistence.
+	ErrNoSessionPersistence = errors.New("conversation key requires WithSessionPersistence")
+
+	// ErrRateLimited is returned when the model provider rejects a query for
+	// exceeding its rate limit. The HTTP handlers report it as 429.
+	ErrRateLimited = errors.New("rate limited by the model provider")
+
+	// ErrToolLoopExceeded is reported to the model, as a tool error result, for
+	// tool calls beyond the WithMaxToolRounds budget of a query.
+	ErrToolLoopExceeded = errors.New("tool call limit for this request exceeded")
+
+	// ErrInvalidTool is returned by Client.Validate for a tool whose definition
+	// or parameter schema is malformed.
+	ErrInvalidTool = errors.New("invalid tool definition")
+
+	// ErrInvalidProvider is returned by Client.Validate for a BYOK or fallback
+	// provider with an unknown type or an unusable base URL.
+	ErrInvalidProvider = errors.New("invalid provider configuration")
+
+	// ErrFirstTokenTimeout is returned when the model produces no output within
+	// the WithFirstTokenTimeout window.
+	ErrFirstTokenTimeout = errors.New("no response from the model before the first-token timeout")
 )
+
+// sessionFailure is an error reported by a SessionError event that has been
+// classified, so errors.Is matches kind while the message stays the sidecar's.
+type sessionFailure struct {
+	msg  string
+	kind error
+}
+
+func (e *sessionFailure) Error() string { return e.msg }
+
+func (e *sessionFailure) Unwrap() error { return e.kind }
+
+// AbortReason says why a query was aborted when its context ended.
+type AbortReason string
+
+const (
+	// AbortCanceled means the context was canceled, e.g. by the caller or
+	// because an HTTP client disconnected.
+	AbortCanceled AbortReason = "canceled"
+	// AbortTimeout means the context's deadline passed.
+	AbortTimeout AbortReason = "timeout"
+	// AbortHandlerTimeout means the WithHandlerTimeout deadline of an HTTP
+	// handler passed.
+	AbortHandlerTimeout AbortReason = "handler_timeout"
+)
+
+// AbortError is returned when a query is aborted because its context ended,
+// and is the error of the terminal event of a stream aborted that way. It
+// wraps the context's error, so errors.Is(err, context.Canceled) and
+// errors.Is(err, context.DeadlineExceeded) keep working, as well as its
+// cancellation cause, if any.
+type AbortError struct {
+	Reason AbortReason
+	// Err is the context's error: context.Canceled or
+	// context.DeadlineExceeded.
+	Err error
+	// Cause is the context's cancellation cause (see context.Cause) when it
+	// differs from Err; nil otherwise.
+	Cause error
+}
+
+// Error describes the reason and the context's error.
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("query aborted (%s): %v", e.Reason, e.Err)
+}
+
+// Unwrap returns the context's error and cancellation cause.
+func (e *AbortError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// abortError returns the AbortError for a query whose ctx has ended.
+func abortError(ctx context.Context) error {
+	err := &AbortError{Reason: AbortCanceled, Err: ctx.Err()}
+	if cause := context.Cause(ctx); cause != err.Err {
+		err.Cause = cause
+	}
+	switch {
+	case errors.Is(err.Cause, errHandlerTimeout):
+		err.Reason = AbortHandlerTimeout
+	case errors.Is(err.Err, context.DeadlineExceeded):
+		err.Reason = AbortTimeout
+	}
+	return err
+}
+
+// PartialResultError is returned by QueryWithSession when the session fails
+// after the model had already produced some output. Content holds the text
+// generated before the failure so callers can salvage it.
+type PartialResultError struct {
+	Content   string
+	SessionID string
+	Err       error
+}
+
+// Error describes the underlying failure.
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("%s (partial content: %d bytes)", e.Err.Error(), len(e.Content))
+}
+
+// Unwrap returns the underlying error.
+func (e *PartialResultError) Unwrap() error {
+	return e.Err
+}
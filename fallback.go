@@ -0,0 +1,67 @@
+package copilotcli
+
+import (
+	"errors"
+	"strings"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// fallbackProvider is a BYOK provider tried when the previous one fails with
+// a retryable error. See WithFallbackProvider.
+type fallbackProvider struct {
+	providerType ProviderType
+	baseURL      string
+	apiKey       string
+}
+
+// config builds the SDK provider configuration. The Azure API version set
+// with WithAzureAPIVersion applies to Azure fallbacks too.
+func (p fallbackProvider) config(azureAPIVersion string) *copilot.ProviderConfig {
+	pc := &copilot.ProviderConfig{
+		Type:    string(p.providerType),
+		BaseURL: p.baseURL,
+		APIKey:  p.apiKey,
+	}
+	if p.providerType == ProviderAzure && azureAPIVersion != "" {
+		pc.Azure = &copilot.AzureProviderOptions{APIVersion: azureAPIVersion}
+	}
+	return pc
+}
+
+// retryableProviderMarkers are substrings of session errors that indicate the
+// provider is throttling or temporarily unavailable.
+var retryableProviderMarkers = []string{
+	"429",
+	"rate limit",
+	"rate-limit",
+	"too many requests",
+	"503",
+	"service unavailable",
+	"overloaded",
+}
+
+// isRetryableProviderError reports whether a query error means the provider
+// is throttled or unavailable, so another provider may succeed. Errors after
+// the model produced output are not retried, since any tool calls it made
+// would run again.
+func isRetryableProviderError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var partial *PartialResultError
+	if errors.As(err, &partial) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, marker := range retryableProviderMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
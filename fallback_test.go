@@ -0,0 +1,170 @@
+package copilotcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// providerSession replies with reply, or fails with errMsg if set.
+func providerSession(id, reply, errMsg string) *mockSDKSession {
+	if errMsg != "" {
+		return streamSession(id, copilot.SessionEvent{Type: copilot.SessionError, Data: copilot.Data{Message: ptr(errMsg)}})
+	}
+	return streamSession(id,
+		copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr(reply)}},
+		copilot.SessionEvent{Type: copilot.SessionIdle},
+	)
+}
+
+func TestFallbackProvider_FailsOver(t *testing.T) {
+	var providers []string
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			providers = append(providers, cfg.Provider.BaseURL)
+			switch cfg.Provider.BaseURL {
+			case "https://primary":
+				return providerSession("s-primary", "", "429 Too Many Requests"), nil
+			case "https://secondary":
+				return providerSession("s-secondary", "", "provider overloaded"), nil
+			default:
+				return providerSession("s-tertiary", "from tertiary", ""), nil
+			}
+		},
+	}
+	client := newTestClient(mock,
+		WithBYOK(ProviderOpenAI, "https://primary", "k1"),
+		WithFallbackProvider(ProviderAnthropic, "https://secondary", "k2"),
+		WithFallbackProvider(ProviderAzure, "https://tertiary", "k3"),
+		WithAzureAPIVersion("2024-10-21"),
+	)
+
+	result, err := client.Query(t.Context(), "hi")
+	require.NoError(t, err)
+	assert.Equal(t, "from tertiary", result.Content)
+	assert.Equal(t, "s-tertiary", result.SessionID)
+	assert.Equal(t, []string{"https://primary", "https://secondary", "https://tertiary"}, providers)
+}
+
+func TestFallbackProvider_ResumesSameSession(t *testing.T) {
+	var resumed []*copilot.ResumeSessionConfig
+	mock := &mockSDKClient{
+		resumeFn: func(_ context.Context, sessionID string, cfg *copilot.ResumeSessionConfig) (SDKSession, error) {
+			resumed = append(resumed, cfg)
+			if len(resumed) == 1 {
+				return providerSession(sessionID, "", "rate limit exceeded"), nil
+			}
+			return providerSession(sessionID, "ok", ""), nil
+		},
+	}
+	client := newTestClient(mock,
+		WithBYOK(ProviderOpenAI, "https://primary", "k1"),
+		WithFallbackProvider(ProviderOpenAI, "https://secondary", "k2"),
+	)
+
+	result, err := client.QueryWithSession(t.Context(), "conv-1", "hi")
+	require.NoError(t, err)
+	assert.Equal(t, "conv-1", result.SessionID)
+	require.Len(t, resumed, 2)
+	assert.Equal(t, "https://secondary", resumed[1].Provider.BaseURL)
+	assert.Equal(t, "k2", resumed[1].Provider.APIKey)
+}
+
+func TestFallbackProvider_NonRetryableError(t *testing.T) {
+	created := 0
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			created++
+			return providerSession("s1", "", "invalid API key"), nil
+		},
+	}
+	client := newTestClient(mock,
+		WithBYOK(ProviderOpenAI, "https://primary", "k1"),
+		WithFallbackProvider(ProviderOpenAI, "https://secondary", "k2"),
+	)
+
+	_, err := client.Query(t.Context(), "hi")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid API key")
+	assert.Equal(t, 1, created)
+}
+
+func TestQueryRetries_RetriesThenSucceeds(t *testing.T) {
+	created := 0
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			created++
+			if created < 3 {
+				return providerSession("s1", "", "429 Too Many Requests"), nil
+			}
+			return providerSession("s1", "done", ""), nil
+		},
+	}
+	client := newTestClient(mock, WithQueryRetries(2), WithRetryDelay(time.Millisecond))
+
+	result, err := client.Query(t.Context(), "hi")
+	require.NoError(t, err)
+	assert.Equal(t, "done", result.Content)
+	assert.Equal(t, 3, created)
+}
+
+func TestQueryRetries_StopsAfterLimit(t *testing.T) {
+	created := 0
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			created++
+			return providerSession("s1", "", "503 Service Unavailable"), nil
+		},
+	}
+	client := newTestClient(mock, WithQueryRetries(1), WithRetryDelay(time.Millisecond))
+
+	_, err := client.Query(t.Context(), "hi")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+	assert.Equal(t, 2, created)
+}
+
+func TestQueryRetries_CanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			// Cancel once the first attempt has failed and the backoff begins.
+			time.AfterFunc(20*time.Millisecond, cancel)
+			return providerSession("s1", "", "429 Too Many Requests"), nil
+		},
+	}
+	client := newTestClient(mock, WithQueryRetries(3), WithRetryDelay(time.Minute))
+
+	start := time.Now()
+	_, err := client.Query(ctx, "hi")
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestWithQueryRetries_Validation(t *testing.T) {
+	_, err := New(WithQueryRetries(-1))
+	require.Error(t, err)
+}
+
+func TestIsRetryableProviderError(t *testing.T) {
+	assert.True(t, isRetryableProviderError(errors.New("copilot: HTTP 429")))
+	assert.True(t, isRetryableProviderError(errors.New("copilot: Rate limit reached")))
+	assert.True(t, isRetryableProviderError(errors.New("copilot: 503 Service Unavailable")))
+	assert.False(t, isRetryableProviderError(errors.New("copilot: invalid request")))
+	assert.False(t, isRetryableProviderError(nil))
+
+	partial := &PartialResultError{Content: "half", Err: errors.New("copilot: 429")}
+	assert.False(t, isRetryableProviderError(fmt.Errorf("wrapped: %w", partial)))
+}
+
+func TestWithFallbackProvider_Validation(t *testing.T) {
+	_, err := New(WithFallbackProvider(ProviderOpenAI, "", "key"))
+	require.ErrorIs(t, err, ErrMissingProviderBaseURL)
+}
@@ -0,0 +1,77 @@
+package copilotcli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// QueryStreamFanout sends prompt to each of models, each in its own new
+// session, and merges their streams into one channel, e.g. to compare models
+// side by side. Every event carries the Model that produced it. Each model's
+// events arrive in order, but the events of different models interleave.
+//
+// Each model's stream ends with its own final or error event, and a failure
+// of one model, even to start its stream, is reported as that model's error
+// event without affecting the others. The channel is closed once every model
+// has finished; cancel ctx to stop them all, in which case it may close
+// without a final event for models that were still running.
+func (c *Client) QueryStreamFanout(ctx context.Context, prompt string, models []string) (<-chan StreamEvent, error) {
+	if prompt == "" {
+		return nil, ErrEmptyPrompt
+	}
+	if len(models) == 0 {
+		return nil, errors.New("fanout requires at least one model")
+	}
+	for _, model := range models {
+		if strings.TrimSpace(model) == "" {
+			return nil, ErrEmptyModel
+		}
+	}
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return nil, ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	out := make(chan StreamEvent, 64)
+	var wg sync.WaitGroup
+	for _, model := range models {
+		wg.Go(func() {
+			forward := func(e StreamEvent) bool {
+				e.Model = model
+				select {
+				case out <- e:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			events, _, err := c.QueryStreamWithOptions(ctx, QueryOptions{Prompt: prompt, Model: model})
+			if err != nil {
+				forward(StreamEvent{Error: err})
+				return
+			}
+			// Stop with ctx as well, rather than wait for the terminal event.
+			for {
+				select {
+				case e, ok := <-events:
+					if !ok || !forward(e) {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package copilotcli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryStreamFanout(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			switch cfg.Model {
+			case "gpt-4o":
+				return streamSession("s-gpt",
+					copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("one ")}},
+					copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("two")}},
+					copilot.SessionEvent{Type: copilot.SessionIdle},
+				), nil
+			case "claude-sonnet-4":
+				return streamSession("s-claude",
+					copilot.SessionEvent{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr("uno")}},
+					copilot.SessionEvent{Type: copilot.SessionError, Data: copilot.Data{Message: ptr("model overloaded")}},
+				), nil
+			default:
+				return nil, errors.New("unknown model")
+			}
+		},
+	}
+	client := newTestClient(mock)
+
+	t.Run("merges streams tagged by model", func(t *testing.T) {
+		events, err := client.QueryStreamFanout(t.Context(), "count", []string{"gpt-4o", "claude-sonnet-4", "missing"})
+		require.NoError(t, err)
+
+		byModel := make(map[string][]StreamEvent)
+		for evt := range events {
+			byModel[evt.Model] = append(byModel[evt.Model], evt)
+		}
+		require.Len(t, byModel, 3)
+
+		gpt := byModel["gpt-4o"]
+		require.Len(t, gpt, 3)
+		assert.Equal(t, "one ", gpt[0].DeltaContent)
+		assert.Equal(t, "two", gpt[1].DeltaContent)
+		assert.True(t, gpt[2].IsFinal)
+		assert.Equal(t, "one two", gpt[2].Content)
+		assert.Equal(t, "s-gpt", gpt[2].SessionID)
+
+		claude := byModel["claude-sonnet-4"]
+		require.Len(t, claude, 2, "a failing model ends with its error event")
+		assert.Equal(t, "uno", claude[0].DeltaContent)
+		require.EqualError(t, claude[1].Error, "copilot: model overloaded")
+
+		missing := byModel["missing"]
+		require.Len(t, missing, 1, "a model that cannot start reports one error event")
+		require.ErrorContains(t, missing[0].Error, "unknown model")
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := client.QueryStreamFanout(t.Context(), "", []string{"gpt-4o"})
+		require.ErrorIs(t, err, ErrEmptyPrompt)
+		_, err = client.QueryStreamFanout(t.Context(), "hi", nil)
+		require.Error(t, err)
+		_, err = client.QueryStreamFanout(t.Context(), "hi", []string{"gpt-4o", " "})
+		require.ErrorIs(t, err, ErrEmptyModel)
+
+		disconnected, err := New()
+		require.NoError(t, err)
+		_, err = disconnected.QueryStreamFanout(t.Context(), "hi", []string{"gpt-4o"})
+		require.ErrorIs(t, err, ErrNotConnected)
+	})
+
+	t.Run("cancel closes the channel", func(t *testing.T) {
+		sess, _ := silentSession()
+		client := newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return sess, nil },
+		})
+		ctx, cancel := context.WithCancel(t.Context())
+		events, err := client.QueryStreamFanout(ctx, "hi", []string{"a", "b"})
+		require.NoError(t, err)
+		cancel()
+		drain(events)
+	})
+}
@@ -3,6 +3,7 @@ module github.com/kazan/copilotcli
 go 1.25.5
 
 require (
+	github.com/coder/websocket v1.8.15
 	github.com/github/copilot-sdk/go v0.1.23
 	github.com/stretchr/testify v1.11.1
 )
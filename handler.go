@@ -1,17 +1,48 @@
 package copilotcli
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-// queryRequest is the JSON body for the query endpoint.
+// queryRequest is the JSON body for the query and stream endpoints.
 type queryRequest struct {
 	Prompt    string `json:"prompt"`
 	SessionID string `json:"session_id,omitempty"`
+
+	// Model overrides the client's model for this request.
+	Model string `json:"model,omitempty"`
+	// Temperature and MaxTokens are rejected when set: the sidecar exposes
+	// no sampling controls to apply them with.
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+
+	// Stream selects the SSE response in NewHandler. The other handlers
+	// ignore it.
+	Stream bool `json:"stream,omitempty"`
+}
+
+// options validates the optional overrides of req and returns the query to
+// run.
+func (req queryRequest) options() (QueryOptions, error) {
+	if req.Temperature != nil {
+		return QueryOptions{}, errors.New("temperature is not supported by the sidecar")
+	}
+	if req.MaxTokens != nil {
+		return QueryOptions{}, errors.New("max_tokens is not supported by the sidecar")
+	}
+	return QueryOptions{
+		SessionID: req.SessionID,
+		Prompt:    req.Prompt,
+		Model:     req.Model,
+	}, nil
 }
 
 // queryResponse is the JSON response for a non-streaming query.
@@ -20,6 +51,24 @@ type queryResponse struct {
 	SessionID string `json:"session_id"`
 }
 
+// batchRequest is the JSON body for the batch endpoint.
+type batchRequest struct {
+	Prompts []string `json:"prompts"`
+}
+
+// batchItem is a single entry in the batch response, in the same position as
+// its prompt. Exactly one of Content/SessionID or Error is set.
+type batchItem struct {
+	Content   string `json:"content,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// abortRequest is the JSON body for the abort endpoint.
+type abortRequest struct {
+	SessionID string `json:"session_id"`
+}
+
 // errorResponse is the standard error JSON response.
 type errorResponse struct {
 	Error string `json:"error"`
@@ -31,77 +80,191 @@ type errorResponse struct {
 // This handler supports multi-turn conversations via an optional "session_id" field.
 // If no session_id is provided, a new session is created for each request.
 //
+// An optional "model" overrides the client's model for the request. Since the
+// sidecar exposes no sampling controls, requests setting "temperature" or
+// "max_tokens" are rejected with 400 Bad Request rather than silently run
+// without them.
+//
+// A query the model provider rate-limited (ErrRateLimited) gets 429 Too Many
+// Requests with a Retry-After header, so callers can back off.
+//
+// When WithIdempotencyTTL is set, requests carrying an Idempotency-Key header
+// that was already answered within the TTL get the cached response replayed;
+// reusing a key with a different body gets 422 Unprocessable Entity.
+// With WithCompression, responses are gzipped for clients that accept it.
+//
 // Example registration:
 //
 //	mux.HandleFunc("POST /api/copilot/query", copilotcli.NewQueryHandler(client))
-func NewQueryHandler(client *Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func NewQueryHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	return RateLimit(h, withJSONContentType(h, h.writeError, queryHandler(h, client)))
+}
+
+// queryHandler is NewQueryHandler without its rate limit and Content-Type
+// check, which NewHandler applies itself.
+func queryHandler(h *Client, client CopilotClient) http.HandlerFunc {
+	return withCompression(h, withIdempotency(h, withHandlerTimeout(h, func(w http.ResponseWriter, r *http.Request) {
 		var req queryRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid request body")
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
 
 		if strings.TrimSpace(req.Prompt) == "" {
-			writeError(w, http.StatusBadRequest, "prompt is required")
+			h.writeError(w, http.StatusBadRequest, "prompt is required")
 			return
 		}
 
-		result, err := client.QueryWithSession(r.Context(), req.SessionID, req.Prompt)
+		if err := h.validateSessionID(req.SessionID); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts, err := req.options()
 		if err != nil {
-			status := http.StatusInternalServerError
-			if errors.Is(err, ErrNotConnected) || errors.Is(err, ErrSidecarUnavailable) {
-				status = http.StatusServiceUnavailable
-			}
-			writeError(w, status, err.Error())
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		result, err := client.QueryWithOptions(r.Context(), opts)
+		if err != nil {
+			setRetryAfter(w, err)
+			h.writeError(w, errorStatus(err), err.Error())
 			return
 		}
 
-		writeJSON(w, http.StatusOK, queryResponse{
+		h.writeJSON(w, http.StatusOK, queryResponse{
 			Content:   result.Content,
 			SessionID: result.SessionID,
 		})
-	}
+	})))
 }
 
 // NewStreamHandler returns an http.HandlerFunc that streams the LLM response
 // via Server-Sent Events (SSE).
 //
-// The client must accept "text/event-stream". Each event has the format:
+// The client must accept "text/event-stream". As soon as the session is
+// ready, before the first delta, an open event confirms the stream is live
+// and carries the session ID:
+//
+//	event: open
+//	data: {"session_id":"..."}
+//
+// Each answer chunk then has the format:
 //
 //	data: {"delta":"...", "session_id":"..."}
 //
-// The final event includes "final":true with the complete content.
+// With WithStreamBatchWindow, the deltas arriving within each window are
+// combined into one such event.
+//
+// Reasoning ("thinking") chunks from models that emit them are sent as named
+// events, separate from the answer deltas:
+//
+//	event: reasoning
+//	data: {"reasoning":"...", "session_id":"..."}
+//
+// The final event includes "final":true with the complete content, the
+// number of deltas as "chunk_count", and the generation time as "elapsed_ms".
+// With WithCostModel, it also carries the estimated cost as "cost".
+// With WithStreamSuppressFinalContent, the final content is left empty. The
+// delta, content, final, error, and session_id keys can be renamed with
+// WithSSEFieldNames.
+//
+// A failure ends the stream with an event carrying the "error" message; when
+// the provider rate-limited the query, it also carries "status":429 and the
+// suggested back-off in seconds as "retry_after".
+//
+// Every event carries an "id:" line of the form "<session_id>:<seq>", starting
+// at 0 for the open event. When a
+// request has no "session_id" but a Last-Event-ID header, as sent by a
+// reconnecting EventSource, the prompt runs in the session named by that ID.
+// Resumption continues the conversation: deltas already delivered before the
+// disconnect are not replayed.
+//
+// The request body accepts the same fields as NewQueryHandler, including the
+// optional "model" override, and likewise rejects "temperature" and
+// "max_tokens".
+//
+// A ResponseWriter that cannot flush gets 500 Internal Server Error, or with
+// WithStreamFallbackToJSON, the buffered answer as NewQueryHandler returns it.
+//
+// Since a browser EventSource can only issue GET requests, the handler also
+// accepts GET with the prompt and optional session ID in the query string,
+// e.g. "?prompt=Hello&session_id=...". Register it for both methods to use
+// it that way.
 //
 // Example registration:
 //
 //	mux.HandleFunc("POST /api/copilot/stream", copilotcli.NewStreamHandler(client))
-func NewStreamHandler(client *Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+//	mux.HandleFunc("GET /api/copilot/stream", copilotcli.NewStreamHandler(client))
+func NewStreamHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	return RateLimit(h, withJSONContentType(h, h.writeError, streamHandler(h, client)))
+}
+
+// streamHandler is NewStreamHandler without its rate limit and Content-Type
+// check, which NewHandler applies itself.
+func streamHandler(h *Client, client CopilotClient) http.HandlerFunc {
+	return withHandlerTimeout(h, func(w http.ResponseWriter, r *http.Request) {
 		flusher, ok := w.(http.Flusher)
-		if !ok {
-			writeError(w, http.StatusInternalServerError, "streaming not supported")
+		if !ok && !h.cfg.streamJSON {
+			h.writeError(w, http.StatusInternalServerError, "streaming not supported")
 			return
 		}
 
 		var req queryRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid request body")
+		if r.Method == http.MethodGet {
+			query := r.URL.Query()
+			req.Prompt = query.Get("prompt")
+			req.SessionID = query.Get("session_id")
+		} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
 
 		if strings.TrimSpace(req.Prompt) == "" {
-			writeError(w, http.StatusBadRequest, "prompt is required")
+			h.writeError(w, http.StatusBadRequest, "prompt is required")
 			return
 		}
 
-		events, sessionID, err := client.QueryStream(r.Context(), req.SessionID, req.Prompt)
+		// Cancel the stream whenever the handler returns early, whether the
+		// client disconnected or a write failed, so the session aborts.
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		if req.SessionID == "" {
+			req.SessionID = sessionFromEventID(r.Header.Get("Last-Event-ID"))
+		}
+		if err := h.validateSessionID(req.SessionID); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		opts, err := req.options()
 		if err != nil {
-			status := http.StatusInternalServerError
-			if errors.Is(err, ErrNotConnected) || errors.Is(err, ErrSidecarUnavailable) {
-				status = http.StatusServiceUnavailable
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		events, sessionID, err := client.QueryStreamWithOptions(ctx, opts)
+		if err != nil {
+			h.writeError(w, errorStatus(err), err.Error())
+			return
+		}
+
+		if !ok {
+			// WithStreamFallbackToJSON: answer as NewQueryHandler does.
+			content, err := collectStream(ctx, events)
+			if err != nil {
+				setRetryAfter(w, err)
+				h.writeError(w, errorStatus(err), err.Error())
+				return
 			}
-			writeError(w, status, err.Error())
+			h.writeJSON(w, http.StatusOK, queryResponse{
+				Content:   content,
+				SessionID: sessionID,
+			})
 			return
 		}
 
@@ -109,78 +272,456 @@ func NewStreamHandler(client *Client) http.HandlerFunc {
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 		w.WriteHeader(http.StatusOK)
-		flusher.Flush()
-
-		for event := range events {
-			if event.Error != nil {
-				writeSSE(w, flusher, map[string]any{
-					"error":      event.Error.Error(),
-					"session_id": sessionID,
-				})
-				return
+
+		// Confirm the stream is live, and hand out the session ID, before the
+		// model produces its first delta.
+		err = writeSSEEvent(w, flusher.Flush, h.cfg.jsonEncoder, h.cfg.sseFields.error, "open", sseEventID(sessionID, 0), map[string]any{
+			h.cfg.sseFields.sessionID: sessionID,
+		})
+		if err != nil {
+			return
+		}
+
+		err = streamTo(ctx, w, flusher.Flush, events, h.sseFormat(true))
+		if errors.Is(err, context.DeadlineExceeded) && errors.Is(context.Cause(r.Context()), errHandlerTimeout) {
+			// Tell the client why the stream ended before its final event.
+			_ = writeSSE(w, flusher.Flush, h.cfg.jsonEncoder, h.cfg.sseFields.error, map[string]any{
+				h.cfg.sseFields.error:     errHandlerTimeout.Error(),
+				h.cfg.sseFields.sessionID: sessionID,
+			})
+			return
+		}
+		if err != nil && r.Context().Err() == nil {
+			h.cfg.logger.Warn("copilot stream aborted", "session_id", sessionID, "error", err)
+		}
+	})
+}
+
+// collectStream reads events until the stream ends and returns the answer:
+// the final event's content, or the concatenated deltas if that is empty, as
+// with WithStreamSuppressFinalContent.
+func collectStream(ctx context.Context, events <-chan StreamEvent) (string, error) {
+	var deltas strings.Builder
+	for {
+		select {
+		case event, ok := <-events:
+			switch {
+			case !ok:
+				return deltas.String(), nil
+			case event.Error != nil:
+				return "", event.Error
+			case event.IsFinal:
+				if event.Content == "" {
+					return deltas.String(), nil
+				}
+				return event.Content, nil
+			default:
+				deltas.WriteString(event.DeltaContent)
 			}
+		case <-ctx.Done():
+			return "", abortError(ctx)
+		}
+	}
+}
 
-			if event.IsFinal {
-				writeSSE(w, flusher, map[string]any{
-					"content":    event.Content,
-					"session_id": sessionID,
-					"final":      true,
-				})
+// NewHandler returns an http.HandlerFunc that serves both NewQueryHandler and
+// NewStreamHandler on one route, chosen by the optional "stream" field of the
+// JSON body: true streams the answer as Server-Sent Events, false (the
+// default) returns it as a single JSON response. Either way the request is
+// handled exactly as by the selected handler.
+//
+// A streaming request gets the JSON response instead when the ResponseWriter
+// cannot flush, e.g. behind middleware that wraps it without http.Flusher.
+//
+// Since the body is read before it is dispatched, it is limited to 1 MiB;
+// larger bodies get 413 Request Entity Too Large.
+//
+// Example registration:
+//
+//	mux.HandleFunc("POST /api/copilot/chat", copilotcli.NewHandler(client))
+func NewHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	query := queryHandler(h, client)
+	stream := streamHandler(h, client)
+	return RateLimit(h, withJSONContentType(h, h.writeError, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHandlerBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				h.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
 				return
 			}
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		// The selected handler decodes the body again; a body that is not
+		// valid JSON is rejected there.
+		r.Body = io.NopCloser(bytes.NewReader(body))
 
-			writeSSE(w, flusher, map[string]any{
-				"delta":      event.DeltaContent,
-				"session_id": sessionID,
-			})
+		var req queryRequest
+		_ = json.Unmarshal(body, &req)
+		if _, ok := w.(http.Flusher); req.Stream && ok {
+			stream(w, r)
+			return
 		}
-	}
+		query(w, r)
+	}))
+}
+
+// maxHandlerBody is the largest request body NewHandler reads, in bytes.
+const maxHandlerBody = 1 << 20
+
+// NewAbortHandler returns an http.HandlerFunc that accepts POST requests with
+// a JSON body containing a "session_id" field and aborts the message that
+// session is currently processing, e.g. to back a "stop generating" button.
+// The in-flight query or stream for that session ends with an error. Returns
+// 200 with {"status":"aborted","session_id":"..."} on success and 404 if the
+// sidecar does not know the session.
+//
+// Example registration:
+//
+//	mux.HandleFunc("POST /api/copilot/abort", copilotcli.NewAbortHandler(client))
+func NewAbortHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	return withJSONContentType(h, h.writeError, func(w http.ResponseWriter, r *http.Request) {
+		var req abortRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if strings.TrimSpace(req.SessionID) == "" {
+			h.writeError(w, http.StatusBadRequest, "session_id is required")
+			return
+		}
+		if err := h.validateSessionID(req.SessionID); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := client.AbortSession(r.Context(), req.SessionID); err != nil {
+			status := errorStatus(err)
+			if errors.Is(err, ErrSessionNotFound) {
+				status = http.StatusNotFound
+			}
+			h.writeError(w, status, err.Error())
+			return
+		}
+
+		h.writeJSON(w, http.StatusOK, map[string]string{
+			"status":     "aborted",
+			"session_id": req.SessionID,
+		})
+	})
+}
+
+// NewBatchHandler returns an http.HandlerFunc that accepts POST requests with a
+// JSON body containing a "prompts" array, runs them concurrently via
+// Client.QueryBatch, and returns a JSON array of results in the same order.
+//
+// Each prompt runs in its own new session. A request with more prompts than
+// WithMaxBatchSize allows is rejected with 400 Bad Request. Failures are
+// reported per item with an "error" field; the response is 200 as long as the
+// batch ran:
+//
+//	[{"content":"...","session_id":"..."}, {"error":"..."}]
+//
+// Example registration:
+//
+//	mux.HandleFunc("POST /api/copilot/batch", copilotcli.NewBatchHandler(client))
+func NewBatchHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	return RateLimit(h, withJSONContentType(h, h.writeError, func(w http.ResponseWriter, r *http.Request) {
+		var req batchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+
+		if len(req.Prompts) == 0 {
+			h.writeError(w, http.StatusBadRequest, "prompts are required")
+			return
+		}
+
+		if err := h.checkBatchSize(len(req.Prompts)); err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		results, err := client.QueryBatch(r.Context(), req.Prompts)
+		var batchErr *BatchError
+		if err != nil && !errors.As(err, &batchErr) {
+			h.writeError(w, errorStatus(err), err.Error())
+			return
+		}
+
+		items := make([]batchItem, len(req.Prompts))
+		for i := range items {
+			if batchErr != nil && batchErr.Errors[i] != nil {
+				items[i].Error = batchErr.Errors[i].Error()
+				continue
+			}
+			items[i].Content = results[i].Content
+			items[i].SessionID = results[i].SessionID
+		}
+
+		h.writeJSON(w, http.StatusOK, items)
+	}))
 }
 
 // NewHealthHandler returns an http.HandlerFunc that reports the sidecar health.
-// Returns 200 if connected and responsive, 503 otherwise.
+// Returns 200 if connected and responsive, 503 otherwise. The sidecar must
+// answer within the timeout set by WithPingTimeout.
 //
 // Example registration:
 //
 //	mux.HandleFunc("GET /api/copilot/health", copilotcli.NewHealthHandler(client))
-func NewHealthHandler(client *Client) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func NewHealthHandler(client CopilotClient) http.HandlerFunc {
+	return healthHandler(handlerClient(client), client)
+}
+
+// healthHandler is NewHealthHandler for the handler client h, which
+// NewHealthHandlerWithOptions has already resolved.
+func healthHandler(h *Client, client CopilotClient) http.HandlerFunc {
+	return withCompression(h, func(w http.ResponseWriter, r *http.Request) {
 		if err := client.Ping(r.Context()); err != nil {
-			writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			h.writeJSON(w, http.StatusServiceUnavailable, map[string]string{
 				"status": "unhealthy",
 				"error":  err.Error(),
 			})
 			return
 		}
 
-		writeJSON(w, http.StatusOK, map[string]string{
+		h.writeJSON(w, http.StatusOK, map[string]string{
 			"status": "healthy",
 		})
+	})
+}
+
+// configResponse is the JSON body of the config handler. It must never carry
+// secrets such as the provider API key.
+type configResponse struct {
+	Model        string `json:"model"`
+	CLIURL       string `json:"cli_url,omitempty"`
+	LogLevel     string `json:"log_level,omitempty"`
+	AuthMode     string `json:"auth_mode,omitempty"`
+	Streaming    *bool  `json:"streaming,omitempty"`
+	ProviderType string `json:"provider_type,omitempty"`
+}
+
+// NewConfigHandler returns an http.HandlerFunc that reports the client's
+// effective, non-secret configuration. The provider API key is never
+// included. It always returns 200, since it does not depend on the sidecar:
+//
+//	{"model":"gpt-4o","cli_url":"localhost:4321","log_level":"error","auth_mode":"github","streaming":false,"provider_type":"openai"}
+//
+// Beyond the model, a CopilotClient other than *Client reports only the
+// settings it exposes through the optional CLIURL, LogLevel, AuthMode,
+// Streaming, and ProviderType methods of *Client; the others are omitted.
+//
+// Example registration:
+//
+//	mux.HandleFunc("GET /api/copilot/config", copilotcli.NewConfigHandler(client))
+func NewConfigHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	return func(w http.ResponseWriter, _ *http.Request) {
+		resp := configResponse{Model: client.Model()}
+		if c, ok := client.(interface{ CLIURL() string }); ok {
+			resp.CLIURL = c.CLIURL()
+		}
+		if c, ok := client.(interface{ LogLevel() string }); ok {
+			resp.LogLevel = c.LogLevel()
+		}
+		if c, ok := client.(interface{ AuthMode() AuthMode }); ok {
+			resp.AuthMode = string(c.AuthMode())
+		}
+		if c, ok := client.(interface{ Streaming() bool }); ok {
+			streaming := c.Streaming()
+			resp.Streaming = &streaming
+		}
+		if c, ok := client.(interface{ ProviderType() ProviderType }); ok {
+			resp.ProviderType = string(c.ProviderType())
+		}
+		h.writeJSON(w, http.StatusOK, resp)
 	}
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
-	body, err := json.Marshal(v)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+// healthDetail is the JSON body of the detailed health handler.
+type healthDetail struct {
+	Status        string   `json:"status"`
+	Error         string   `json:"error,omitempty"`
+	PingMS        float64  `json:"ping_ms"`
+	Model         string   `json:"model"`
+	UptimeSeconds *float64 `json:"uptime_seconds,omitempty"`
+	InFlight      *int     `json:"in_flight,omitempty"`
+}
+
+// NewHealthHandlerWithOptions is NewHealthHandler with an optional detailed
+// mode. When detailed is true, the response also reports the ping round-trip
+// time, the configured model, how long the client has been connected, and the
+// number of queries currently running (see Client.InFlight):
+//
+//	{"status":"healthy","ping_ms":1.8,"model":"gpt-4o","uptime_seconds":3600,"in_flight":2}
+//
+// Failures return 503 with the same fields plus "error". Given a
+// CopilotClient other than *Client, "uptime_seconds" is omitted, and so is
+// "in_flight" unless it has an InFlight() int method.
+//
+// Example registration:
+//
+//	mux.HandleFunc("GET /api/copilot/health", copilotcli.NewHealthHandlerWithOptions(client, true))
+func NewHealthHandlerWithOptions(client CopilotClient, detailed bool) http.HandlerFunc {
+	h := handlerClient(client)
+	if !detailed {
+		return healthHandler(h, client)
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(status)
-	_, _ = w.Write(body)
+	return withCompression(h, func(w http.ResponseWriter, r *http.Request) {
+		start := h.cfg.clock.Now()
+		err := client.Ping(r.Context())
+		rtt := h.cfg.clock.Now().Sub(start)
+
+		detail := healthDetail{
+			Status: "healthy",
+			PingMS: float64(rtt.Microseconds()) / 1000,
+			Model:  client.Model(),
+		}
+		if c, ok := client.(*Client); ok {
+			uptime := c.uptime().Seconds()
+			detail.UptimeSeconds = &uptime
+		}
+		if c, ok := client.(interface{ InFlight() int }); ok {
+			inFlight := c.InFlight()
+			detail.InFlight = &inFlight
+		}
+		status := http.StatusOK
+		if err != nil {
+			detail.Status = "unhealthy"
+			detail.Error = err.Error()
+			status = http.StatusServiceUnavailable
+		}
+		h.writeJSON(w, status, detail)
+	})
+}
+
+// defaultRoutePrefix is the path prefix NewServeMux uses when none is given.
+const defaultRoutePrefix = "/api/copilot"
+
+// NewServeMux returns a new http.ServeMux with the standard routes registered
+// under prefix:
+//
+//	POST {prefix}/query   NewQueryHandler
+//	POST {prefix}/stream  NewStreamHandler
+//	GET  {prefix}/stream  NewStreamHandler (EventSource-friendly)
+//	GET  {prefix}/health  NewHealthHandler
+//	POST {prefix}/abort   NewAbortHandler
+//
+// An empty prefix defaults to "/api/copilot"; a trailing slash is ignored.
+// Mount the mux directly, or on a parent mux with mux.Handle(prefix+"/", m).
+func NewServeMux(client CopilotClient, prefix string) *http.ServeMux {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		prefix = defaultRoutePrefix
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+prefix+"/query", NewQueryHandler(client))
+	stream := NewStreamHandler(client)
+	mux.HandleFunc("POST "+prefix+"/stream", stream)
+	mux.HandleFunc("GET "+prefix+"/stream", stream)
+	mux.HandleFunc("GET "+prefix+"/health", NewHealthHandler(client))
+	mux.HandleFunc("POST "+prefix+"/abort", NewAbortHandler(client))
+	return mux
 }
 
-func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, errorResponse{Error: msg})
+// errHandlerTimeout is the cancellation cause when WithHandlerTimeout fires.
+var errHandlerTimeout = errors.New("handler timeout exceeded")
+
+// withHandlerTimeout bounds the request context by WithHandlerTimeout. When
+// the deadline fires, the in-flight query is aborted; errorStatus reports it
+// as 504 Gateway Timeout.
+func withHandlerTimeout(client *Client, next http.HandlerFunc) http.HandlerFunc {
+	d := client.cfg.handlerTimeout
+	if d <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeoutCause(r.Context(), d, errHandlerTimeout)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
 }
 
-func writeSSE(w http.ResponseWriter, flusher http.Flusher, data any) {
-	body, err := json.Marshal(data)
+// withJSONContentType rejects requests whose Content-Type is not
+// application/json with 415 Unsupported Media Type, reported by writeError,
+// when WithStrictContentType is set.
+func withJSONContentType(client *Client, writeError func(http.ResponseWriter, int, string), next http.HandlerFunc) http.HandlerFunc {
+	if !client.cfg.strictJSON {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// A GET request carries no body to check.
+			next(w, r)
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rateLimitRetryAfter is the Retry-After advice, in seconds, for queries the
+// provider rate-limited. The sidecar does not pass on the provider's own hint.
+const rateLimitRetryAfter = 5
+
+// setRetryAfter sets the Retry-After header when err is a provider rate limit.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrRateLimited) {
+		w.Header().Set("Retry-After", strconv.Itoa(rateLimitRetryAfter))
+	}
+}
+
+// errorStatus maps a client error to the HTTP status reported to callers.
+func errorStatus(err error) int {
+	if errors.Is(err, ErrInvalidProviderOverride) || errors.Is(err, ErrInvalidSessionID) || errors.Is(err, ErrEmptyModel) ||
+		errors.Is(err, ErrBatchTooLarge) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, ErrContextTooLong) || errors.Is(err, ErrPromptTooLong) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrFirstTokenTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, ErrNotConnected) || errors.Is(err, ErrSidecarUnavailable) || errors.Is(err, ErrTooManySessions) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON writes v as the JSON response body, encoded with the client's
+// WithJSONEncoder encoder. If encoding fails, it responds 500 with no body.
+func (c *Client) writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := c.cfg.jsonEncoder(v)
 	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	_, _ = fmt.Fprintf(w, "data: %s\n\n", body)
-	flusher.Flush()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func (c *Client) writeError(w http.ResponseWriter, status int, msg string) {
+	c.writeJSON(w, status, errorResponse{Error: msg})
 }
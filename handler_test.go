@@ -2,12 +2,19 @@ package copilotcli
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	copilot "github.com/github/copilot-sdk/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -129,6 +136,58 @@ func TestNewStreamHandler(t *testing.T) {
 	})
 }
 
+func TestNewStreamHandler_GET(t *testing.T) {
+	var prompts []string
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			sess := providerSession("new-sess", "hi", "")
+			send := sess.sendFn
+			sess.sendFn = func(ctx context.Context, msg copilot.MessageOptions) (string, error) {
+				prompts = append(prompts, msg.Prompt)
+				return send(ctx, msg)
+			}
+			return sess, nil
+		},
+		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+			return providerSession(sessionID, "welcome back", ""), nil
+		},
+	}
+	client := newTestClient(mock, WithStrictContentType(true))
+	handler := NewStreamHandler(client)
+
+	t.Run("reads the prompt from the query string", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/copilot/stream?prompt=Hello+there", nil)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, "no JSON Content-Type is needed")
+		assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), `"content":"hi"`)
+		assert.Equal(t, []string{"Hello there"}, prompts)
+	})
+
+	t.Run("resumes session_id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/copilot/stream?prompt=again&session_id=old-sess", nil)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "id: old-sess:0\nevent: open\n")
+		assert.Contains(t, rec.Body.String(), `"content":"welcome back"`)
+	})
+
+	t.Run("requires a prompt", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/copilot/stream?session_id=old-sess", nil)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
 // nonFlushableWriter is an http.ResponseWriter that does NOT implement http.Flusher.
 type nonFlushableWriter struct {
 	header     http.Header
@@ -140,6 +199,45 @@ func (w *nonFlushableWriter) Header() http.Header         { return w.header }
 func (w *nonFlushableWriter) WriteHeader(statusCode int)  { w.statusCode = statusCode }
 func (w *nonFlushableWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
 
+func TestWithStreamFallbackToJSON(t *testing.T) {
+	newClient := func(reply, errMsg string, opts ...Option) *Client {
+		return newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+				return providerSession("s1", reply, errMsg), nil
+			},
+		}, opts...)
+	}
+	post := func(client *Client) *nonFlushableWriter {
+		rec := &nonFlushableWriter{header: make(http.Header)}
+		NewStreamHandler(client)(rec, httptest.NewRequest(http.MethodPost, "/api/copilot/stream", bytes.NewReader([]byte(testPromptBody))))
+		return rec
+	}
+
+	t.Run("buffers the stream as JSON", func(t *testing.T) {
+		rec := post(newClient("hi there", "", WithStreamFallbackToJSON(true)))
+
+		assert.Equal(t, http.StatusOK, rec.statusCode)
+		assert.Equal(t, "application/json; charset=utf-8", rec.header.Get("Content-Type"))
+		assert.JSONEq(t, `{"content":"hi there","session_id":"s1"}`, rec.body.String())
+	})
+
+	t.Run("reports a stream error as JSON", func(t *testing.T) {
+		rec := post(newClient("", "model unavailable", WithStreamFallbackToJSON(true)))
+
+		assert.Equal(t, http.StatusInternalServerError, rec.statusCode)
+		var resp errorResponse
+		require.NoError(t, json.Unmarshal(rec.body.Bytes(), &resp))
+		assert.Contains(t, resp.Error, "model unavailable")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		rec := post(newClient("hi there", ""))
+
+		assert.Equal(t, http.StatusInternalServerError, rec.statusCode)
+		assert.JSONEq(t, `{"error":"streaming not supported"}`, rec.body.String())
+	})
+}
+
 func TestNewHealthHandler(t *testing.T) {
 	client, err := New()
 	require.NoError(t, err)
@@ -161,11 +259,262 @@ func TestNewHealthHandler(t *testing.T) {
 	})
 }
 
+func TestNewHealthHandlerWithOptions(t *testing.T) {
+	t.Run("detailed healthy", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{}, WithModel("gpt-5"))
+		client.connectedAt = time.Now().Add(-90 * time.Second)
+		handler := NewHealthHandlerWithOptions(client, true)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp healthDetail
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "healthy", resp.Status)
+		assert.Equal(t, "gpt-5", resp.Model)
+		require.NotNil(t, resp.UptimeSeconds)
+		assert.GreaterOrEqual(t, *resp.UptimeSeconds, 90.0)
+		assert.GreaterOrEqual(t, resp.PingMS, 0.0)
+		require.NotNil(t, resp.InFlight)
+		assert.Zero(t, *resp.InFlight)
+		assert.Empty(t, resp.Error)
+	})
+
+	t.Run("detailed unhealthy keeps the shape", func(t *testing.T) {
+		client, err := New()
+		require.NoError(t, err)
+		handler := NewHealthHandlerWithOptions(client, true)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "unhealthy", resp["status"])
+		assert.NotEmpty(t, resp["error"])
+		assert.Contains(t, resp, "ping_ms")
+		assert.Contains(t, resp, "uptime_seconds")
+		assert.Contains(t, resp, "in_flight")
+		assert.Equal(t, "gpt-4o", resp["model"])
+	})
+
+	t.Run("omits what a fake cannot report", func(t *testing.T) {
+		handler := NewHealthHandlerWithOptions(&staticCopilotClient{}, true)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "fake-model", resp["model"])
+		assert.NotContains(t, resp, "uptime_seconds")
+		assert.NotContains(t, resp, "in_flight")
+	})
+
+	t.Run("simple mode", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{})
+		handler := NewHealthHandlerWithOptions(client, false)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/api/copilot/health", http.NoBody))
+
+		assert.JSONEq(t, `{"status":"healthy"}`, rec.Body.String())
+	})
+}
+
+func TestNewConfigHandler(t *testing.T) {
+	client, err := New(
+		WithModel("gpt-5"),
+		WithStreaming(true),
+		WithBYOK(ProviderAzure, "https://example.openai.azure.com", "super-secret-key"),
+	)
+	require.NoError(t, err)
+	handler := NewConfigHandler(client)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/api/copilot/config", http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"model": "gpt-5",
+		"cli_url": "localhost:4321",
+		"log_level": "error",
+		"auth_mode": "byok",
+		"streaming": true,
+		"provider_type": "azure"
+	}`, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), "super-secret-key")
+	assert.NotContains(t, rec.Body.String(), "example.openai.azure.com")
+
+	t.Run("other CopilotClient", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewConfigHandler(&staticCopilotClient{})(rec, httptest.NewRequest(http.MethodGet, "/api/copilot/config", http.NoBody))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"model":"fake-model"}`, rec.Body.String(), "no configuration is made up")
+	})
+}
+
+// staticCopilotClient is a healthy CopilotClient exposing only the interface.
+type staticCopilotClient struct {
+	CopilotClient
+}
+
+func (*staticCopilotClient) Ping(context.Context) error { return nil }
+
+func (*staticCopilotClient) Model() string { return "fake-model" }
+
+func TestNewAbortHandler(t *testing.T) {
+	var aborted []string
+	mock := &mockSDKClient{
+		resumeFn: func(_ context.Context, id string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+			if id != "sess-1" {
+				return nil, fmt.Errorf("resuming %s: %w", id, ErrSessionNotFound)
+			}
+			return &mockSDKSession{id: id, abortFn: func(context.Context) error {
+				aborted = append(aborted, id)
+				return nil
+			}}, nil
+		},
+	}
+	handler := NewAbortHandler(newTestClient(mock))
+
+	t.Run("aborts the session", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/copilot/abort", bytes.NewReader([]byte(`{"session_id":"sess-1"}`))))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"aborted","session_id":"sess-1"}`, rec.Body.String())
+		assert.Equal(t, []string{"sess-1"}, aborted)
+	})
+
+	t.Run("unknown session is 404", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/copilot/abort", bytes.NewReader([]byte(`{"session_id":"gone"}`))))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("rejects missing session_id", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, "/api/copilot/abort", bytes.NewReader([]byte(`{}`))))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		var resp errorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "session_id is required", resp.Error)
+	})
+
+	t.Run("returns 503 when not connected", func(t *testing.T) {
+		client, err := New()
+		require.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		NewAbortHandler(client)(rec, httptest.NewRequest(http.MethodPost, "/api/copilot/abort", bytes.NewReader([]byte(`{"session_id":"sess-1"}`))))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
+
+func TestNewServeMux(t *testing.T) {
+	client := newTestClient(&mockSDKClient{})
+
+	tests := []struct {
+		name   string
+		prefix string
+		method string
+		path   string
+		want   int
+	}{
+		{"default prefix health", "", http.MethodGet, "/api/copilot/health", http.StatusOK},
+		{"custom prefix health", "/v1/llm/", http.MethodGet, "/v1/llm/health", http.StatusOK},
+		{"query route", "/v1/llm", http.MethodPost, "/v1/llm/query", http.StatusBadRequest},
+		{"stream route", "/v1/llm", http.MethodPost, "/v1/llm/stream", http.StatusBadRequest},
+		{"stream GET route", "/v1/llm", http.MethodGet, "/v1/llm/stream", http.StatusBadRequest},
+		{"abort route", "/v1/llm", http.MethodPost, "/v1/llm/abort", http.StatusBadRequest},
+		{"wrong method", "", http.MethodGet, "/api/copilot/query", http.StatusMethodNotAllowed},
+		{"unknown route", "", http.MethodGet, "/api/copilot/other", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := NewServeMux(client, tt.prefix)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte("{}"))))
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func validateUUID(id string) error {
+	if !uuidPattern.MatchString(id) {
+		return errors.New("must be a lowercase UUID")
+	}
+	return nil
+}
+
+func TestWithSessionIDValidator(t *testing.T) {
+	const validID = "0b6f1c9e-4a5d-4f3b-9c1e-2d7a8b9c0d1e"
+	var resumed []string
+	mock := &mockSDKClient{
+		resumeFn: func(_ context.Context, id string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+			resumed = append(resumed, id)
+			return providerSession(id, "ok", ""), nil
+		},
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession(validID, "ok", ""), nil
+		},
+	}
+	client := newTestClient(mock, WithSessionIDValidator(validateUUID))
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		body    string
+		want    int
+	}{
+		{"query accepts a UUID", NewQueryHandler(client), "/query", `{"prompt":"hi","session_id":"` + validID + `"}`, http.StatusOK},
+		{"query accepts a new session", NewQueryHandler(client), "/query", `{"prompt":"hi"}`, http.StatusOK},
+		{"query rejects a non-UUID", NewQueryHandler(client), "/query", `{"prompt":"hi","session_id":"../admin"}`, http.StatusBadRequest},
+		{"stream rejects a non-UUID", NewStreamHandler(client), "/stream", `{"prompt":"hi","session_id":"probe-1"}`, http.StatusBadRequest},
+		{"abort rejects a non-UUID", NewAbortHandler(client), "/abort", `{"session_id":"probe-1"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader([]byte(tt.body))))
+
+			assert.Equal(t, tt.want, rec.Code)
+			if tt.want == http.StatusBadRequest {
+				assert.Contains(t, rec.Body.String(), "invalid session ID: must be a lowercase UUID")
+			}
+		})
+	}
+	assert.Equal(t, []string{validID}, resumed, "rejected IDs never reach the sidecar")
+
+	_, err := client.QueryWithSession(t.Context(), "DROP TABLE", "hi")
+	require.ErrorIs(t, err, ErrInvalidSessionID)
+	require.ErrorIs(t, client.DestroySession(t.Context(), "DROP TABLE"), ErrInvalidSessionID)
+	assert.Len(t, resumed, 1)
+
+	_, err = New(WithSessionIDValidator(nil))
+	require.Error(t, err)
+}
+
 func TestWriteJSON(t *testing.T) {
+	client := newTestClient(&mockSDKClient{})
+
 	t.Run("writes valid JSON with correct content type", func(t *testing.T) {
 		rec := httptest.NewRecorder()
 
-		writeJSON(rec, http.StatusOK, map[string]string{"key": "value"})
+		client.writeJSON(rec, http.StatusOK, map[string]string{"key": "value"})
 
 		assert.Equal(t, http.StatusOK, rec.Code)
 		assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
@@ -180,10 +529,31 @@ func TestWriteJSON(t *testing.T) {
 		rec := httptest.NewRecorder()
 
 		// math.NaN() cannot be marshaled to JSON
-		writeJSON(rec, http.StatusOK, math.NaN())
+		client.writeJSON(rec, http.StatusOK, math.NaN())
 
 		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
+
+	t.Run("uses the configured encoder", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{}, WithJSONEncoder(func(v any) ([]byte, error) {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			err := enc.Encode(v)
+			return bytes.TrimRight(buf.Bytes(), "\n"), err
+		}))
+		rec := httptest.NewRecorder()
+
+		client.writeJSON(rec, http.StatusOK, map[string]string{"html": "<b>&</b>"})
+
+		assert.JSONEq(t, `{"html":"<b>&</b>"}`, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), "<b>&</b>", "HTML is not escaped")
+	})
+}
+
+func TestWithJSONEncoder_Validation(t *testing.T) {
+	_, err := New(WithJSONEncoder(nil))
+	require.Error(t, err)
 }
 
 func TestNewQueryHandler_InternalError(t *testing.T) {
@@ -227,7 +597,7 @@ func TestNewStreamHandler_InternalError(t *testing.T) {
 func TestWriteError(t *testing.T) {
 	rec := httptest.NewRecorder()
 
-	writeError(rec, http.StatusBadRequest, "something went wrong")
+	newTestClient(&mockSDKClient{}).writeError(rec, http.StatusBadRequest, "something went wrong")
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 
@@ -240,9 +610,8 @@ func TestWriteError(t *testing.T) {
 func TestWriteSSE(t *testing.T) {
 	t.Run("writes SSE event with data prefix", func(t *testing.T) {
 		rec := httptest.NewRecorder()
-		flusher := rec // httptest.ResponseRecorder implements http.Flusher
 
-		writeSSE(rec, flusher, map[string]string{"delta": "hello"})
+		require.NoError(t, writeSSE(rec, rec.Flush, json.Marshal, "error", map[string]string{"delta": "hello"}))
 
 		body := rec.Body.String()
 		assert.Contains(t, body, "data: ")
@@ -250,14 +619,299 @@ func TestWriteSSE(t *testing.T) {
 		assert.NotEmpty(t, body)
 	})
 
-	t.Run("handles unmarshalable data gracefully", func(t *testing.T) {
+	t.Run("reports unmarshalable data as an error event", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		err := writeSSE(rec, rec.Flush, json.Marshal, "error", math.NaN())
+
+		require.Error(t, err)
+		assert.Equal(t, "data: {\"error\":\"serialization failed\"}\n\n", rec.Body.String())
+		assert.True(t, rec.Flushed)
+	})
+
+	t.Run("reports the failure under the configured error field", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+
+		err := writeSSE(rec, rec.Flush, json.Marshal, "failure", math.NaN())
+
+		require.Error(t, err)
+		assert.Equal(t, "data: {\"failure\":\"serialization failed\"}\n\n", rec.Body.String())
+	})
+}
+
+func TestQueryHandlers_RequestOverrides(t *testing.T) {
+	var gotModel string
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			gotModel = cfg.Model
+			return providerSession("s1", "ok", ""), nil
+		},
+	}
+	client := newTestClient(mock)
+
+	handlers := map[string]http.HandlerFunc{
+		"query":  NewQueryHandler(client),
+		"stream": NewStreamHandler(client),
+	}
+	for name, handler := range handlers {
+		t.Run(name+" applies model", func(t *testing.T) {
+			gotModel = ""
+			body := `{"prompt": "hi", "model": "claude-sonnet-4"}`
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body))))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "claude-sonnet-4", gotModel)
+		})
+
+		t.Run(name+" falls back to client model", func(t *testing.T) {
+			gotModel = ""
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(testPromptBody))))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "gpt-4o", gotModel)
+		})
+
+		invalid := []struct {
+			body string
+			want string
+		}{
+			{`{"prompt": "hi", "temperature": 0.2}`, "temperature is not supported by the sidecar"},
+			{`{"prompt": "hi", "temperature": 0}`, "temperature is not supported by the sidecar"},
+			{`{"prompt": "hi", "max_tokens": 512}`, "max_tokens is not supported by the sidecar"},
+			{`{"prompt": "hi", "model": "  "}`, ErrEmptyModel.Error()},
+		}
+		for _, tt := range invalid {
+			t.Run(name+" rejects "+tt.body, func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(tt.body))))
+
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+				var resp errorResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, tt.want, resp.Error)
+			})
+		}
+	}
+}
+
+func TestQueryHandlers_RateLimited(t *testing.T) {
+	client := newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("s-limited", "", "429 Too Many Requests"), nil
+		},
+	})
+
+	t.Run("query", func(t *testing.T) {
 		rec := httptest.NewRecorder()
-		flusher := rec
+		NewQueryHandler(client)(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(testPromptBody))))
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+		var resp errorResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "copilot: 429 Too Many Requests", resp.Error)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewStreamHandler(client)(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(testPromptBody))))
+
+		assert.Equal(t, http.StatusOK, rec.Code, "the stream had started before the provider failed")
+		assert.Contains(t, rec.Body.String(),
+			`data: {"error":"copilot: 429 Too Many Requests","retry_after":5,"session_id":"s-limited","status":429}`)
+	})
+}
+
+// fakeCopilotClient is a CopilotClient test double; methods that are not
+// overridden panic through the nil embedded interface.
+type fakeCopilotClient struct {
+	CopilotClient
+	query  func(QueryOptions) (*QueryResult, error)
+	stream func(QueryOptions) (<-chan StreamEvent, string, error)
+}
+
+func (f *fakeCopilotClient) QueryWithOptions(_ context.Context, opts QueryOptions) (*QueryResult, error) {
+	return f.query(opts)
+}
+
+func (f *fakeCopilotClient) QueryStreamWithOptions(_ context.Context, opts QueryOptions) (<-chan StreamEvent, string, error) {
+	return f.stream(opts)
+}
+
+func TestHandlers_FakeClient(t *testing.T) {
+	fake := &fakeCopilotClient{
+		query: func(opts QueryOptions) (*QueryResult, error) {
+			if opts.Prompt == "fail" {
+				return nil, ErrNotConnected
+			}
+			return &QueryResult{Content: "echo: " + opts.Prompt, SessionID: "fake-sess"}, nil
+		},
+		stream: func(opts QueryOptions) (<-chan StreamEvent, string, error) {
+			events := make(chan StreamEvent, 2)
+			events <- StreamEvent{DeltaContent: opts.Prompt, SessionID: "fake-sess"}
+			events <- StreamEvent{Content: opts.Prompt, IsFinal: true, SessionID: "fake-sess"}
+			close(events)
+			return events, "fake-sess", nil
+		},
+	}
+
+	t.Run("query", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewQueryHandler(fake)(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(testPromptBody))))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"content":"echo: hello","session_id":"fake-sess"}`, rec.Body.String())
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewQueryHandler(fake)(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"prompt":"fail"}`))))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewStreamHandler(fake)(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(testPromptBody))))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"delta":"hello"`)
+		assert.Contains(t, rec.Body.String(), `"final":true`)
+	})
+}
+
+func TestNewHandler(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("s1", "hi", ""), nil
+		},
+	}
+	handler := NewHandler(newTestClient(mock))
+
+	post := func(w http.ResponseWriter, body string) {
+		handler(w, httptest.NewRequest(http.MethodPost, "/api/copilot/chat", bytes.NewReader([]byte(body))))
+	}
+
+	t.Run("stream true", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		post(rec, `{"prompt":"hello","stream":true}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "event: open\n")
+		assert.Contains(t, rec.Body.String(), `"content":"hi"`)
+	})
+
+	t.Run("stream false", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		post(rec, `{"prompt":"hello","stream":false}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"content":"hi","session_id":"s1"}`, rec.Body.String())
+	})
+
+	t.Run("stream defaults to false", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		post(rec, testPromptBody)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"content":"hi","session_id":"s1"}`, rec.Body.String())
+	})
+
+	t.Run("stream without a Flusher is buffered", func(t *testing.T) {
+		rec := &nonFlushableWriter{header: make(http.Header)}
+		post(rec, `{"prompt":"hello","stream":true}`)
+
+		assert.Equal(t, http.StatusOK, rec.statusCode)
+		assert.JSONEq(t, `{"content":"hi","session_id":"s1"}`, rec.body.String())
+	})
+
+	t.Run("rejects invalid JSON", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		post(rec, "{bad")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"error":"invalid request body"}`, rec.Body.String())
+	})
+
+	t.Run("rejects an oversized body", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		post(rec, `{"prompt":"`+strings.Repeat("x", maxHandlerBody)+`"}`)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.JSONEq(t, `{"error":"request body too large"}`, rec.Body.String())
+	})
+
+	t.Run("checks before reading the body", func(t *testing.T) {
+		do := func(handler http.HandlerFunc, contentType string) int {
+			req := httptest.NewRequest(http.MethodPost, "/api/copilot/chat", bytes.NewReader([]byte(`{"prompt":"hello","stream":true}`)))
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			return rec.Code
+		}
+
+		limited := NewHandler(newTestClient(mock, WithRateLimit(0.001, 2)))
+		assert.Equal(t, http.StatusOK, do(limited, "application/json"))
+		assert.Equal(t, http.StatusOK, do(limited, "application/json"), "each request takes one token")
+		assert.Equal(t, http.StatusTooManyRequests, do(limited, "application/json"))
+
+		strict := NewHandler(newTestClient(mock, WithStrictContentType(true)))
+		assert.Equal(t, http.StatusUnsupportedMediaType, do(strict, "text/plain"))
+		assert.Equal(t, http.StatusOK, do(strict, "application/json"))
+	})
+}
+
+func TestWithStrictContentType(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return providerSession("s1", "ok", ""), nil
+		},
+	}
+
+	post := func(handler http.HandlerFunc, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/copilot/query", bytes.NewReader([]byte(testPromptBody)))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		client := newTestClient(mock, WithStrictContentType(true))
+		handlers := map[string]http.HandlerFunc{
+			"query":     NewQueryHandler(client),
+			"stream":    NewStreamHandler(client),
+			"batch":     NewBatchHandler(client),
+			"abort":     NewAbortHandler(client),
+			"anthropic": NewAnthropicMessagesHandler(client),
+		}
+		for name, handler := range handlers {
+			for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded", "application/json-patch+json"} {
+				rec := post(handler, contentType)
+				assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code, "%s with %q", name, contentType)
+			}
+		}
+
+		rec := post(NewAnthropicMessagesHandler(client), "text/plain")
+		assert.Contains(t, rec.Body.String(), `"type":"invalid_request_error"`)
+
+		for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "Application/JSON"} {
+			rec := post(handlers["query"], contentType)
+			assert.Equal(t, http.StatusOK, rec.Code, contentType)
+		}
+	})
 
-		// Should not panic; json.Marshal will fail silently.
-		writeSSE(rec, flusher, math.NaN())
+	t.Run("lenient by default", func(t *testing.T) {
+		handler := NewQueryHandler(newTestClient(mock))
 
-		// Nothing should be written since marshal failed.
-		assert.Empty(t, rec.Body.String())
+		for _, contentType := range []string{"", "text/plain", "application/json"} {
+			rec := post(handler, contentType)
+			assert.Equal(t, http.StatusOK, rec.Code, contentType)
+		}
 	})
 }
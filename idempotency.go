@@ -0,0 +1,203 @@
+package copilotcli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotencyHeader is the request header that identifies a retried request.
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyCache remembers query handler responses by Idempotency-Key so
+// retried requests are answered without querying the model again. Keys are
+// scoped to the caller, as grouped for rate limiting, so callers cannot read
+// each other's responses by guessing keys.
+type idempotencyCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+// idempotencyEntry is a cached response. done is closed once the first request
+// with the key has finished; until then, replays wait on it. bodyHash is the
+// SHA-256 of that request's body.
+type idempotencyEntry struct {
+	done        chan struct{}
+	bodyHash    [sha256.Size]byte
+	expires     time.Time
+	status      int
+	contentType string
+	body        []byte
+}
+
+func newIdempotencyCache(ttl time.Duration, now func() time.Time) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		now:     now,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// claim returns the entry for key and whether the caller owns it (i.e., must
+// run the request and call complete or abandon). A new entry records
+// bodyHash; an existing one keeps the hash of the request that created it.
+func (c *idempotencyCache) claim(key string, bodyHash [sha256.Size]byte) (*idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.sweep(now)
+
+	if e, ok := c.entries[key]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+
+	e := &idempotencyEntry{done: make(chan struct{}), bodyHash: bodyHash}
+	c.entries[key] = e
+	return e, true
+}
+
+// complete stores the response for replays and wakes any waiting requests.
+func (c *idempotencyCache) complete(e *idempotencyEntry, status int, contentType string, body []byte) {
+	c.mu.Lock()
+	e.status = status
+	e.contentType = contentType
+	e.body = body
+	e.expires = c.now().Add(c.ttl)
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// abandon forgets the entry for key so the next request with it runs again.
+// Waiting requests are released and run the request themselves.
+func (c *idempotencyCache) abandon(key string, e *idempotencyEntry) {
+	c.mu.Lock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// sweep evicts expired entries. Callers must hold c.mu.
+func (c *idempotencyCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+
+	for key, e := range c.entries {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// responseCapture records the status and body written by a handler while
+// passing them through to the client.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(status int) {
+	rc.status = status
+	rc.ResponseWriter.WriteHeader(status)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	if rc.status == 0 {
+		rc.status = http.StatusOK
+	}
+	rc.body.Write(b)
+	return rc.ResponseWriter.Write(b)
+}
+
+// withIdempotency replays the cached response for requests carrying an
+// Idempotency-Key already seen within the TTL set by WithIdempotencyTTL.
+// A request arriving while the first one with the same key is still running
+// waits for its result. Server errors (5xx) and rate limits (429) are not
+// cached, so clients can retry them. Requests without the header are not affected.
+//
+// Keys are scoped by the WithRateLimitKey function (client IP by default), and
+// reusing a key with a different request body gets 422 Unprocessable Entity.
+// To compare bodies, requests with the header have them read up front, limited
+// like NewHandler's.
+func withIdempotency(client *Client, next http.HandlerFunc) http.HandlerFunc {
+	cache := client.idempotency
+	if cache == nil {
+		return next
+	}
+	scope := client.cfg.rateLimitKey
+	if scope == nil {
+		scope = clientIPKey
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(idempotencyHeader)
+		if header == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHandlerBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				client.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			client.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		bodyHash := sha256.Sum256(body)
+		key := scope(r) + "\x00" + header
+
+		for {
+			entry, owner := cache.claim(key, bodyHash)
+			if owner {
+				rc := &responseCapture{ResponseWriter: w}
+				next(rc, r)
+				if rc.status >= http.StatusInternalServerError || rc.status == http.StatusTooManyRequests || rc.status == 0 {
+					cache.abandon(key, entry)
+					return
+				}
+				cache.complete(entry, rc.status, rc.Header().Get("Content-Type"), rc.body.Bytes())
+				return
+			}
+			if entry.bodyHash != bodyHash {
+				client.writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+				return
+			}
+
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+
+			// An abandoned entry has no response; try to claim the key again.
+			if entry.status == 0 {
+				continue
+			}
+
+			if entry.contentType != "" {
+				w.Header().Set("Content-Type", entry.contentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.status)
+			_, _ = w.Write(entry.body)
+			return
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package copilotcli
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithIdempotency_ReplaysResponse(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithIdempotencyTTL(time.Minute))
+	var calls atomic.Int32
+	handler := withIdempotency(client, func(w http.ResponseWriter, _ *http.Request) {
+		n := calls.Add(1)
+		client.writeJSON(w, http.StatusCreated, map[string]int32{"call": n})
+	})
+
+	do := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testPromptBody))
+		if key != "" {
+			req.Header.Set(idempotencyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	first := do("key-1")
+	replay := do("key-1")
+	assert.Equal(t, http.StatusCreated, replay.Code)
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", replay.Header().Get("Content-Type"))
+	assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(1), calls.Load())
+
+	do("key-2")
+	do("")
+	do("")
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestWithIdempotency_ServerErrorsNotCached(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithIdempotencyTTL(time.Minute))
+	var calls atomic.Int32
+	handler := withIdempotency(client, func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		client.writeError(w, http.StatusServiceUnavailable, "unavailable")
+	})
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+		req.Header.Set(idempotencyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestWithIdempotency_RateLimitNotCached(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithIdempotencyTTL(time.Minute))
+	var calls atomic.Int32
+	handler := withIdempotency(client, func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			setRetryAfter(w, ErrRateLimited)
+			client.writeError(w, http.StatusTooManyRequests, "rate limited")
+			return
+		}
+		client.writeJSON(w, http.StatusOK, map[string]string{"content": "ok"})
+	})
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+		req.Header.Set(idempotencyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	limited := do()
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "5", limited.Header().Get("Retry-After"))
+
+	retried := do()
+	assert.Equal(t, http.StatusOK, retried.Code, "the 429 is not replayed")
+	assert.Empty(t, retried.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestWithIdempotency_ConcurrentWaitsForFirst(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithIdempotencyTTL(time.Minute))
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := withIdempotency(client, func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+		client.writeJSON(w, http.StatusOK, map[string]string{"content": "done"})
+	})
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+		req.Header.Set(idempotencyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	firstDone := make(chan *httptest.ResponseRecorder)
+	go func() { firstDone <- do() }()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	secondDone := make(chan *httptest.ResponseRecorder)
+	go func() { secondDone <- do() }()
+
+	close(release)
+	first, second := <-firstDone, <-secondDone
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestWithIdempotency_DifferentBodyRejected(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithIdempotencyTTL(time.Minute))
+	var calls atomic.Int32
+	handler := withIdempotency(client, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		client.writeJSON(w, http.StatusOK, map[string]string{"echo": string(body)})
+	})
+
+	do := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(idempotencyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	first := do(testPromptBody)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Contains(t, first.Body.String(), "hello", "the handler still reads the body")
+
+	reused := do(`{"prompt":"Something else"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Empty(t, reused.Header().Get("Idempotent-Replayed"))
+
+	assert.Equal(t, http.StatusOK, do(testPromptBody).Code)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestWithIdempotency_ScopedByCaller(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithIdempotencyTTL(time.Minute),
+		WithRateLimitKey(func(r *http.Request) string { return r.Header.Get("X-API-Key") }))
+	var calls atomic.Int32
+	handler := withIdempotency(client, func(w http.ResponseWriter, _ *http.Request) {
+		n := calls.Add(1)
+		client.writeJSON(w, http.StatusOK, map[string]int32{"call": n})
+	})
+
+	do := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testPromptBody))
+		req.Header.Set(idempotencyHeader, "key-1")
+		req.Header.Set("X-API-Key", apiKey)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	alice := do("alice")
+	bob := do("bob")
+	assert.Empty(t, bob.Header().Get("Idempotent-Replayed"), "another caller's response is not replayed")
+	assert.NotEqual(t, alice.Body.String(), bob.Body.String())
+	assert.Equal(t, "true", do("alice").Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestIdempotencyCache_Expires(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := newIdempotencyCache(time.Minute, func() time.Time { return now })
+
+	e, owner := c.claim("a", [32]byte{})
+	require.True(t, owner)
+	c.complete(e, http.StatusOK, "", []byte("ok"))
+
+	_, owner = c.claim("a", [32]byte{})
+	assert.False(t, owner)
+
+	now = now.Add(2 * time.Minute)
+	_, owner = c.claim("b", [32]byte{})
+	require.True(t, owner)
+	assert.NotContains(t, c.entries, "a")
+
+	_, owner = c.claim("a", [32]byte{})
+	assert.True(t, owner)
+}
+
+func TestWithIdempotencyTTL_Validation(t *testing.T) {
+	_, err := New(WithIdempotencyTTL(0))
+	require.Error(t, err)
+
+	client := newTestClient(&mockSDKClient{})
+	assert.Nil(t, client.idempotency)
+}
@@ -0,0 +1,39 @@
+package copilotcli
+
+import "context"
+
+// CopilotClient is the set of Client methods application code typically
+// depends on. *Client implements it; depend on the interface to substitute a
+// fake in unit tests.
+//
+// The HTTP handlers accept a CopilotClient too. Given a *Client, they apply
+// its configuration (rate limits, timeouts, SSE field names, and so on);
+// given any other implementation, they run with the default configuration
+// and route every query through the interface.
+type CopilotClient interface {
+	Start(ctx context.Context) error
+	Stop() error
+	Ping(ctx context.Context) error
+	IsConnected() bool
+	Model() string
+	Query(ctx context.Context, prompt string) (*QueryResult, error)
+	QueryWithSession(ctx context.Context, sessionID, prompt string) (*QueryResult, error)
+	QueryWithOptions(ctx context.Context, opts QueryOptions) (*QueryResult, error)
+	QueryStream(ctx context.Context, sessionID, prompt string) (<-chan StreamEvent, string, error)
+	QueryStreamWithOptions(ctx context.Context, opts QueryOptions) (<-chan StreamEvent, string, error)
+	QueryBatch(ctx context.Context, prompts []string) ([]*QueryResult, error)
+	AbortSession(ctx context.Context, sessionID string) error
+	DestroySession(ctx context.Context, sessionID string) error
+}
+
+var _ CopilotClient = (*Client)(nil)
+
+// handlerClient returns the *Client whose configuration the HTTP handlers
+// apply: client itself, or one with the default configuration for other
+// CopilotClient implementations. It is never used to reach the sidecar.
+func handlerClient(client CopilotClient) *Client {
+	if c, ok := client.(*Client); ok {
+		return c
+	}
+	return newClient(defaultCfg(), nil)
+}
@@ -0,0 +1,38 @@
+package copilotcli
+
+import (
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// Metrics receives instrumentation from the client. Set it with WithMetrics.
+// Implementations must be safe for concurrent use and should return quickly,
+// since they are called from the SDK's event dispatch.
+type Metrics interface {
+	// ObserveFirstToken records the time from sending a streamed prompt to
+	// its first answer delta (or, without deltas, to the complete message).
+	ObserveFirstToken(d time.Duration)
+
+	// ObserveToolCall records one invocation of a registered tool: its name,
+	// how long the handler ran, and whether it succeeded. Failed argument
+	// validation, handler errors, and panics count as failures.
+	ObserveToolCall(name string, d time.Duration, success bool)
+}
+
+// instrumentTool wraps tool's handler to report each call to m, timed by clk.
+// It returns tool unchanged when m is nil.
+func instrumentTool(tool copilot.Tool, m Metrics, clk clock) copilot.Tool {
+	if m == nil || tool.Handler == nil {
+		return tool
+	}
+
+	handler := tool.Handler
+	tool.Handler = func(invocation copilot.ToolInvocation) (copilot.ToolResult, error) {
+		start := clk.Now()
+		result, err := handler(invocation)
+		m.ObserveToolCall(tool.Name, clk.Now().Sub(start), err == nil && result.ResultType != "error")
+		return result, err
+	}
+	return tool
+}
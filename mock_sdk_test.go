@@ -7,14 +7,15 @@ import (
 	copilot "github.com/github/copilot-sdk/go"
 )
 
-// mockSDKClient is a test double implementing sdkClient.
+// mockSDKClient is a test double implementing SDKClient.
 type mockSDKClient struct {
 	startFn  func(ctx context.Context) error
 	stopFn   func() error
 	pingFn   func(ctx context.Context, message string) (*copilot.PingResponse, error)
-	createFn func(ctx context.Context, config *copilot.SessionConfig) (sdkSession, error)
-	resumeFn func(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (sdkSession, error)
+	createFn func(ctx context.Context, config *copilot.SessionConfig) (SDKSession, error)
+	resumeFn func(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (SDKSession, error)
 	deleteFn func(ctx context.Context, sessionID string) error
+	modelsFn func(ctx context.Context) ([]copilot.ModelInfo, error)
 }
 
 func (m *mockSDKClient) Start(ctx context.Context) error {
@@ -38,14 +39,14 @@ func (m *mockSDKClient) Ping(ctx context.Context, message string) (*copilot.Ping
 	return &copilot.PingResponse{}, nil
 }
 
-func (m *mockSDKClient) CreateSession(ctx context.Context, config *copilot.SessionConfig) (sdkSession, error) {
+func (m *mockSDKClient) CreateSession(ctx context.Context, config *copilot.SessionConfig) (SDKSession, error) {
 	if m.createFn != nil {
 		return m.createFn(ctx, config)
 	}
 	return nil, nil
 }
 
-func (m *mockSDKClient) ResumeSessionWithOptions(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (sdkSession, error) {
+func (m *mockSDKClient) ResumeSessionWithOptions(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (SDKSession, error) {
 	if m.resumeFn != nil {
 		return m.resumeFn(ctx, sessionID, config)
 	}
@@ -59,7 +60,14 @@ func (m *mockSDKClient) DeleteSession(ctx context.Context, sessionID string) err
 	return nil
 }
 
-// mockSDKSession is a test double implementing sdkSession.
+func (m *mockSDKClient) ListModels(ctx context.Context) ([]copilot.ModelInfo, error) {
+	if m.modelsFn != nil {
+		return m.modelsFn(ctx)
+	}
+	return nil, nil
+}
+
+// mockSDKSession is a test double implementing SDKSession.
 type mockSDKSession struct {
 	id      string
 	onFn    func(handler func(event copilot.SessionEvent)) func()
@@ -128,11 +136,9 @@ func newTestClient(mock *mockSDKClient, opts ...Option) *Client {
 		_ = opt(c)
 	}
 
-	return &Client{
-		cfg:       c,
-		sdk:       mock,
-		connected: true,
-	}
+	client := newClient(c, mock)
+	client.connected = true
+	return client
 }
 
 // ptr returns a pointer to the given value. Useful for optional fields.
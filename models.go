@@ -0,0 +1,67 @@
+package copilotcli
+
+import (
+	"context"
+	"fmt"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// ModelInfo describes a model available through the sidecar or BYOK provider.
+type ModelInfo struct {
+	// ID is the identifier to pass to WithModel (e.g., "gpt-5").
+	ID string
+
+	// Name is the human-readable model name.
+	Name string
+
+	// ContextWindow is the maximum context window in tokens, or 0 if unknown.
+	ContextWindow int
+
+	// MaxPromptTokens is the maximum prompt size in tokens, or 0 if unknown.
+	MaxPromptTokens int
+
+	// SupportsVision reports whether the model accepts image input.
+	SupportsVision bool
+
+	// SupportsReasoningEffort reports whether the model accepts a reasoning effort setting.
+	SupportsReasoningEffort bool
+}
+
+// ListModels returns the models the sidecar can serve. Returns ErrNotConnected
+// when the client has not been started and ErrUnsupported when the sidecar
+// cannot list models.
+func (c *Client) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	c.mu.RLock()
+	if !c.connected {
+		c.mu.RUnlock()
+		return nil, ErrNotConnected
+	}
+	c.mu.RUnlock()
+
+	models, err := c.sdk.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing models: %w", err)
+	}
+
+	out := make([]ModelInfo, len(models))
+	for i := range models {
+		out[i] = toModelInfo(&models[i])
+	}
+	return out, nil
+}
+
+// toModelInfo converts the SDK's model description to a ModelInfo.
+func toModelInfo(m *copilot.ModelInfo) ModelInfo {
+	info := ModelInfo{
+		ID:                      m.ID,
+		Name:                    m.Name,
+		ContextWindow:           m.Capabilities.Limits.MaxContextWindowTokens,
+		SupportsVision:          m.Capabilities.Supports.Vision,
+		SupportsReasoningEffort: m.Capabilities.Supports.ReasoningEffort,
+	}
+	if m.Capabilities.Limits.MaxPromptTokens != nil {
+		info.MaxPromptTokens = *m.Capabilities.Limits.MaxPromptTokens
+	}
+	return info
+}
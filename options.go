@@ -1,9 +1,14 @@
 package copilotcli
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"text/template"
 	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
 )
 
 // Option configures the Client. Pass options to New.
@@ -21,12 +26,18 @@ func WithCLIURL(url string) Option {
 	}
 }
 
-// WithLogLevel sets the SDK log verbosity ("error", "info", "debug").
-// Default: "error".
+// WithLogLevel sets the SDK log verbosity, from least to most verbose:
+// "error", "warn", "info", "debug", or "trace". The level is passed to the
+// sidecar as is. Default: "error".
 func WithLogLevel(level string) Option {
 	return func(c *cfg) error {
-		c.logLevel = level
-		return nil
+		switch level {
+		case "error", "warn", "info", "debug", "trace":
+			c.logLevel = level
+			return nil
+		default:
+			return fmt.Errorf("invalid log level %q: must be one of error, warn, info, debug, trace", level)
+		}
 	}
 }
 
@@ -50,6 +61,274 @@ func WithStreaming(enabled bool) Option {
 	}
 }
 
+// WithRawEvents makes QueryStream forward SDK events it does not otherwise
+// handle as StreamEvent values with Raw set, for callers that want to observe
+// tool executions, usage, or other event types. Raw events depend on the SDK
+// version and may change between releases. The HTTP handlers skip them.
+// Default: false (such events are ignored).
+func WithRawEvents(enabled bool) Option {
+	return func(c *cfg) error {
+		c.rawEvents = enabled
+		return nil
+	}
+}
+
+// WithSSEFieldNames renames the JSON keys NewStreamHandler emits for delta
+// text, final content, the final flag, errors, and the session ID, for
+// frontends that expect different names (e.g., "text" and "done"). Names must
+// be non-empty and distinct. Default: "delta", "content", "final", "error",
+// "session_id".
+func WithSSEFieldNames(delta, content, final, errorName, sessionID string) Option {
+	return func(c *cfg) error {
+		names := []string{delta, content, final, errorName, sessionID}
+		seen := make(map[string]bool, len(names))
+		for _, name := range names {
+			if name == "" {
+				return errors.New("SSE field names must not be empty")
+			}
+			if seen[name] {
+				return fmt.Errorf("duplicate SSE field name %q", name)
+			}
+			seen[name] = true
+		}
+		c.sseFields = sseFieldNames{
+			delta:     delta,
+			content:   content,
+			final:     final,
+			error:     errorName,
+			sessionID: sessionID,
+		}
+		return nil
+	}
+}
+
+// WithJSONEncoder replaces encoding/json.Marshal for the JSON bodies and SSE
+// payloads written by the HTTP handlers, e.g. to plug in a faster encoder or
+// one with HTML escaping disabled. The encoder must return a single JSON value
+// without a trailing newline.
+func WithJSONEncoder(encode func(v any) ([]byte, error)) Option {
+	return func(c *cfg) error {
+		if encode == nil {
+			return errors.New("JSON encoder must not be nil")
+		}
+		c.jsonEncoder = encode
+		return nil
+	}
+}
+
+// WithStrictContentType makes the handlers that take a JSON body (query,
+// stream, batch, abort, and Anthropic messages) reject requests whose
+// Content-Type is not application/json, including requests without one, with
+// 415 Unsupported Media Type. Default: false (any Content-Type is decoded as
+// JSON).
+func WithStrictContentType(enabled bool) Option {
+	return func(c *cfg) error {
+		c.strictJSON = enabled
+		return nil
+	}
+}
+
+// WithCompression gzips NewQueryHandler and NewHealthHandler responses for
+// requests that send Accept-Encoding: gzip. Streaming responses are never
+// compressed. Default: false.
+func WithCompression(enabled bool) Option {
+	return func(c *cfg) error {
+		c.compression = enabled
+		return nil
+	}
+}
+
+// WithMetrics reports client instrumentation, such as first-token latency
+// of streamed queries and tool invocations, to m. Default: none.
+func WithMetrics(m Metrics) Option {
+	return func(c *cfg) error {
+		if m == nil {
+			return errors.New("metrics must not be nil")
+		}
+		c.metrics = m
+		return nil
+	}
+}
+
+// WithLogger sets the logger for package-level diagnostics, such as
+// streams that end on a write or serialization error. It is separate from
+// WithLogLevel, which configures the sidecar. Default: logs are discarded.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *cfg) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+		c.logger = l
+		return nil
+	}
+}
+
+// WithShutdownContext stops the client automatically when ctx ends, so
+// callers need not wire Stop into every shutdown path. The watch begins when
+// Start connects. It is optional and composes with manual Stop: stopping the
+// client first ends the watch, and Stop is never called twice.
+func WithShutdownContext(ctx context.Context) Option {
+	return func(c *cfg) error {
+		if ctx == nil {
+			return errors.New("shutdown context must not be nil")
+		}
+		c.shutdownCtx = ctx
+		return nil
+	}
+}
+
+// WithMaxPromptLength rejects prompts longer than runes characters with
+// ErrPromptTooLong before any model call. The HTTP handlers report it as 413.
+// Default: 0 (unlimited).
+func WithMaxPromptLength(runes int) Option {
+	return func(c *cfg) error {
+		if runes < 0 {
+			return errors.New("max prompt length must not be negative")
+		}
+		c.maxPromptLength = runes
+		return nil
+	}
+}
+
+// WithMaxBatchSize rejects QueryBatch calls with more than n prompts with
+// ErrBatchTooLarge before any model call. NewBatchHandler reports it as 400.
+// Zero removes the limit. Default: 100.
+func WithMaxBatchSize(n int) Option {
+	return func(c *cfg) error {
+		if n < 0 {
+			return errors.New("max batch size must not be negative")
+		}
+		c.maxBatchSize = n
+		return nil
+	}
+}
+
+// WithContextWindow makes queries fail fast with ErrContextTooLong when the
+// prompt's estimated token count exceeds tokens, instead of failing in the
+// sidecar. Estimates come from WithTokenCounter, or a four-characters-per-token
+// heuristic by default. Default: disabled.
+func WithContextWindow(tokens int) Option {
+	return func(c *cfg) error {
+		if tokens <= 0 {
+			return errors.New("context window must be positive")
+		}
+		c.contextWindow = tokens
+		return nil
+	}
+}
+
+// WithTokenCounter sets the estimator used by WithContextWindow and
+// Client.CountTokens.
+func WithTokenCounter(tc TokenCounter) Option {
+	return func(c *cfg) error {
+		if tc == nil {
+			return errors.New("token counter must not be nil")
+		}
+		c.tokenCounter = tc
+		return nil
+	}
+}
+
+// WithAutoRecreateSession makes queries that resume a session the sidecar no
+// longer knows (ErrSessionNotFound) continue in a fresh session instead of
+// failing. The conversation history is lost, and the result carries the new
+// session ID, which callers should persist. Default: false.
+func WithAutoRecreateSession(enabled bool) Option {
+	return func(c *cfg) error {
+		c.autoRecreate = enabled
+		return nil
+	}
+}
+
+// WithStreamSuppressFinalContent leaves Content empty in the final event of
+// QueryStream (and the final SSE message of NewStreamHandler), since the
+// deltas already delivered it. This halves bandwidth for clients that
+// accumulate deltas, but clients that rely on the final content, or sessions
+// that do not stream deltas, will receive no text. Default: false.
+func WithStreamSuppressFinalContent(enabled bool) Option {
+	return func(c *cfg) error {
+		c.suppressFinal = enabled
+		return nil
+	}
+}
+
+// WithStreamResumeOnError makes QueryStream (and NewStreamHandler) recover
+// from a rate-limit or availability error in the middle of a stream: instead
+// of ending with an error event, the client waits as WithQueryRetries does,
+// then sends the prompt again on the same session together with the partial
+// answer, asking the model to continue where it stopped. The continuation's
+// deltas are emitted on the same channel, and the final event's Content is
+// the partial answer followed by the continuation. A stream is continued at
+// most 3 times before its error is reported.
+//
+// Resuming is best-effort and approximate: the model may repeat, rephrase, or
+// contradict what it already streamed, the seam between the two parts may
+// not read naturally, and tools it called before the error may be called
+// again. Default: false.
+func WithStreamResumeOnError(enabled bool) Option {
+	return func(c *cfg) error {
+		c.streamResume = enabled
+		return nil
+	}
+}
+
+// WithStreamFallbackToJSON makes NewStreamHandler answer like NewQueryHandler
+// when its ResponseWriter is not an http.Flusher, as happens behind some
+// middleware that wraps the writer: the whole stream is buffered and returned
+// as a single JSON response instead of failing with 500 Internal Server
+// Error. Default: false.
+func WithStreamFallbackToJSON(enabled bool) Option {
+	return func(c *cfg) error {
+		c.streamJSON = enabled
+		return nil
+	}
+}
+
+// WithStreamBatchWindow makes NewStreamHandler combine the deltas that arrive
+// within each window of d into a single delta event, instead of writing one
+// small frame per token. Any buffered deltas are written before the next
+// reasoning, final, or error event, so no content is lost or reordered.
+// Default: 0 (every delta is written as it arrives).
+func WithStreamBatchWindow(d time.Duration) Option {
+	return func(c *cfg) error {
+		if d < 0 {
+			return errors.New("stream batch window must not be negative")
+		}
+		c.streamBatch = d
+		return nil
+	}
+}
+
+// WithStreamOverflowPolicy sets what QueryStream does with an answer delta
+// when the consumer has not kept up and the event channel is full. See
+// StreamOverflowPolicy. Default: StreamOverflowBlock.
+func WithStreamOverflowPolicy(policy StreamOverflowPolicy) Option {
+	return func(c *cfg) error {
+		switch policy {
+		case StreamOverflowBlock, StreamOverflowCoalesce, StreamOverflowDropOldest:
+			c.overflow = policy
+			return nil
+		default:
+			return fmt.Errorf("unknown stream overflow policy %q", policy)
+		}
+	}
+}
+
+// WithHandlerTimeout sets a hard deadline for each NewQueryHandler and
+// NewStreamHandler request, independent of any per-query timeout. When it
+// fires, the in-flight query is aborted; the query handler responds 504
+// Gateway Timeout and the stream handler ends the SSE stream with an error
+// message. Default: none.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(c *cfg) error {
+		if d <= 0 {
+			return errors.New("handler timeout must be positive")
+		}
+		c.handlerTimeout = d
+		return nil
+	}
+}
+
 // WithConnTimeout sets the maximum time to wait for the sidecar to respond
 // on each connection attempt. Default: 10s.
 func WithConnTimeout(d time.Duration) Option {
@@ -62,6 +341,19 @@ func WithConnTimeout(d time.Duration) Option {
 	}
 }
 
+// WithPingTimeout sets the maximum time Ping and PingMessage wait for the
+// sidecar to answer, so a hung sidecar cannot stall health checks.
+// Default: 5s.
+func WithPingTimeout(d time.Duration) Option {
+	return func(c *cfg) error {
+		if d <= 0 {
+			return errors.New("ping timeout must be positive")
+		}
+		c.pingTimeout = d
+		return nil
+	}
+}
+
 // WithRetryAttempts sets how many times to retry connecting to the sidecar
 // on startup. Default: 5.
 func WithRetryAttempts(n int) Option {
@@ -74,8 +366,54 @@ func WithRetryAttempts(n int) Option {
 	}
 }
 
+// WithStartRetryPredicate limits Start's retries to connection errors for
+// which retry returns true. Other errors, such as a rejected authentication,
+// fail Start immediately instead of using up the remaining attempts. Default:
+// every error is retried.
+func WithStartRetryPredicate(retry func(err error) bool) Option {
+	return func(c *cfg) error {
+		if retry == nil {
+			return errors.New("start retry predicate must not be nil")
+		}
+		c.startRetryIf = retry
+		return nil
+	}
+}
+
+// WithFirstTokenTimeout aborts a query or stream whose model produces no
+// output within d after the prompt is sent, for backends that accept a request
+// and then never respond. The query fails with ErrFirstTokenTimeout (streams
+// end with it as their error event), even if the session never goes idle.
+// The watchdog is disarmed by the first delta or message; the overall query
+// is still bounded only by its context. Default: 0 (disabled).
+func WithFirstTokenTimeout(d time.Duration) Option {
+	return func(c *cfg) error {
+		if d <= 0 {
+			return errors.New("first-token timeout must be positive")
+		}
+		c.firstTokenWait = d
+		return nil
+	}
+}
+
+// WithQueryRetries retries queries that fail with a rate-limit or
+// availability error before producing output, up to n more times, waiting
+// the WithRetryDelay duration and doubling it after each attempt. A canceled
+// context ends the wait immediately. Retries run against each provider before
+// failing over to the next WithFallbackProvider. Default: 0 (no retries).
+func WithQueryRetries(n int) Option {
+	return func(c *cfg) error {
+		if n < 0 {
+			return errors.New("query retries must not be negative")
+		}
+		c.queryRetries = n
+		return nil
+	}
+}
+
 // WithRetryDelay sets the base delay between connection retries.
-// The delay doubles after each failed attempt (exponential backoff).
+// The delay doubles after each failed attempt (exponential backoff). It is
+// also the base delay for WithQueryRetries.
 // Default: 500ms.
 func WithRetryDelay(d time.Duration) Option {
 	return func(c *cfg) error {
@@ -87,6 +425,109 @@ func WithRetryDelay(d time.Duration) Option {
 	}
 }
 
+// WithMaxConcurrency sets how many queries QueryBatch runs in parallel.
+// Default: 4.
+func WithMaxConcurrency(n int) Option {
+	return func(c *cfg) error {
+		if n <= 0 {
+			return errors.New("max concurrency must be positive")
+		}
+		c.maxConcurrency = n
+		return nil
+	}
+}
+
+// WithToolConcurrency caps how many tool handlers may run at once across all
+// of the client's tools, to protect the resources they call. When the model
+// requests several tool calls in parallel, invocations beyond the limit wait
+// for a running handler to finish. Default: unlimited.
+func WithToolConcurrency(n int) Option {
+	return func(c *cfg) error {
+		if n <= 0 {
+			return errors.New("tool concurrency must be positive")
+		}
+		c.toolConcurrency = n
+		return nil
+	}
+}
+
+// WithMaxToolRounds caps how many tool calls the model may make while
+// answering a single query, to stop runaway agent loops. Once the budget is
+// spent, further calls are not executed; instead the model receives an error
+// result quoting ErrToolLoopExceeded that tells it to answer without calling
+// more tools. Parallel calls count individually. The budget applies to Query,
+// QueryWithSession, QueryWithOptions, and QueryStream, and resets with every
+// query. Default: unlimited.
+func WithMaxToolRounds(n int) Option {
+	return func(c *cfg) error {
+		if n <= 0 {
+			return errors.New("max tool rounds must be positive")
+		}
+		c.maxToolRounds = n
+		return nil
+	}
+}
+
+// WithMaxConcurrentSessions caps how many queries (QueryWithSession and
+// QueryStream) may hold a session at once. Further calls wait for a slot and
+// fail with ErrTooManySessions if their context ends first. Default: unlimited.
+func WithMaxConcurrentSessions(n int) Option {
+	return func(c *cfg) error {
+		if n <= 0 {
+			return errors.New("max concurrent sessions must be positive")
+		}
+		c.maxSessions = n
+		return nil
+	}
+}
+
+// WithRateLimit throttles the HTTP handlers with a token bucket per client:
+// each key may make up to burst requests at once, refilled at rps per second.
+// Excess requests get 429 Too Many Requests with a Retry-After header.
+// Requests are keyed by client IP unless WithRateLimitKey is set.
+// Default: no limit.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *cfg) error {
+		if rps <= 0 {
+			return errors.New("rate limit must be positive")
+		}
+		if burst <= 0 {
+			return errors.New("rate limit burst must be positive")
+		}
+		c.rateLimitRPS = rps
+		c.rateLimitBurst = burst
+		return nil
+	}
+}
+
+// WithRateLimitKey sets the function that groups requests for WithRateLimit,
+// e.g., by API key header instead of client IP.
+func WithRateLimitKey(fn RateLimitKeyFunc) Option {
+	return func(c *cfg) error {
+		if fn == nil {
+			return errors.New("rate limit key function must not be nil")
+		}
+		c.rateLimitKey = fn
+		return nil
+	}
+}
+
+// WithIdempotencyTTL enables Idempotency-Key support in NewQueryHandler.
+// Responses are cached in memory by the header value for ttl, and retried
+// requests with the same key get the cached status and body without querying
+// the model again. Keys are scoped per caller as grouped by WithRateLimitKey,
+// and reusing a key with a different body gets 422 Unprocessable Entity.
+// Server errors are not cached. Default: disabled.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(c *cfg) error {
+		if ttl <= 0 {
+			return errors.New("idempotency TTL must be positive")
+		}
+		c.idempotencyTTL = ttl
+		return nil
+	}
+}
+
 // WithSystemMessage sets a system prompt prepended to every session.
 func WithSystemMessage(msg string) Option {
 	return func(c *cfg) error {
@@ -95,6 +536,47 @@ func WithSystemMessage(msg string) Option {
 	}
 }
 
+// WithPromptTemplate wraps every prompt in a text/template, e.g. to prepend
+// the same instructions to each one:
+//
+//	copilotcli.WithPromptTemplate("Answer in JSON: {{.Prompt}}")
+//
+// {{.Prompt}} is the caller's prompt; QueryOptions.TemplateVars supplies
+// further variables, which queries without them see as missing, so guard
+// optional ones with {{with}} or {{or}}. The template applies to queries and streams, and the
+// prompt length limits apply to the rendered prompt. Returns an error if tmpl
+// does not parse.
+func WithPromptTemplate(tmpl string) Option {
+	return func(c *cfg) error {
+		t, err := template.New("prompt").Parse(tmpl)
+		if err != nil {
+			return fmt.Errorf("parsing prompt template: %w", err)
+		}
+		c.promptTmpl = t
+		return nil
+	}
+}
+
+// WithSystemMessages appends system prompt fragments (e.g., a base persona,
+// tenant policy, and tool guidance), joined by newlines, to the system
+// message. Fragments are added in the order options are applied, after any
+// text set by an earlier WithSystemMessage; a later WithSystemMessage
+// replaces the whole message. Empty fragments are skipped.
+func WithSystemMessages(fragments ...string) Option {
+	return func(c *cfg) error {
+		for _, f := range fragments {
+			if f == "" {
+				continue
+			}
+			if c.systemMessage != "" {
+				c.systemMessage += "\n"
+			}
+			c.systemMessage += f
+		}
+		return nil
+	}
+}
+
 // WithTools registers custom tools that the LLM can invoke during a session.
 // Tool handlers execute in-process (in your Go service), not in the sidecar.
 func WithTools(tools ...ToolDefinition) Option {
@@ -104,6 +586,267 @@ func WithTools(tools ...ToolDefinition) Option {
 	}
 }
 
+// WithTypedTool registers a custom tool whose parameter schema is generated
+// from the fields of T, and whose handler receives the arguments decoded into
+// a T. The handler's result is sent to the LLM as is if it is a string, and as
+// JSON otherwise. ctx is derived from the context of the query that made the
+// call: it is canceled when that query's context is, when the query ends, or
+// when AbortSession aborts its session, so handlers can stop expensive work.
+// Calls outside a query of this client get context.Background().
+//
+// Typed tools are offered to sessions alongside the WithTools definitions and
+// count for WithToolChoice, but are not returned by Client.Tools and cannot be
+// removed with UnregisterTool.
+func WithTypedTool[T any](name, description string, handler func(params T, ctx context.Context) (any, error)) Option {
+	return func(c *cfg) error {
+		if name == "" {
+			return errors.New("tool name must not be empty")
+		}
+		if handler == nil {
+			return errors.New("tool handler must not be nil")
+		}
+		c.typedTools = append(c.typedTools, typedTool(name, description, c.toolCtxs, handler))
+		return nil
+	}
+}
+
+// WithToolChoice controls whether the model may call the client's custom tools.
+// choice is ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired, or the name of
+// a registered tool.
+//
+// The SDK has no native tool_choice field, so this is expressed through the
+// session's tool allow-list: "none" allows no tool at all, "required"
+// restricts the session to them, and a tool name restricts it to that single
+// tool. The model is never strictly forced to make a call. Default: "auto".
+func WithToolChoice(choice string) Option {
+	return func(c *cfg) error {
+		if choice == "" {
+			return errors.New("tool choice must not be empty")
+		}
+		c.toolChoice = choice
+		return nil
+	}
+}
+
+// BeforeQueryHook runs before each QueryWithSession call (including Query).
+// sessionID is empty when a new session will be created.
+type BeforeQueryHook func(ctx context.Context, prompt, sessionID string)
+
+// AfterQueryHook runs after each QueryWithSession call (including Query) with
+// its outcome; exactly one of result and err is non-nil.
+type AfterQueryHook func(ctx context.Context, result *QueryResult, err error)
+
+// WithSessionIDValidator checks every caller-supplied session ID before it
+// reaches the sidecar, e.g. to accept only the expected format when IDs come
+// from untrusted HTTP input. A non-nil error from validate rejects the ID with
+// ErrInvalidSessionID, which the HTTP handlers report as 400 Bad Request. IDs
+// of sessions the client creates itself are not checked. By default, any
+// non-empty ID is accepted.
+func WithSessionIDValidator(validate func(sessionID string) error) Option {
+	return func(c *cfg) error {
+		if validate == nil {
+			return errors.New("session ID validator must not be nil")
+		}
+		c.sessionIDCheck = validate
+		return nil
+	}
+}
+
+// WithErrorPrefix sets the prefix of the errors built from session error
+// events, e.g. to keep library branding out of user-facing messages. An empty
+// prefix reports the sidecar's message as is. Default: "copilot: ".
+func WithErrorPrefix(prefix string) Option {
+	return func(c *cfg) error {
+		c.errorPrefix = prefix
+		return nil
+	}
+}
+
+// WithCostModel sets a function that estimates the cost of each query from
+// its token usage and model, e.g. from a BYOK provider's price list. The
+// estimate is reported as QueryResult.EstimatedCost, StreamEvent.EstimatedCost
+// on the final event, and "cost" in the final SSE event of NewStreamHandler.
+// Default: no cost estimation.
+func WithCostModel(model CostModel) Option {
+	return func(c *cfg) error {
+		if model == nil {
+			return errors.New("cost model must not be nil")
+		}
+		c.costModel = model
+		return nil
+	}
+}
+
+// WithQueryAuditor registers a function that receives a QueryRecord for every
+// completed query, streamed or not, including failed and canceled ones. It
+// runs synchronously when the query ends (for streams, on the goroutine
+// delivering events), so it should be fast. The raw prompt and response are
+// left out unless WithQueryAuditContent is set.
+func WithQueryAuditor(auditor QueryAuditor) Option {
+	return func(c *cfg) error {
+		if auditor == nil {
+			return errors.New("query auditor must not be nil")
+		}
+		c.auditor = auditor
+		return nil
+	}
+}
+
+// WithQueryAuditContent includes the raw prompt and response in the records
+// passed to WithQueryAuditor. Off by default, since they may contain
+// personal data.
+func WithQueryAuditContent(include bool) Option {
+	return func(c *cfg) error {
+		c.auditContent = include
+		return nil
+	}
+}
+
+// WithSessionConfigHook registers a function that may modify the SDK
+// configuration of every session the client creates, to set SessionConfig
+// fields this package does not expose. It is an escape hatch: the hook runs
+// after all other options and per-query settings have been applied, so it
+// can override them, and it depends on the SDK's types, which may change
+// between versions. Hooks run in registration order.
+func WithSessionConfigHook(hook func(cfg *copilot.SessionConfig)) Option {
+	return func(c *cfg) error {
+		if hook == nil {
+			return errors.New("session config hook must not be nil")
+		}
+		c.sessionHooks = append(c.sessionHooks, hook)
+		return nil
+	}
+}
+
+// WithResumeConfigHook is WithSessionConfigHook for the configuration used
+// when the client resumes an existing session.
+func WithResumeConfigHook(hook func(cfg *copilot.ResumeSessionConfig)) Option {
+	return func(c *cfg) error {
+		if hook == nil {
+			return errors.New("resume config hook must not be nil")
+		}
+		c.resumeHooks = append(c.resumeHooks, hook)
+		return nil
+	}
+}
+
+// WithClientOptionsHook registers a function that may modify the SDK client
+// options New connects with, to set ClientOptions fields this package does
+// not expose (CLI path, environment, GitHub token, ...). Like
+// WithSessionConfigHook it is an escape hatch: the hook runs after the
+// package has mapped its own options, so it can override them (including
+// the CLI URL and log level), and it depends on the SDK's types, which may
+// change between versions. Hooks run in registration order.
+func WithClientOptionsHook(hook func(opts *copilot.ClientOptions)) Option {
+	return func(c *cfg) error {
+		if hook == nil {
+			return errors.New("client options hook must not be nil")
+		}
+		c.clientHooks = append(c.clientHooks, hook)
+		return nil
+	}
+}
+
+// WithSessionPersistence lets stateless services continue a conversation
+// across requests by its QueryOptions.ConversationKey, keeping the session
+// IDs in an external store such as Redis. For a query or stream with a
+// ConversationKey and no SessionID:
+//
+//  1. load is called with the key before the session is opened. A non-empty
+//     ID is continued; "" starts a new session. A load error fails the query.
+//  2. save is called with the key and the session ID once the query has
+//     succeeded (for a stream, once the prompt has been sent), unless it
+//     continued the session it started with. A save error is logged, not
+//     returned.
+//
+// Both run on the caller's goroutine with the query's context. A query that
+// sets SessionID as well skips load. A ConversationKey without this option
+// fails with ErrNoSessionPersistence.
+func WithSessionPersistence(save SessionSaveFunc, load SessionLoadFunc) Option {
+	return func(c *cfg) error {
+		if save == nil || load == nil {
+			return errors.New("session persistence functions must not be nil")
+		}
+		c.sessionSave = save
+		c.sessionLoad = load
+		return nil
+	}
+}
+
+// WithRecorder records the client's sessions to the file at path, or replays
+// them from it, so test suites can capture real interactions with the
+// sidecar once and then run deterministically without one.
+//
+// With RecorderRecord, the client talks to the sidecar as usual and writes
+// the prompts and SDK events of every session it opens to path, replacing
+// the file, whenever a turn ends and when the client stops.
+//
+// With RecorderReplay, New loads path and the sidecar is never contacted:
+// each new session replays the next recorded new session, and each resumed
+// session the next recorded resumption of its ID, emitting each recorded
+// turn's events after the corresponding Send. Queries must therefore run in
+// the recorded order; prompts, models, and other settings are not compared
+// with the recording, and tool handlers are not called. ListModels returns
+// ErrUnsupported.
+//
+// The file is JSON: {"sessions": [{"id", "resumed", "turns": [{"prompt",
+// "events"}]}]}, with one entry per session the client created or resumed
+// ("resumed" is true for the latter), in order, and the events in the SDK's
+// SessionEvent encoding.
+func WithRecorder(path string, mode RecorderMode) Option {
+	return func(c *cfg) error {
+		if path == "" {
+			return errors.New("recording path must not be empty")
+		}
+		if mode != RecorderRecord && mode != RecorderReplay {
+			return fmt.Errorf("invalid recorder mode %q: must be %q or %q", mode, RecorderRecord, RecorderReplay)
+		}
+		c.recordPath = path
+		c.recordMode = mode
+		return nil
+	}
+}
+
+// WithSDKClient makes the client reach the sidecar through sdk instead of
+// the Copilot SDK, e.g. to run against a test double. WithCLIURL, WithLogLevel,
+// and WithClientOptionsHook have no effect then, since they only configure
+// the SDK client.
+func WithSDKClient(sdk SDKClient) Option {
+	return func(c *cfg) error {
+		if sdk == nil {
+			return errors.New("SDK client must not be nil")
+		}
+		c.sdk = sdk
+		return nil
+	}
+}
+
+// WithBeforeQuery registers a hook that runs before every query, e.g., for
+// auditing. Hooks run synchronously in registration order on the caller's
+// goroutine, so they should be fast.
+func WithBeforeQuery(hook BeforeQueryHook) Option {
+	return func(c *cfg) error {
+		if hook == nil {
+			return errors.New("before-query hook must not be nil")
+		}
+		c.beforeQuery = append(c.beforeQuery, hook)
+		return nil
+	}
+}
+
+// WithAfterQuery registers a hook that runs after every query, including
+// failed ones. Hooks run synchronously in registration order on the caller's
+// goroutine, so they should be fast.
+func WithAfterQuery(hook AfterQueryHook) Option {
+	return func(c *cfg) error {
+		if hook == nil {
+			return errors.New("after-query hook must not be nil")
+		}
+		c.afterQuery = append(c.afterQuery, hook)
+		return nil
+	}
+}
+
 // WithGitHubAuth configures the client to authenticate via a GitHub token
 // with Copilot access. This is the default auth mode.
 func WithGitHubAuth() Option {
@@ -132,6 +875,26 @@ func WithBYOK(providerType ProviderType, baseURL, apiKey string) Option {
 	}
 }
 
+// WithFallbackProvider adds a BYOK provider to fail over to when a query
+// fails with a rate-limit or availability error before producing output.
+// Repeat the option to build a chain; providers are tried in the order added.
+// A resumed session is retried under the same ID with the fallback provider;
+// a new session is replaced by a fresh one. Each failover is logged with
+// WithLogger. Applies to Query, QueryWithSession, and QueryWithOptions.
+func WithFallbackProvider(providerType ProviderType, baseURL, apiKey string) Option {
+	return func(c *cfg) error {
+		if baseURL == "" {
+			return fmt.Errorf("%w: base URL is required for a fallback provider", ErrMissingProviderBaseURL)
+		}
+		c.fallbacks = append(c.fallbacks, fallbackProvider{
+			providerType: providerType,
+			baseURL:      baseURL,
+			apiKey:       apiKey,
+		})
+		return nil
+	}
+}
+
 // WithAzureAPIVersion sets the Azure API version when using ProviderAzure.
 // Default: not set (SDK uses its own default).
 func WithAzureAPIVersion(version string) Option {
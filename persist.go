@@ -0,0 +1,48 @@
+package copilotcli
+
+import (
+	"context"
+	"fmt"
+)
+
+// SessionSaveFunc stores the session ID of the conversation identified by
+// key. See WithSessionPersistence.
+type SessionSaveFunc func(ctx context.Context, key, sessionID string) error
+
+// SessionLoadFunc returns the session ID stored for the conversation
+// identified by key, or "" if there is none. See WithSessionPersistence.
+type SessionLoadFunc func(ctx context.Context, key string) (string, error)
+
+// loadConversation fills in opts.SessionID from the WithSessionPersistence
+// store when opts.ConversationKey is set and no session ID was given.
+func (c *Client) loadConversation(ctx context.Context, opts *QueryOptions) error {
+	if opts.ConversationKey == "" {
+		return nil
+	}
+	if c.cfg.sessionLoad == nil {
+		return ErrNoSessionPersistence
+	}
+	if opts.SessionID != "" {
+		return nil
+	}
+
+	sessionID, err := c.cfg.sessionLoad(ctx, opts.ConversationKey)
+	if err != nil {
+		return fmt.Errorf("loading session of conversation %q: %w", opts.ConversationKey, err)
+	}
+	opts.SessionID = sessionID
+	return nil
+}
+
+// saveConversation stores sessionID for key unless the query continued the
+// session it started with. The answer is already in hand, so a failed save
+// is logged rather than failing the query.
+func (c *Client) saveConversation(ctx context.Context, key, started, sessionID string) {
+	if key == "" || sessionID == "" || sessionID == started {
+		return
+	}
+	if err := c.cfg.sessionSave(ctx, key, sessionID); err != nil {
+		c.cfg.logger.Warn("copilot session persistence failed",
+			"conversation_key", key, "session_id", sessionID, "error", err)
+	}
+}
@@ -0,0 +1,151 @@
+package copilotcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is a WithSessionPersistence store that records its saves.
+type memoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]string
+	saves    []string
+	loadErr  error
+	saveErr  error
+}
+
+func (s *memoryStore) save(_ context.Context, key, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves = append(s.saves, key+"="+sessionID)
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	if s.sessions == nil {
+		s.sessions = make(map[string]string)
+	}
+	s.sessions[key] = sessionID
+	return nil
+}
+
+func (s *memoryStore) load(_ context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[key], s.loadErr
+}
+
+func (s *memoryStore) savedKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.saves...)
+}
+
+// persistenceMock creates sessions "new-1", "new-2", ... and resumes any ID,
+// recording the resumed IDs.
+func persistenceMock(resumed *[]string) *mockSDKClient {
+	var mu sync.Mutex
+	created := 0
+	return &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			created++
+			return providerSession(fmt.Sprintf("new-%d", created), "created", ""), nil
+		},
+		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			*resumed = append(*resumed, sessionID)
+			return providerSession(sessionID, "resumed", ""), nil
+		},
+	}
+}
+
+func TestWithSessionPersistence(t *testing.T) {
+	t.Run("query", func(t *testing.T) {
+		var resumed []string
+		store := &memoryStore{}
+		client := newTestClient(persistenceMock(&resumed), WithSessionPersistence(store.save, store.load))
+
+		res, err := client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", ConversationKey: "chat-1"})
+		require.NoError(t, err)
+		assert.Equal(t, "new-1", res.SessionID)
+		assert.Equal(t, []string{"chat-1=new-1"}, store.savedKeys(), "the first turn saves its new session")
+
+		res, err = client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "again", ConversationKey: "chat-1"})
+		require.NoError(t, err)
+		assert.Equal(t, "resumed", res.Content)
+		assert.Equal(t, []string{"new-1"}, resumed, "later turns continue the stored session")
+		assert.Equal(t, []string{"chat-1=new-1"}, store.savedKeys(), "continuing a session saves nothing")
+
+		res, err = client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", ConversationKey: "chat-2"})
+		require.NoError(t, err)
+		assert.Equal(t, "new-2", res.SessionID, "keys are independent")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var resumed []string
+		store := &memoryStore{}
+		client := newTestClient(persistenceMock(&resumed), WithSessionPersistence(store.save, store.load))
+
+		events, sid, err := client.QueryStreamWithOptions(t.Context(), QueryOptions{Prompt: "hi", ConversationKey: "chat"})
+		require.NoError(t, err)
+		drain(events)
+		assert.Equal(t, "new-1", sid)
+		assert.Equal(t, []string{"chat=new-1"}, store.savedKeys())
+
+		events, sid, err = client.QueryStreamWithOptions(t.Context(), QueryOptions{Prompt: "again", ConversationKey: "chat"})
+		require.NoError(t, err)
+		drain(events)
+		assert.Equal(t, "new-1", sid)
+		assert.Equal(t, []string{"new-1"}, resumed)
+		assert.Len(t, store.savedKeys(), 1)
+	})
+
+	t.Run("load error fails the query", func(t *testing.T) {
+		var resumed []string
+		store := &memoryStore{loadErr: errors.New("redis down")}
+		client := newTestClient(persistenceMock(&resumed), WithSessionPersistence(store.save, store.load))
+
+		_, err := client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", ConversationKey: "chat"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `loading session of conversation "chat": redis down`)
+		assert.Empty(t, store.savedKeys())
+	})
+
+	t.Run("save error is not returned", func(t *testing.T) {
+		var resumed []string
+		store := &memoryStore{saveErr: errors.New("redis down")}
+		client := newTestClient(persistenceMock(&resumed), WithSessionPersistence(store.save, store.load))
+
+		res, err := client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", ConversationKey: "chat"})
+		require.NoError(t, err)
+		assert.Equal(t, "created", res.Content)
+		assert.Equal(t, []string{"chat=new-1"}, store.savedKeys())
+	})
+
+	t.Run("key without persistence", func(t *testing.T) {
+		var resumed []string
+		client := newTestClient(persistenceMock(&resumed))
+
+		_, err := client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", ConversationKey: "chat"})
+		require.ErrorIs(t, err, ErrNoSessionPersistence)
+		_, _, err = client.QueryStreamWithOptions(t.Context(), QueryOptions{Prompt: "hi", ConversationKey: "chat"})
+		require.ErrorIs(t, err, ErrNoSessionPersistence)
+	})
+
+	t.Run("nil functions", func(t *testing.T) {
+		store := &memoryStore{}
+		_, err := New(WithSessionPersistence(nil, store.load))
+		require.Error(t, err)
+		_, err = New(WithSessionPersistence(store.save, nil))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,81 @@
+package copilotcli
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// ProviderOverride replaces the client's provider for a single request, so one
+// Client can serve tenants with their own BYOK keys. Pass it in
+// QueryOptions.Provider or attach it to the request context with
+// ContextWithProvider. The Azure API version set with WithAzureAPIVersion
+// still applies.
+type ProviderOverride struct {
+	// Type is the provider type. Required.
+	Type ProviderType
+	// BaseURL is the provider endpoint, an absolute http or https URL. Required.
+	BaseURL string
+	// APIKey authenticates with the provider.
+	APIKey string
+}
+
+// validate reports why the override cannot be used, wrapping
+// ErrInvalidProviderOverride.
+func (p *ProviderOverride) validate() error {
+	if err := validateProvider(p.Type, p.BaseURL); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidProviderOverride, err)
+	}
+	return nil
+}
+
+// validateProvider checks that a provider has a known type and an absolute
+// http or https base URL.
+func validateProvider(providerType ProviderType, baseURL string) error {
+	switch providerType {
+	case ProviderOpenAI, ProviderAzure, ProviderAnthropic:
+	default:
+		return fmt.Errorf("unknown provider type %q", providerType)
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base URL %q must be an absolute http or https URL", baseURL)
+	}
+	return nil
+}
+
+// providerContextKey is the context key for ContextWithProvider.
+type providerContextKey struct{}
+
+// ContextWithProvider returns a copy of ctx that carries a provider override.
+// Queries, streams, and subscriptions run with that context use it instead
+// of the client's configured provider; an explicit QueryOptions.Provider takes
+// precedence. Set it in middleware to route each tenant to its own provider,
+// including through the HTTP handlers.
+func ContextWithProvider(ctx context.Context, p ProviderOverride) context.Context {
+	return context.WithValue(ctx, providerContextKey{}, p)
+}
+
+// providerConfig validates override, falling back to the one carried by ctx,
+// and returns its SDK configuration, or nil if there is neither.
+func (c *Client) providerConfig(ctx context.Context, override *ProviderOverride) (*copilot.ProviderConfig, error) {
+	if override == nil {
+		p, ok := ctx.Value(providerContextKey{}).(ProviderOverride)
+		if !ok {
+			return nil, nil
+		}
+		override = &p
+	}
+	if err := override.validate(); err != nil {
+		return nil, err
+	}
+
+	return fallbackProvider{
+		providerType: override.Type,
+		baseURL:      override.BaseURL,
+		apiKey:       override.APIKey,
+	}.config(c.cfg.azureAPIVersion), nil
+}
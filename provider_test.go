@@ -0,0 +1,109 @@
+package copilotcli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// providerRecorder returns a mock that records the provider of each new session.
+func providerRecorder(providers *[]*copilot.ProviderConfig) *mockSDKClient {
+	return &mockSDKClient{
+		createFn: func(_ context.Context, cfg *copilot.SessionConfig) (SDKSession, error) {
+			*providers = append(*providers, cfg.Provider)
+			return providerSession("s1", "ok", ""), nil
+		},
+	}
+}
+
+func TestProviderOverride_QueryOptions(t *testing.T) {
+	var providers []*copilot.ProviderConfig
+	client := newTestClient(providerRecorder(&providers),
+		WithBYOK(ProviderOpenAI, "https://default", "default-key"),
+		WithAzureAPIVersion("2024-10-21"),
+	)
+	tenant := ContextWithProvider(t.Context(), ProviderOverride{Type: ProviderOpenAI, BaseURL: "https://ctx", APIKey: "ctx-key"})
+
+	_, err := client.QueryWithOptions(tenant, QueryOptions{
+		Prompt:   "hi",
+		Provider: &ProviderOverride{Type: ProviderAzure, BaseURL: "https://tenant-a.openai.azure.com", APIKey: "key-a"},
+	})
+	require.NoError(t, err)
+	_, err = client.Query(t.Context(), "hi")
+	require.NoError(t, err)
+
+	require.Len(t, providers, 2)
+	assert.Equal(t, &copilot.ProviderConfig{
+		Type:    "azure",
+		BaseURL: "https://tenant-a.openai.azure.com",
+		APIKey:  "key-a",
+		Azure:   &copilot.AzureProviderOptions{APIVersion: "2024-10-21"},
+	}, providers[0], "explicit override wins over the context")
+	assert.Equal(t, "https://default", providers[1].BaseURL, "client default is unchanged")
+}
+
+func TestProviderOverride_Context(t *testing.T) {
+	var providers []*copilot.ProviderConfig
+	client := newTestClient(providerRecorder(&providers))
+	ctx := ContextWithProvider(t.Context(), ProviderOverride{Type: ProviderAnthropic, BaseURL: "https://tenant-b", APIKey: "key-b"})
+
+	_, err := client.Query(ctx, "hi")
+	require.NoError(t, err)
+
+	events, _, err := client.QueryStream(ctx, "", "hi")
+	require.NoError(t, err)
+	drain(events)
+
+	require.Len(t, providers, 2)
+	for _, p := range providers {
+		require.NotNil(t, p)
+		assert.Equal(t, "anthropic", p.Type)
+		assert.Equal(t, "https://tenant-b", p.BaseURL)
+		assert.Equal(t, "key-b", p.APIKey)
+	}
+}
+
+func TestProviderOverride_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		override ProviderOverride
+	}{
+		{"unknown type", ProviderOverride{Type: "mystery", BaseURL: "https://x"}},
+		{"missing base URL", ProviderOverride{Type: ProviderOpenAI}},
+		{"relative base URL", ProviderOverride{Type: ProviderOpenAI, BaseURL: "tenant.example.com"}},
+		{"unsupported scheme", ProviderOverride{Type: ProviderOpenAI, BaseURL: "file:///etc/passwd"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var providers []*copilot.ProviderConfig
+			client := newTestClient(providerRecorder(&providers))
+
+			_, err := client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", Provider: &tt.override})
+			require.ErrorIs(t, err, ErrInvalidProviderOverride)
+
+			_, _, err = client.QueryStream(ContextWithProvider(t.Context(), tt.override), "", "hi")
+			require.ErrorIs(t, err, ErrInvalidProviderOverride)
+
+			assert.Empty(t, providers, "no session is created")
+		})
+	}
+}
+
+func TestProviderOverride_HandlerRejectsInvalid(t *testing.T) {
+	client := newTestClient(&mockSDKClient{})
+	handler := NewQueryHandler(client)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/copilot/query", bytes.NewReader([]byte(testPromptBody)))
+	req = req.WithContext(ContextWithProvider(req.Context(), ProviderOverride{Type: ProviderOpenAI, BaseURL: "::bad"}))
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
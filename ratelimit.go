@@ -0,0 +1,126 @@
+package copilotcli
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitKeyFunc extracts the key requests are throttled by (e.g., client
+// IP or API key). Requests with the same key share a token bucket.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// rateLimitSweepInterval is how often idle buckets are evicted.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a keyed token-bucket limiter shared by all handlers of a Client.
+type rateLimiter struct {
+	rps   float64
+	burst float64
+	key   RateLimitKeyFunc
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rps float64, burst int, key RateLimitKeyFunc, now func() time.Time) *rateLimiter {
+	if key == nil {
+		key = clientIPKey
+	}
+	return &rateLimiter{
+		rps:     rps,
+		burst:   float64(burst),
+		key:     key,
+		now:     now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token for key. When none is available it returns false and
+// how long until the next token.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rps)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rps * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely, since they are
+// indistinguishable from new ones. Callers must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rps >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientIPKey is the default RateLimitKeyFunc: the host part of RemoteAddr.
+// Proxy headers such as X-Forwarded-For are not trusted; supply a custom key
+// function via WithRateLimitKey when running behind a proxy.
+func clientIPKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimit wraps next with the client's rate limiter configured by
+// WithRateLimit. Requests over the limit get 429 Too Many Requests with a
+// Retry-After header. All handlers wrapped with the same client share limiter
+// state. When no limit is configured, next is returned unchanged.
+//
+// The query, stream, batch, and WebSocket handlers apply this automatically;
+// the health handler does not. Use it to protect custom handlers with the
+// same budget.
+func RateLimit(client *Client, next http.HandlerFunc) http.HandlerFunc {
+	limiter := client.limiter
+	if limiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := limiter.allow(limiter.key(r))
+		if !ok {
+			seconds := max(1, int(math.Ceil(wait.Seconds())))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			client.writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next(w, r)
+	}
+}
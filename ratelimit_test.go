@@ -0,0 +1,121 @@
+package copilotcli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newRateLimiter(2, 2, nil, func() time.Time { return now })
+
+	ok, _ := l.allow("a")
+	assert.True(t, ok)
+	ok, _ = l.allow("a")
+	assert.True(t, ok)
+
+	ok, wait := l.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Other keys have their own bucket.
+	ok, _ = l.allow("b")
+	assert.True(t, ok)
+
+	// Half a second refills one token at 2 rps.
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.allow("a")
+	assert.True(t, ok)
+	ok, _ = l.allow("a")
+	assert.False(t, ok)
+}
+
+func TestRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newRateLimiter(1, 1, nil, func() time.Time { return now })
+
+	l.allow("a")
+	l.allow("b")
+	require.Len(t, l.buckets, 2)
+
+	now = now.Add(2 * rateLimitSweepInterval)
+	l.allow("c")
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "c")
+}
+
+func TestRateLimit_SharedAcrossHandlers(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithRateLimit(0.5, 1))
+	query := NewQueryHandler(client)
+	stream := NewStreamHandler(client)
+
+	// The first request spends the only token (and fails validation).
+	req := httptest.NewRequest(http.MethodPost, "/api/copilot/query", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	query(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// The stream handler shares the same bucket for the same client IP.
+	req = httptest.NewRequest(http.MethodPost, "/api/copilot/stream", strings.NewReader(`{}`))
+	rec = httptest.NewRecorder()
+	stream(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// A different client IP is not affected.
+	req = httptest.NewRequest(http.MethodPost, "/api/copilot/query", strings.NewReader(`{}`))
+	req.RemoteAddr = "203.0.113.7:1234"
+	rec = httptest.NewRecorder()
+	query(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRateLimit_CustomKey(t *testing.T) {
+	client := newTestClient(&mockSDKClient{},
+		WithRateLimit(1, 1),
+		WithRateLimitKey(func(r *http.Request) string { return r.Header.Get("X-API-Key") }),
+	)
+	handler := RateLimit(client, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	do := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.Header.Set("X-API-Key", apiKey)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, do("key-1"))
+	assert.Equal(t, http.StatusTooManyRequests, do("key-1"))
+	assert.Equal(t, http.StatusNoContent, do("key-2"))
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	client := newTestClient(&mockSDKClient{})
+	called := 0
+	handler := RateLimit(client, func(_ http.ResponseWriter, _ *http.Request) { called++ })
+
+	for range 10 {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	}
+	assert.Equal(t, 10, called)
+}
+
+func TestWithRateLimit_Validation(t *testing.T) {
+	_, err := New(WithRateLimit(0, 1))
+	require.Error(t, err)
+
+	_, err = New(WithRateLimit(1, 0))
+	require.Error(t, err)
+
+	_, err = New(WithRateLimitKey(nil))
+	require.Error(t, err)
+}
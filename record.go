@@ -0,0 +1,318 @@
+package copilotcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// RecorderMode selects what WithRecorder does.
+type RecorderMode string
+
+const (
+	// RecorderRecord talks to the sidecar as usual and writes every session's
+	// events to the recording file.
+	RecorderRecord RecorderMode = "record"
+	// RecorderReplay serves sessions from the recording file instead of the
+	// sidecar, which is never contacted.
+	RecorderReplay RecorderMode = "replay"
+)
+
+// recording is the WithRecorder file: a JSON object holding, in the order
+// the client opened them, one entry per session it created or resumed.
+//
+//	{
+//	  "sessions": [
+//	    {
+//	      "id": "a1b2...",
+//	      "turns": [
+//	        {"prompt": "What is 2+2?", "events": [{"type": "assistant.message", "data": {...}, ...}, ...]}
+//	      ]
+//	    },
+//	    {"id": "a1b2...", "resumed": true, "turns": [...]}
+//	  ]
+//	}
+//
+// Each turn holds the prompt sent and the SDK session events that followed
+// it, up to the idle or error event ending it, in the SDK's own JSON
+// encoding.
+type recording struct {
+	Sessions []*recordedSession `json:"sessions"`
+}
+
+type recordedSession struct {
+	ID      string          `json:"id"`
+	Resumed bool            `json:"resumed,omitempty"`
+	Turns   []*recordedTurn `json:"turns"`
+}
+
+type recordedTurn struct {
+	Prompt string                 `json:"prompt"`
+	Events []copilot.SessionEvent `json:"events"`
+
+	ended bool
+}
+
+// newRecorder wraps sdk as WithRecorder configures: recording its sessions
+// to path, or replacing it with a replay of path.
+func newRecorder(sdk SDKClient, path string, mode RecorderMode) (SDKClient, error) {
+	switch mode {
+	case RecorderRecord:
+		return &recordingClient{SDKClient: sdk, path: path}, nil
+	case RecorderReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading recording: %w", err)
+		}
+		var rec recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("loading recording %s: %w", path, err)
+		}
+		return &replayClient{sessions: rec.Sessions, used: make([]bool, len(rec.Sessions))}, nil
+	default:
+		return sdk, nil
+	}
+}
+
+// recordingClient passes calls through to the SDK and records the sessions.
+// The file is rewritten whenever a turn ends and when the client stops.
+type recordingClient struct {
+	SDKClient
+	path string
+
+	mu      sync.Mutex
+	rec     recording
+	saveErr error
+}
+
+func (r *recordingClient) CreateSession(ctx context.Context, config *copilot.SessionConfig) (SDKSession, error) {
+	s, err := r.SDKClient.CreateSession(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return r.track(s, false), nil
+}
+
+func (r *recordingClient) ResumeSessionWithOptions(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (SDKSession, error) {
+	s, err := r.SDKClient.ResumeSessionWithOptions(ctx, sessionID, config)
+	if err != nil {
+		return nil, err
+	}
+	return r.track(s, true), nil
+}
+
+// Stop stops the SDK client and writes the recording. It reports the first
+// error writing the file, if any.
+func (r *recordingClient) Stop() error {
+	err := r.SDKClient.Stop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saveLocked()
+	return errors.Join(err, r.saveErr)
+}
+
+// track adds a recording entry for s.
+func (r *recordingClient) track(s SDKSession, resumed bool) SDKSession {
+	entry := &recordedSession{ID: s.ID(), Resumed: resumed, Turns: []*recordedTurn{}}
+	r.mu.Lock()
+	r.rec.Sessions = append(r.rec.Sessions, entry)
+	r.mu.Unlock()
+	return &recordingSession{SDKSession: s, client: r, entry: entry}
+}
+
+// saveLocked writes the recording file. Callers hold mu.
+func (r *recordingClient) saveLocked() {
+	data, err := json.MarshalIndent(&r.rec, "", "  ")
+	if err == nil {
+		err = os.WriteFile(r.path, data, 0o600)
+	}
+	if err != nil && r.saveErr == nil {
+		r.saveErr = fmt.Errorf("writing recording %s: %w", r.path, err)
+	}
+}
+
+// recordingSession starts a new turn in its recording entry for every Send,
+// and subscribes to the session's events only until that turn ends.
+type recordingSession struct {
+	SDKSession
+	client *recordingClient
+	entry  *recordedSession
+
+	// unsubscribe stops recording the current turn, or is nil between turns.
+	// Guarded by client.mu.
+	unsubscribe func()
+}
+
+func (s *recordingSession) Send(ctx context.Context, options copilot.MessageOptions) (string, error) {
+	r := s.client
+	turn := &recordedTurn{Prompt: options.Prompt, Events: []copilot.SessionEvent{}}
+
+	// Start the turn first: the SDK may emit events before Send returns.
+	r.mu.Lock()
+	s.entry.Turns = append(s.entry.Turns, turn)
+	previous := s.unsubscribe
+	s.unsubscribe = nil
+	r.mu.Unlock()
+	if previous != nil {
+		// The previous turn never ended; stop recording it.
+		previous()
+	}
+
+	unsubscribe := s.SDKSession.On(func(event copilot.SessionEvent) {
+		r.mu.Lock()
+		if turn.ended {
+			r.mu.Unlock()
+			return
+		}
+		turn.Events = append(turn.Events, event)
+		var done func()
+		if event.Type == copilot.SessionIdle || event.Type == copilot.SessionError {
+			turn.ended = true
+			r.saveLocked()
+			done, s.unsubscribe = s.unsubscribe, nil
+		}
+		r.mu.Unlock()
+		if done != nil {
+			done()
+		}
+	})
+
+	r.mu.Lock()
+	ended := turn.ended
+	if !ended {
+		s.unsubscribe = unsubscribe
+	}
+	r.mu.Unlock()
+	if ended {
+		unsubscribe()
+	}
+
+	msgID, err := s.SDKSession.Send(ctx, options)
+	if err != nil {
+		// The turn never started, so no event will end it.
+		r.mu.Lock()
+		turn.ended = true
+		unsubscribe, s.unsubscribe = s.unsubscribe, nil
+		r.mu.Unlock()
+		if unsubscribe != nil {
+			unsubscribe()
+		}
+	}
+	return msgID, err
+}
+
+// replayClient serves the sessions of a recording in the order they were
+// recorded: each CreateSession returns the next created session, and each
+// resume the next resumption of that session ID. Session configuration and
+// prompts are not compared with the recording.
+type replayClient struct {
+	mu       sync.Mutex
+	sessions []*recordedSession
+	used     []bool
+}
+
+func (*replayClient) Start(context.Context) error { return nil }
+
+func (*replayClient) Stop() error { return nil }
+
+func (*replayClient) Ping(context.Context, string) (*copilot.PingResponse, error) {
+	return &copilot.PingResponse{}, nil
+}
+
+func (r *replayClient) CreateSession(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+	if s := r.next(func(s *recordedSession) bool { return !s.Resumed }); s != nil {
+		return s, nil
+	}
+	return nil, errors.New("replay: no recorded session left to create")
+}
+
+func (r *replayClient) ResumeSessionWithOptions(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+	if s := r.next(func(s *recordedSession) bool { return s.Resumed && s.ID == sessionID }); s != nil {
+		return s, nil
+	}
+	return nil, fmt.Errorf("%w: replay has no resumption of %s left", ErrSessionNotFound, sessionID)
+}
+
+func (*replayClient) DeleteSession(context.Context, string) error { return nil }
+
+func (*replayClient) ListModels(context.Context) ([]copilot.ModelInfo, error) {
+	return nil, fmt.Errorf("%w: models are not recorded", ErrUnsupported)
+}
+
+// next returns a session for the first unused recording entry that matches,
+// or nil if there is none.
+func (r *replayClient) next(match func(*recordedSession) bool) *replaySession {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, s := range r.sessions {
+		if !r.used[i] && match(s) {
+			r.used[i] = true
+			return &replaySession{recorded: s}
+		}
+	}
+	return nil
+}
+
+// replaySession emits a recorded turn's events after each Send, in order,
+// from another goroutine, as the SDK does.
+type replaySession struct {
+	recorded *recordedSession
+
+	mu       sync.Mutex
+	turn     int
+	handlers map[int]func(copilot.SessionEvent)
+	nextID   int
+}
+
+func (s *replaySession) ID() string { return s.recorded.ID }
+
+func (s *replaySession) On(handler func(copilot.SessionEvent)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[int]func(copilot.SessionEvent))
+	}
+	id := s.nextID
+	s.nextID++
+	s.handlers[id] = handler
+	return func() {
+		s.mu.Lock()
+		delete(s.handlers, id)
+		s.mu.Unlock()
+	}
+}
+
+func (s *replaySession) Send(context.Context, copilot.MessageOptions) (string, error) {
+	s.mu.Lock()
+	if s.turn >= len(s.recorded.Turns) {
+		s.mu.Unlock()
+		return "", fmt.Errorf("replay: session %s has no recorded turn left", s.recorded.ID)
+	}
+	turn := s.recorded.Turns[s.turn]
+	s.turn++
+	msgID := fmt.Sprintf("replay-%d", s.turn)
+	s.mu.Unlock()
+
+	go func() {
+		for _, event := range turn.Events {
+			s.mu.Lock()
+			handlers := make([]func(copilot.SessionEvent), 0, len(s.handlers))
+			for _, h := range s.handlers {
+				handlers = append(handlers, h)
+			}
+			s.mu.Unlock()
+			for _, h := range handlers {
+				h(event)
+			}
+		}
+	}()
+	return msgID, nil
+}
+
+func (*replaySession) Abort(context.Context) error { return nil }
@@ -0,0 +1,124 @@
+package copilotcli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	turn := func(reply string) []copilot.SessionEvent {
+		return []copilot.SessionEvent{
+			{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr(reply[:2])}},
+			{Type: copilot.AssistantMessageDelta, Data: copilot.Data{DeltaContent: ptr(reply[2:])}},
+			{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr(reply)}},
+			{Type: copilot.SessionIdle},
+		}
+	}
+
+	// Record a new session and a follow-up turn in it against the mock sidecar.
+	var sessions []*mockSDKSession
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			sessions = append(sessions, streamSession("recorded", turn("four")...))
+			return sessions[len(sessions)-1], nil
+		},
+		resumeFn: func(_ context.Context, id string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+			sessions = append(sessions, streamSession(id, turn("eight")...))
+			return sessions[len(sessions)-1], nil
+		},
+	}
+	sdk, err := newRecorder(mock, path, RecorderRecord)
+	require.NoError(t, err)
+	recorder := newClient(defaultCfg(), sdk)
+	recorder.connected = true
+
+	res, err := recorder.Query(t.Context(), "What is 2+2?")
+	require.NoError(t, err)
+	assert.Equal(t, "four", res.Content)
+	res, err = recorder.QueryWithSession(t.Context(), "recorded", "And doubled?")
+	require.NoError(t, err)
+	assert.Equal(t, "eight", res.Content)
+	require.NoError(t, recorder.Stop())
+
+	t.Run("unsubscribes after each turn", func(t *testing.T) {
+		require.Len(t, sessions, 2)
+		for _, sess := range sessions {
+			// The recorder's handler may still be finishing the idle event.
+			assert.Eventually(t, func() bool {
+				sess.mu.Lock()
+				defer sess.mu.Unlock()
+				return !slices.ContainsFunc(sess.handlers, func(h func(copilot.SessionEvent)) bool { return h != nil })
+			}, time.Second, time.Millisecond, "session %s keeps a handler", sess.id)
+		}
+	})
+
+	t.Run("file format", func(t *testing.T) {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var rec recording
+		require.NoError(t, json.Unmarshal(data, &rec))
+
+		require.Len(t, rec.Sessions, 2)
+		assert.Equal(t, "recorded", rec.Sessions[0].ID)
+		assert.False(t, rec.Sessions[0].Resumed)
+		assert.True(t, rec.Sessions[1].Resumed)
+		require.Len(t, rec.Sessions[1].Turns, 1)
+		assert.Equal(t, "And doubled?", rec.Sessions[1].Turns[0].Prompt)
+		assert.Len(t, rec.Sessions[1].Turns[0].Events, 4)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		client, err := New(WithRecorder(path, RecorderReplay))
+		require.NoError(t, err)
+		require.NoError(t, client.Start(t.Context()), "no sidecar is needed")
+		t.Cleanup(func() { _ = client.Stop() })
+
+		res, err := client.Query(t.Context(), "What is 2+2?")
+		require.NoError(t, err)
+		assert.Equal(t, "four", res.Content)
+		assert.Equal(t, "recorded", res.SessionID)
+
+		events, _, err := client.QueryStream(t.Context(), "recorded", "And doubled?")
+		require.NoError(t, err)
+		var deltas []string
+		var final StreamEvent
+		for evt := range events {
+			if evt.IsFinal {
+				final = evt
+				continue
+			}
+			deltas = append(deltas, evt.DeltaContent)
+		}
+		assert.Equal(t, []string{"ei", "ght"}, deltas)
+		assert.Equal(t, "eight", final.Content)
+
+		_, err = client.Query(t.Context(), "One more?")
+		require.Error(t, err, "the recording is used up")
+		assert.Contains(t, err.Error(), "no recorded session left")
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := New(WithRecorder("", RecorderRecord))
+		require.Error(t, err)
+		_, err = New(WithRecorder(path, "rewind"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid recorder mode "rewind"`)
+		_, err = New(WithRecorder(filepath.Join(t.TempDir(), "missing.json"), RecorderReplay))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "loading recording")
+	})
+}
@@ -2,29 +2,40 @@ package copilotcli
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	copilot "github.com/github/copilot-sdk/go"
 )
 
-// sdkClient abstracts the Copilot SDK client for testability.
-type sdkClient interface {
+// SDKClient is the part of the Copilot SDK client that Client uses. New
+// connects to the sidecar through it; WithSDKClient substitutes another
+// implementation, such as the scripted fake of package copilotclitest.
+//
+// Implementations report a resumed session that does not exist with an error
+// wrapping ErrSessionNotFound, and unimplemented calls with one wrapping
+// ErrUnsupported. Sessions deliver their events from another goroutine, as
+// the SDK does.
+type SDKClient interface {
 	Start(ctx context.Context) error
 	Stop() error
 	Ping(ctx context.Context, message string) (*copilot.PingResponse, error)
-	CreateSession(ctx context.Context, config *copilot.SessionConfig) (sdkSession, error)
-	ResumeSessionWithOptions(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (sdkSession, error)
+	CreateSession(ctx context.Context, config *copilot.SessionConfig) (SDKSession, error)
+	ResumeSessionWithOptions(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (SDKSession, error)
 	DeleteSession(ctx context.Context, sessionID string) error
+	ListModels(ctx context.Context) ([]copilot.ModelInfo, error)
 }
 
-// sdkSession abstracts a Copilot SDK session for testability.
-type sdkSession interface {
+// SDKSession is the part of a Copilot SDK session that Client uses. See
+// SDKClient.
+type SDKSession interface {
 	On(handler func(event copilot.SessionEvent)) func()
 	Send(ctx context.Context, options copilot.MessageOptions) (string, error)
 	Abort(ctx context.Context) error
 	ID() string
 }
 
-// sdkClientAdapter wraps *copilot.Client to satisfy sdkClient.
+// sdkClientAdapter wraps *copilot.Client to satisfy SDKClient.
 type sdkClientAdapter struct {
 	c *copilot.Client
 }
@@ -41,7 +52,7 @@ func (a *sdkClientAdapter) Ping(ctx context.Context, message string) (*copilot.P
 	return a.c.Ping(ctx, message)
 }
 
-func (a *sdkClientAdapter) CreateSession(ctx context.Context, config *copilot.SessionConfig) (sdkSession, error) {
+func (a *sdkClientAdapter) CreateSession(ctx context.Context, config *copilot.SessionConfig) (SDKSession, error) {
 	s, err := a.c.CreateSession(ctx, config)
 	if err != nil {
 		return nil, err
@@ -49,9 +60,12 @@ func (a *sdkClientAdapter) CreateSession(ctx context.Context, config *copilot.Se
 	return &sdkSessionAdapter{s: s}, nil
 }
 
-func (a *sdkClientAdapter) ResumeSessionWithOptions(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (sdkSession, error) {
+func (a *sdkClientAdapter) ResumeSessionWithOptions(ctx context.Context, sessionID string, config *copilot.ResumeSessionConfig) (SDKSession, error) {
 	s, err := a.c.ResumeSessionWithOptions(ctx, sessionID, config)
 	if err != nil {
+		if isSessionNotFound(err) {
+			return nil, fmt.Errorf("%w: %w", ErrSessionNotFound, err)
+		}
 		return nil, err
 	}
 	return &sdkSessionAdapter{s: s}, nil
@@ -61,7 +75,33 @@ func (a *sdkClientAdapter) DeleteSession(ctx context.Context, sessionID string)
 	return a.c.DeleteSession(ctx, sessionID)
 }
 
-// sdkSessionAdapter wraps *copilot.Session to satisfy sdkSession.
+func (a *sdkClientAdapter) ListModels(ctx context.Context) ([]copilot.ModelInfo, error) {
+	models, err := a.c.ListModels(ctx)
+	if err != nil && isMethodNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupported, err)
+	}
+	return models, err
+}
+
+// isMethodNotFound reports whether err is a JSON-RPC "method not found" error,
+// meaning the sidecar does not implement the requested call. The SDK's error
+// type is internal, so this matches on the standard code in the message.
+func isMethodNotFound(err error) bool {
+	return strings.Contains(err.Error(), "JSON-RPC Error -32601")
+}
+
+// isSessionNotFound reports whether a resume error means the sidecar no longer
+// knows the session (e.g., it was evicted or the sidecar restarted). Like
+// isMethodNotFound, it matches on the message since the error type is internal.
+func isSessionNotFound(err error) bool {
+	if isMethodNotFound(err) {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "session") && strings.Contains(msg, "not found")
+}
+
+// sdkSessionAdapter wraps *copilot.Session to satisfy SDKSession.
 type sdkSessionAdapter struct {
 	s *copilot.Session
 }
@@ -0,0 +1,269 @@
+package copilotcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseFieldNames are the JSON keys used in SSE payloads. See WithSSEFieldNames.
+type sseFieldNames struct {
+	delta     string
+	content   string
+	final     string
+	error     string
+	sessionID string
+}
+
+// defaultSSEFieldNames are the keys emitted unless WithSSEFieldNames is set.
+var defaultSSEFieldNames = sseFieldNames{
+	delta:     "delta",
+	content:   "content",
+	final:     "final",
+	error:     "error",
+	sessionID: "session_id",
+}
+
+// sseFormat controls how streamTo serializes events.
+type sseFormat struct {
+	fields sseFieldNames
+	// ids adds an "id:" line from sseEventID to each message, so a
+	// reconnecting EventSource can report where it left off.
+	ids bool
+	// cost adds the final event's EstimatedCost as "cost".
+	cost bool
+	// batch combines the deltas received within each window into one delta
+	// message. Zero writes every delta as it arrives.
+	batch   time.Duration
+	marshal func(any) ([]byte, error)
+}
+
+// sseFormat returns the client's SSE format. See WithSSEFieldNames,
+// WithJSONEncoder, and WithStreamBatchWindow.
+func (c *Client) sseFormat(ids bool) sseFormat {
+	return sseFormat{
+		fields:  c.cfg.sseFields,
+		ids:     ids,
+		cost:    c.cfg.costModel != nil,
+		batch:   c.cfg.streamBatch,
+		marshal: c.cfg.jsonEncoder,
+	}
+}
+
+// StreamTo writes events to w in the Server-Sent Events format used by
+// NewStreamHandler, calling flush (if non-nil) after each message. It lets the
+// same serialization drive non-HTTP sinks such as files, pipes, or gRPC
+// streams.
+//
+// Each delta is written as:
+//
+//	data: {"delta":"...","session_id":"..."}
+//
+// Reasoning chunks are written as named "reasoning" events, and the stream
+// ends with a single final or error message. Raw events are skipped.
+//
+// StreamTo returns nil once the final or error message has been written or
+// the channel is closed, ctx.Err() if ctx ends first, or the first write or
+// serialization error. An event that fails to serialize is replaced by an
+// {"error":"serialization failed"} message.
+func StreamTo(ctx context.Context, w io.Writer, flush func(), events <-chan StreamEvent) error {
+	return streamTo(ctx, w, flush, events, sseFormat{fields: defaultSSEFieldNames, marshal: json.Marshal})
+}
+
+// streamTo implements StreamTo with a configurable format.
+func streamTo(ctx context.Context, w io.Writer, flush func(), events <-chan StreamEvent, format sseFormat) error {
+	names := format.fields
+	if flush == nil {
+		flush = func() {}
+	}
+
+	seq := 0
+	nextID := func(sessionID string) string {
+		if !format.ids {
+			return ""
+		}
+		seq++
+		return sseEventID(sessionID, seq)
+	}
+
+	// With a batch window, deltas are held in pending and written as one
+	// combined delta when the window closes, or before any other event.
+	var (
+		pending    strings.Builder
+		pendingSID string
+		window     *time.Timer
+		windowDone <-chan time.Time
+	)
+	defer func() {
+		if window != nil {
+			window.Stop()
+		}
+	}()
+	writeDelta := func(delta, sessionID string) error {
+		return writeSSEEvent(w, flush, format.marshal, format.fields.error, "", nextID(sessionID), map[string]any{
+			names.delta:     delta,
+			names.sessionID: sessionID,
+		})
+	}
+	flushPending := func() error {
+		windowDone = nil
+		if pending.Len() == 0 {
+			return nil
+		}
+		delta := pending.String()
+		pending.Reset()
+		return writeDelta(delta, pendingSID)
+	}
+
+	for {
+		var (
+			event StreamEvent
+			ok    bool
+		)
+		select {
+		case event, ok = <-events:
+		case <-windowDone:
+			if err := flushPending(); err != nil {
+				return err
+			}
+			continue
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok {
+			return flushPending()
+		}
+
+		if event.Raw != nil {
+			continue
+		}
+
+		isDelta := event.Error == nil && !event.IsFinal && event.ReasoningDelta == ""
+		if isDelta && format.batch > 0 {
+			pending.WriteString(event.DeltaContent)
+			pendingSID = event.SessionID
+			if windowDone == nil {
+				if window == nil {
+					window = time.NewTimer(format.batch)
+				} else {
+					window.Reset(format.batch)
+				}
+				windowDone = window.C
+			}
+			continue
+		}
+		if err := flushPending(); err != nil {
+			return err
+		}
+
+		if event.Error != nil {
+			payload := map[string]any{
+				names.error:     event.Error.Error(),
+				names.sessionID: event.SessionID,
+			}
+			if errors.Is(event.Error, ErrRateLimited) {
+				// Headers are long gone; tell the client to back off in-band.
+				payload["status"] = http.StatusTooManyRequests
+				payload["retry_after"] = rateLimitRetryAfter
+			}
+			var aborted *AbortError
+			if errors.As(event.Error, &aborted) {
+				payload["reason"] = aborted.Reason
+			}
+			return writeSSEEvent(w, flush, format.marshal, format.fields.error, "", nextID(event.SessionID), payload)
+		}
+
+		if event.IsFinal {
+			final := map[string]any{
+				names.content:   event.Content,
+				names.sessionID: event.SessionID,
+				names.final:     true,
+				"chunk_count":   event.ChunkCount,
+				"elapsed_ms":    event.Elapsed.Milliseconds(),
+			}
+			if format.cost {
+				final["cost"] = event.EstimatedCost
+			}
+			return writeSSEEvent(w, flush, format.marshal, format.fields.error, "", nextID(event.SessionID), final)
+		}
+
+		var err error
+		if event.ReasoningDelta != "" {
+			err = writeSSEEvent(w, flush, format.marshal, format.fields.error, "reasoning", nextID(event.SessionID), map[string]any{
+				"reasoning":     event.ReasoningDelta,
+				names.sessionID: event.SessionID,
+			})
+		} else {
+			err = writeDelta(event.DeltaContent, event.SessionID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sseEventID is the SSE "id:" of the seq-th message of a stream on sessionID.
+func sseEventID(sessionID string, seq int) string {
+	return sessionID + ":" + strconv.Itoa(seq)
+}
+
+// sessionFromEventID returns the session ID an id from sseEventID belongs to,
+// or "" if lastEventID is not in that format.
+func sessionFromEventID(lastEventID string) string {
+	i := strings.LastIndexByte(lastEventID, ':')
+	if i <= 0 {
+		return ""
+	}
+	if _, err := strconv.Atoi(lastEventID[i+1:]); err != nil {
+		return ""
+	}
+	return lastEventID[:i]
+}
+
+func writeSSE(w io.Writer, flush func(), marshal func(any) ([]byte, error), errorKey string, data any) error {
+	return writeSSEEvent(w, flush, marshal, errorKey, "", "", data)
+}
+
+// sseMarshalFailure returns the message sent in place of an event that cannot
+// be serialized, so the client is not left waiting for data that never
+// arrives. It reports the failure under errorKey, the stream's error field.
+func sseMarshalFailure(errorKey string) string {
+	body, _ := json.Marshal(map[string]string{errorKey: "serialization failed"})
+	return "data: " + string(body) + "\n\n"
+}
+
+// writeSSEEvent writes an SSE message with an optional event name and id,
+// encoding data with marshal. If data cannot be marshaled, it writes an error
+// message under errorKey instead and returns the marshal error.
+func writeSSEEvent(w io.Writer, flush func(), marshal func(any) ([]byte, error), errorKey, name, id string, data any) error {
+	body, err := marshal(data)
+	if err != nil {
+		if _, werr := io.WriteString(w, sseMarshalFailure(errorKey)); werr != nil {
+			return werr
+		}
+		flush()
+		return fmt.Errorf("marshaling SSE event: %w", err)
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if name != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", name); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", body); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
@@ -0,0 +1,201 @@
+package copilotcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamTo(t *testing.T) {
+	events := make(chan StreamEvent, 4)
+	events <- StreamEvent{DeltaContent: "Hel", SessionID: "s1"}
+	events <- StreamEvent{ReasoningDelta: "hmm", SessionID: "s1"}
+	events <- StreamEvent{DeltaContent: "lo", SessionID: "s1"}
+	events <- StreamEvent{Content: "Hello", IsFinal: true, ChunkCount: 2, Elapsed: 1500 * time.Millisecond, SessionID: "s1"}
+	close(events)
+
+	var buf bytes.Buffer
+	flushes := 0
+	err := StreamTo(t.Context(), &buf, func() { flushes++ }, events)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, flushes)
+	assert.Equal(t,
+		"data: {\"delta\":\"Hel\",\"session_id\":\"s1\"}\n\n"+
+			"event: reasoning\ndata: {\"reasoning\":\"hmm\",\"session_id\":\"s1\"}\n\n"+
+			"data: {\"delta\":\"lo\",\"session_id\":\"s1\"}\n\n"+
+			"data: {\"chunk_count\":2,\"content\":\"Hello\",\"elapsed_ms\":1500,\"final\":true,\"session_id\":\"s1\"}\n\n",
+		buf.String())
+}
+
+func TestStreamTo_ErrorEvent(t *testing.T) {
+	events := make(chan StreamEvent, 2)
+	events <- StreamEvent{Error: errors.New("copilot: boom"), SessionID: "s2"}
+	events <- StreamEvent{DeltaContent: "never written"}
+
+	var buf bytes.Buffer
+	require.NoError(t, StreamTo(t.Context(), &buf, nil, events))
+	assert.Equal(t, "data: {\"error\":\"copilot: boom\",\"session_id\":\"s2\"}\n\n", buf.String())
+}
+
+func TestStreamTo_ContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := StreamTo(ctx, &bytes.Buffer{}, nil, make(chan StreamEvent))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestStreamTo_WriteError(t *testing.T) {
+	events := make(chan StreamEvent, 1)
+	events <- StreamEvent{DeltaContent: "x"}
+
+	err := StreamTo(t.Context(), failingWriter{}, nil, events)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken pipe")
+}
+
+func TestStreamTo_CustomFieldNames(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithSSEFieldNames("text", "message", "done", "err", "sid"))
+
+	events := make(chan StreamEvent, 3)
+	events <- StreamEvent{DeltaContent: "Hi", SessionID: "s1"}
+	events <- StreamEvent{Content: "Hi", IsFinal: true, ChunkCount: 1, SessionID: "s1"}
+	close(events)
+
+	var buf bytes.Buffer
+	require.NoError(t, streamTo(t.Context(), &buf, nil, events, client.sseFormat(false)))
+	assert.Equal(t,
+		"data: {\"sid\":\"s1\",\"text\":\"Hi\"}\n\n"+
+			"data: {\"chunk_count\":1,\"done\":true,\"elapsed_ms\":0,\"message\":\"Hi\",\"sid\":\"s1\"}\n\n",
+		buf.String())
+
+	errEvents := make(chan StreamEvent, 1)
+	errEvents <- StreamEvent{Error: errors.New("boom"), SessionID: "s1"}
+	buf.Reset()
+	require.NoError(t, streamTo(t.Context(), &buf, nil, errEvents, client.sseFormat(false)))
+	assert.Equal(t, "data: {\"err\":\"boom\",\"sid\":\"s1\"}\n\n", buf.String())
+}
+
+func TestStreamTo_EventIDs(t *testing.T) {
+	events := make(chan StreamEvent, 3)
+	events <- StreamEvent{DeltaContent: "Hi", SessionID: "s-1"}
+	events <- StreamEvent{ReasoningDelta: "hmm", SessionID: "s-1"}
+	events <- StreamEvent{Content: "Hi", IsFinal: true, ChunkCount: 1, SessionID: "s-1"}
+	close(events)
+
+	var buf bytes.Buffer
+	require.NoError(t, streamTo(t.Context(), &buf, nil, events, sseFormat{fields: defaultSSEFieldNames, ids: true, marshal: json.Marshal}))
+	assert.Equal(t,
+		"id: s-1:1\ndata: {\"delta\":\"Hi\",\"session_id\":\"s-1\"}\n\n"+
+			"id: s-1:2\nevent: reasoning\ndata: {\"reasoning\":\"hmm\",\"session_id\":\"s-1\"}\n\n"+
+			"id: s-1:3\ndata: {\"chunk_count\":1,\"content\":\"Hi\",\"elapsed_ms\":0,\"final\":true,\"session_id\":\"s-1\"}\n\n",
+		buf.String())
+}
+
+func TestStreamTo_BatchWindow(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithStreamBatchWindow(time.Hour))
+
+	t.Run("final flushes buffered deltas first", func(t *testing.T) {
+		events := make(chan StreamEvent, 5)
+		for _, d := range []string{"Hel", "lo", ", ", "world"} {
+			events <- StreamEvent{DeltaContent: d, SessionID: "s1"}
+		}
+		events <- StreamEvent{Content: "Hello, world", IsFinal: true, ChunkCount: 4, SessionID: "s1"}
+		close(events)
+
+		var buf bytes.Buffer
+		require.NoError(t, streamTo(t.Context(), &buf, nil, events, client.sseFormat(true)))
+		assert.Equal(t,
+			"id: s1:1\ndata: {\"delta\":\"Hello, world\",\"session_id\":\"s1\"}\n\n"+
+				"id: s1:2\ndata: {\"chunk_count\":4,\"content\":\"Hello, world\",\"elapsed_ms\":0,\"final\":true,\"session_id\":\"s1\"}\n\n",
+			buf.String())
+	})
+
+	t.Run("reasoning and errors keep their order", func(t *testing.T) {
+		events := make(chan StreamEvent, 4)
+		events <- StreamEvent{DeltaContent: "a", SessionID: "s1"}
+		events <- StreamEvent{ReasoningDelta: "hmm", SessionID: "s1"}
+		events <- StreamEvent{DeltaContent: "b", SessionID: "s1"}
+		events <- StreamEvent{Error: errors.New("boom"), SessionID: "s1"}
+
+		var buf bytes.Buffer
+		require.NoError(t, streamTo(t.Context(), &buf, nil, events, client.sseFormat(false)))
+		assert.Equal(t,
+			"data: {\"delta\":\"a\",\"session_id\":\"s1\"}\n\n"+
+				"event: reasoning\ndata: {\"reasoning\":\"hmm\",\"session_id\":\"s1\"}\n\n"+
+				"data: {\"delta\":\"b\",\"session_id\":\"s1\"}\n\n"+
+				"data: {\"error\":\"boom\",\"session_id\":\"s1\"}\n\n",
+			buf.String())
+	})
+
+	t.Run("window flushes while the stream is open", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{}, WithStreamBatchWindow(10*time.Millisecond))
+		events := make(chan StreamEvent)
+		var (
+			mu  sync.Mutex
+			buf bytes.Buffer
+		)
+		flushed := make(chan string, 4)
+		w := writerFunc(func(p []byte) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return buf.Write(p)
+		})
+		done := make(chan error, 1)
+		go func() {
+			done <- streamTo(t.Context(), w, func() {
+				mu.Lock()
+				flushed <- buf.String()
+				buf.Reset()
+				mu.Unlock()
+			}, events, client.sseFormat(false))
+		}()
+
+		events <- StreamEvent{DeltaContent: "x", SessionID: "s1"}
+		assert.Equal(t, "data: {\"delta\":\"x\",\"session_id\":\"s1\"}\n\n", <-flushed,
+			"the window closes without waiting for the final event")
+
+		close(events)
+		require.NoError(t, <-done)
+	})
+
+	_, err := New(WithStreamBatchWindow(-time.Second))
+	require.Error(t, err)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestSessionFromEventID(t *testing.T) {
+	assert.Equal(t, "s-1", sessionFromEventID(sseEventID("s-1", 7)))
+	assert.Equal(t, "a:b", sessionFromEventID("a:b:12"))
+	assert.Empty(t, sessionFromEventID(""))
+	assert.Empty(t, sessionFromEventID("no-seq"))
+	assert.Empty(t, sessionFromEventID(":3"))
+	assert.Empty(t, sessionFromEventID("s-1:x"))
+}
+
+func TestWithSSEFieldNames_Validation(t *testing.T) {
+	_, err := New(WithSSEFieldNames("text", "", "done", "error", "session_id"))
+	require.Error(t, err)
+
+	_, err = New(WithSSEFieldNames("text", "text", "done", "error", "session_id"))
+	require.Error(t, err)
+
+	client, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, defaultSSEFieldNames, client.cfg.sseFields)
+}
@@ -0,0 +1,59 @@
+package copilotcli
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// TokenCounter estimates how many model tokens a text occupies. Plug in an
+// exact tokenizer (e.g., tiktoken-go) with WithTokenCounter; the default is a
+// rough heuristic. Implementations must be safe for concurrent use.
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// TokenCounterFunc adapts a plain function to TokenCounter.
+type TokenCounterFunc func(text string) int
+
+// CountTokens calls f(text).
+func (f TokenCounterFunc) CountTokens(text string) int { return f(text) }
+
+// heuristicTokens estimates roughly four characters per token, which is close
+// for English text on common tokenizers and errs high for code.
+func heuristicTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// CountTokens returns how many model tokens text occupies according to the
+// WithTokenCounter counter, e.g. to show how much of the WithContextWindow
+// budget a draft prompt would use. The SDK has no tokenizer, so without a
+// counter it returns ErrUnsupported rather than the heuristic estimate the
+// context window check falls back to. It returns ctx.Err() if ctx is done.
+func (c *Client) CountTokens(ctx context.Context, text string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if c.cfg.tokenCounter == nil {
+		return 0, fmt.Errorf("%w: counting tokens requires WithTokenCounter", ErrUnsupported)
+	}
+	return c.cfg.tokenCounter.CountTokens(text), nil
+}
+
+// checkContextWindow returns ErrContextTooLong if WithContextWindow is set and
+// the prompt's estimated token count exceeds it.
+func (c *Client) checkContextWindow(prompt string) error {
+	if c.cfg.contextWindow <= 0 {
+		return nil
+	}
+
+	counter := c.cfg.tokenCounter
+	if counter == nil {
+		counter = TokenCounterFunc(heuristicTokens)
+	}
+
+	if n := counter.CountTokens(prompt); n > c.cfg.contextWindow {
+		return fmt.Errorf("%w: estimated %d tokens, window is %d", ErrContextTooLong, n, c.cfg.contextWindow)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package copilotcli
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeuristicTokens(t *testing.T) {
+	assert.Equal(t, 0, heuristicTokens(""))
+	assert.Equal(t, 1, heuristicTokens("abc"))
+	assert.Equal(t, 1, heuristicTokens("abcd"))
+	assert.Equal(t, 2, heuristicTokens("abcde"))
+	assert.Equal(t, 1, heuristicTokens("日本語"))
+}
+
+func TestContextWindow_RejectsBeforeSending(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			t.Fatal("no session should be created")
+			return nil, nil
+		},
+	}
+	client := newTestClient(mock, WithContextWindow(10))
+
+	long := strings.Repeat("word ", 20)
+	_, err := client.Query(t.Context(), long)
+	require.ErrorIs(t, err, ErrContextTooLong)
+	assert.Contains(t, err.Error(), "estimated 25 tokens, window is 10")
+
+	_, _, err = client.QueryStream(t.Context(), "", long)
+	require.ErrorIs(t, err, ErrContextTooLong)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, errorStatus(err))
+}
+
+func TestContextWindow_CustomCounter(t *testing.T) {
+	var counted string
+	counter := TokenCounterFunc(func(text string) int {
+		counted = text
+		return 1000
+	})
+	client := newTestClient(&mockSDKClient{}, WithContextWindow(999), WithTokenCounter(counter))
+
+	_, err := client.Query(t.Context(), "short")
+	require.ErrorIs(t, err, ErrContextTooLong)
+	assert.Equal(t, "short", counted)
+}
+
+func TestClient_CountTokens(t *testing.T) {
+	t.Run("stub counter", func(t *testing.T) {
+		counter := TokenCounterFunc(func(text string) int { return len(strings.Fields(text)) })
+		client := newTestClient(&mockSDKClient{}, WithTokenCounter(counter))
+
+		n, err := client.CountTokens(t.Context(), "how many tokens is this")
+		require.NoError(t, err)
+		assert.Equal(t, 5, n)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		_, err = client.CountTokens(ctx, "text")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("no counter", func(t *testing.T) {
+		client := newTestClient(&mockSDKClient{}, WithContextWindow(100))
+		_, err := client.CountTokens(t.Context(), "text")
+		require.ErrorIs(t, err, ErrUnsupported)
+	})
+}
+
+func TestContextWindow_Disabled(t *testing.T) {
+	client := newTestClient(&mockSDKClient{})
+	require.NoError(t, client.checkContextWindow(strings.Repeat("x", 1_000_000)))
+}
+
+func TestWithContextWindow_Validation(t *testing.T) {
+	_, err := New(WithContextWindow(0))
+	require.Error(t, err)
+
+	_, err = New(WithTokenCounter(nil))
+	require.Error(t, err)
+}
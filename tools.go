@@ -1,7 +1,11 @@
 package copilotcli
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	copilot "github.com/github/copilot-sdk/go"
 )
@@ -11,12 +15,120 @@ import (
 // that is sent back as context. Handlers execute in-process (in your Go service).
 type ToolHandler func(args map[string]any) (string, error)
 
+// StructuredToolHandler is an alternative to ToolHandler for tools that return
+// structured data or need to control the result type.
+type StructuredToolHandler func(args map[string]any) (ToolResult, error)
+
+// ToolResult is the result of a StructuredToolHandler.
+type ToolResult struct {
+	// Text is sent to the LLM.
+	Text string
+
+	// Data, if not nil, is encoded as JSON and sent to the LLM after Text.
+	Data any
+
+	// ResultType is the result type reported to the SDK. Default: "success",
+	// or "error" if IsError is set.
+	ResultType string
+
+	// IsError marks the result as a failure for the LLM to react to, like a
+	// handler error, while keeping control of the text it sees.
+	IsError bool
+}
+
+// sdkResult converts the result of the named tool into the SDK's ToolResult.
+func (r ToolResult) sdkResult(name string) (copilot.ToolResult, error) {
+	text := r.Text
+	if r.Data != nil {
+		data, err := json.Marshal(r.Data)
+		if err != nil {
+			return copilot.ToolResult{}, fmt.Errorf("encoding result data: %w", err)
+		}
+		if text != "" {
+			text += "\n\n"
+		}
+		text += string(data)
+	}
+
+	result := copilot.ToolResult{
+		TextResultForLLM: text,
+		ResultType:       r.ResultType,
+		SessionLog:       fmt.Sprintf("Tool %s executed successfully", name),
+	}
+	if r.IsError {
+		result.Error = r.Text
+		result.SessionLog = fmt.Sprintf("Tool %s reported an error: %s", name, r.Text)
+	}
+	if result.ResultType == "" {
+		result.ResultType = "success"
+		if r.IsError {
+			result.ResultType = "error"
+		}
+	}
+	return result, nil
+}
+
 // ToolParameter describes a single parameter for a custom tool.
 type ToolParameter struct {
 	Name        string
 	Type        string // "string", "number", "boolean", "object", "array"
 	Description string
 	Required    bool
+
+	// Enum restricts the parameter to a fixed set of allowed values.
+	Enum []string
+
+	// Default is the value the LLM should assume when the parameter is omitted.
+	Default any
+
+	// Items describes the element schema when Type is "array". Its Name is ignored.
+	Items *ToolParameter
+
+	// Properties describes the nested fields when Type is "object".
+	Properties []ToolParameter
+}
+
+// schema returns the JSON schema property describing the parameter.
+func (p ToolParameter) schema() map[string]any {
+	prop := map[string]any{
+		"type":        p.Type,
+		"description": p.Description,
+	}
+	if len(p.Enum) > 0 {
+		prop["enum"] = p.Enum
+	}
+	if p.Default != nil {
+		prop["default"] = p.Default
+	}
+	if p.Items != nil {
+		prop["items"] = p.Items.schema()
+	}
+	if len(p.Properties) > 0 {
+		nested := objectSchema(p.Properties)
+		prop["properties"] = nested["properties"]
+		prop["required"] = nested["required"]
+	}
+	return prop
+}
+
+// objectSchema builds an object JSON schema from a parameter list. Required
+// names are collected per object level so nested objects carry their own list.
+func objectSchema(params []ToolParameter) map[string]any {
+	properties := make(map[string]any, len(params))
+	required := make([]string, 0)
+
+	for _, p := range params {
+		properties[p.Name] = p.schema()
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
 }
 
 // ToolDefinition describes a custom tool that the LLM can invoke.
@@ -32,48 +144,109 @@ type ToolDefinition struct {
 
 	// Handler is called when the LLM invokes this tool.
 	Handler ToolHandler
+
+	// StructuredHandler is called instead of Handler, for tools that return a
+	// ToolResult. Set one of the two.
+	StructuredHandler StructuredToolHandler
+
+	// StrictArgs validates the arguments against Parameters before calling
+	// Handler. Missing required parameters and type mismatches are reported to
+	// the LLM as an error result instead of reaching the handler.
+	StrictArgs bool
+
+	// RetryOnError reports whether a handler error is transient, e.g. a
+	// network blip. The SDK never retries a failed tool call, so such calls
+	// are retried here, up to 2 more times with a short backoff, before the
+	// last error is reported to the LLM. Retrying stops once the invoking
+	// query ends or is aborted. Nil never retries (the default).
+	RetryOnError func(err error) bool
 }
 
-// toSDKTool converts a ToolDefinition into the Copilot SDK's Tool type.
-func (td ToolDefinition) toSDKTool() copilot.Tool {
-	properties := make(map[string]any, len(td.Parameters))
-	required := make([]string, 0)
+// Retries of tool handlers whose errors RetryOnError classifies as transient.
+const (
+	toolRetries    = 2
+	toolRetryDelay = 50 * time.Millisecond
+)
 
-	for _, p := range td.Parameters {
-		properties[p.Name] = map[string]any{
-			"type":        p.Type,
-			"description": p.Description,
+// callWithRetry calls fn, and calls it again after each error that retryable
+// accepts, up to toolRetries more times, doubling the delay between attempts.
+// A nil retryable never retries. If ctx ends while waiting to retry, the last
+// error is returned.
+func callWithRetry(ctx context.Context, clk clock, retryable func(error) bool, fn func() error) error {
+	delay := toolRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || retryable == nil || attempt >= toolRetries || !retryable(err) {
+			return err
 		}
-		if p.Required {
-			required = append(required, p.Name)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-clk.After(delay):
 		}
+		delay *= 2
 	}
+}
 
+// toSDKTool converts a ToolDefinition into the Copilot SDK's Tool type.
+// Retries wait on clk and stop when the invoking session's tool context in
+// contexts ends.
+func (td ToolDefinition) toSDKTool(contexts *toolContexts, clk clock) copilot.Tool {
 	return copilot.Tool{
 		Name:        td.Name,
 		Description: td.Description,
-		Parameters: map[string]any{
-			"type":       "object",
-			"properties": properties,
-			"required":   required,
-		},
-		Handler: func(invocation copilot.ToolInvocation) (copilot.ToolResult, error) {
+		Parameters:  objectSchema(td.Parameters),
+		Handler: func(invocation copilot.ToolInvocation) (result copilot.ToolResult, err error) {
+			// A panicking handler would otherwise crash the SDK callback goroutine
+			// and take the whole process down; report it to the LLM instead.
+			defer func() {
+				if r := recover(); r != nil {
+					result, err = toolPanicResult(td.Name, r), nil
+				}
+			}()
+
 			args, ok := invocation.Arguments.(map[string]any)
 			if !ok {
 				return copilot.ToolResult{}, fmt.Errorf("unexpected arguments type: %T", invocation.Arguments)
 			}
 
-			result, err := td.Handler(args)
-			if err != nil {
-				return copilot.ToolResult{
-					TextResultForLLM: fmt.Sprintf("error: %s", err.Error()),
-					ResultType:       "error",
-					SessionLog:       fmt.Sprintf("Tool %s failed: %s", td.Name, err.Error()),
-				}, nil // return nil to avoid SDK retrying; the LLM sees the error message
+			if td.StrictArgs {
+				if verr := validateArgs(td.Parameters, args, ""); verr != nil {
+					return copilot.ToolResult{
+						TextResultForLLM: fmt.Sprintf("error: invalid arguments: %s", verr.Error()),
+						ResultType:       "error",
+						SessionLog:       fmt.Sprintf("Tool %s rejected arguments: %s", td.Name, verr.Error()),
+					}, nil
+				}
+			}
+
+			if td.StructuredHandler != nil {
+				var out ToolResult
+				herr := callWithRetry(contexts.get(invocation.SessionID), clk, td.RetryOnError, func() (err error) {
+					out, err = td.StructuredHandler(args)
+					return err
+				})
+				if herr != nil {
+					return toolErrorResult(td.Name, herr), nil
+				}
+				res, rerr := out.sdkResult(td.Name)
+				if rerr != nil {
+					return toolErrorResult(td.Name, rerr), nil
+				}
+				return res, nil
+			}
+
+			var out string
+			herr := callWithRetry(contexts.get(invocation.SessionID), clk, td.RetryOnError, func() (err error) {
+				out, err = td.Handler(args)
+				return err
+			})
+			if herr != nil {
+				return toolErrorResult(td.Name, herr), nil // return nil to avoid SDK retrying; the LLM sees the error message
 			}
 
 			return copilot.ToolResult{
-				TextResultForLLM: result,
+				TextResultForLLM: out,
 				ResultType:       "success",
 				SessionLog:       fmt.Sprintf("Tool %s executed successfully", td.Name),
 			}, nil
@@ -81,9 +254,221 @@ func (td ToolDefinition) toSDKTool() copilot.Tool {
 	}
 }
 
+// limitTool makes the tool's handler hold one of slots while it runs, so the
+// semaphore bounds handler executions across every tool sharing it. Metrics
+// observe only the handler itself, not the wait. A call stops waiting, and
+// fails without running, once the tool context of its query is done. A nil
+// slots leaves the tool unbounded.
+func limitTool(tool copilot.Tool, slots chan struct{}, contexts *toolContexts) copilot.Tool {
+	if slots == nil || tool.Handler == nil {
+		return tool
+	}
+
+	handler := tool.Handler
+	tool.Handler = func(invocation copilot.ToolInvocation) (copilot.ToolResult, error) {
+		ctx := contexts.get(invocation.SessionID)
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			err := fmt.Errorf("canceled while waiting for a tool slot: %w", ctx.Err())
+			return toolErrorResult(tool.Name, err), nil
+		}
+		defer func() { <-slots }()
+		return handler(invocation)
+	}
+	return tool
+}
+
+// toolPanicResult reports a recovered handler panic to the LLM.
+func toolPanicResult(name string, r any) copilot.ToolResult {
+	return copilot.ToolResult{
+		TextResultForLLM: fmt.Sprintf("error: tool panicked: %v", r),
+		ResultType:       "error",
+		SessionLog:       fmt.Sprintf("Tool %s panicked: %v", name, r),
+	}
+}
+
+// toolErrorResult reports a handler error to the LLM.
+func toolErrorResult(name string, err error) copilot.ToolResult {
+	return copilot.ToolResult{
+		TextResultForLLM: fmt.Sprintf("error: %s", err.Error()),
+		ResultType:       "error",
+		SessionLog:       fmt.Sprintf("Tool %s failed: %s", name, err.Error()),
+	}
+}
+
+// validateArgs checks that every required parameter is present and that each
+// supplied value roughly matches its declared type. prefix qualifies nested
+// parameter names in error messages.
+func validateArgs(params []ToolParameter, args map[string]any, prefix string) error {
+	for _, p := range params {
+		name := prefix + p.Name
+		v, ok := args[p.Name]
+		if !ok || v == nil {
+			if p.Required {
+				return fmt.Errorf("missing required parameter %q", name)
+			}
+			continue
+		}
+		if err := validateValue(p, v, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateValue checks a single value against its parameter declaration,
+// recursing into array items and nested object properties.
+func validateValue(p ToolParameter, v any, name string) error {
+	switch p.Type {
+	case "string":
+		if _, ok := v.(string); !ok {
+			return typeMismatch(name, p.Type, v)
+		}
+	case "number", "integer":
+		if !isNumber(v) {
+			return typeMismatch(name, p.Type, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return typeMismatch(name, p.Type, v)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return typeMismatch(name, p.Type, v)
+		}
+		if p.Items != nil {
+			for i, item := range items {
+				if err := validateValue(*p.Items, item, fmt.Sprintf("%s[%d]", name, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return typeMismatch(name, p.Type, v)
+		}
+		return validateArgs(p.Properties, obj, name+".")
+	default:
+		// Unknown or empty types are not checked.
+	}
+
+	if len(p.Enum) > 0 {
+		str, _ := v.(string)
+		for _, allowed := range p.Enum {
+			if str == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("parameter %q must be one of %v", name, p.Enum)
+	}
+	return nil
+}
+
+func typeMismatch(name, want string, got any) error {
+	return fmt.Errorf("parameter %q must be of type %s, got %T", name, want, got)
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	default:
+		return false
+	}
+}
+
 // DefineTypedTool creates a ToolDefinition using the copilot.DefineTool helper
 // for automatic JSON schema generation from a typed struct.
 // This is a convenience wrapper — use ToolDefinition directly for more control.
 func DefineTypedTool[T any](name, description string, handler func(params T, inv copilot.ToolInvocation) (any, error)) copilot.Tool {
 	return copilot.DefineTool(name, description, handler)
 }
+
+// toolContexts holds, for each session with a query in progress, a context
+// derived from the query's that is canceled when the query ends, is canceled,
+// or its session is aborted. The SDK does not pass a context to tool calls,
+// so handlers find theirs by the invocation's session ID.
+type toolContexts struct {
+	mu   sync.Mutex
+	byID map[string]toolContext
+}
+
+type toolContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newToolContexts() *toolContexts {
+	return &toolContexts{byID: make(map[string]toolContext)}
+}
+
+// begin makes a context derived from ctx the tool context of sessionID, and
+// returns the function that cancels it once the query ends. If queries
+// overlap on a session, its tools get the context of the latest one.
+func (t *toolContexts) begin(ctx context.Context, sessionID string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+
+	t.mu.Lock()
+	t.byID[sessionID] = toolContext{ctx: ctx, cancel: cancel}
+	t.mu.Unlock()
+	return func() {
+		cancel()
+		t.mu.Lock()
+		if t.byID[sessionID].ctx == ctx {
+			delete(t.byID, sessionID)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// cancel cancels the tool context of the query running on sessionID, if any.
+func (t *toolContexts) cancel(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tc, ok := t.byID[sessionID]; ok {
+		tc.cancel()
+	}
+}
+
+// get returns the tool context of sessionID, or context.Background() for
+// tool calls outside a query of this client. A nil t has no tool contexts.
+func (t *toolContexts) get(sessionID string) context.Context {
+	if t == nil {
+		return context.Background()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tc, ok := t.byID[sessionID]; ok {
+		return tc.ctx
+	}
+	return context.Background()
+}
+
+// typedTool builds an SDK tool whose parameter schema is generated from T, for
+// WithTypedTool. Like ToolDefinition handlers, argument decoding errors,
+// handler errors, and panics are reported to the LLM as error results. The
+// handler's ctx is the invoking session's tool context in contexts.
+func typedTool[T any](name, description string, contexts *toolContexts, handler func(params T, ctx context.Context) (any, error)) copilot.Tool {
+	tool := copilot.DefineTool(name, description, func(params T, invocation copilot.ToolInvocation) (any, error) {
+		return handler(params, contexts.get(invocation.SessionID))
+	})
+
+	invoke := tool.Handler
+	tool.Handler = func(invocation copilot.ToolInvocation) (result copilot.ToolResult, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				result, err = toolPanicResult(name, r), nil
+			}
+		}()
+
+		result, err = invoke(invocation)
+		if err != nil {
+			return toolErrorResult(name, err), nil
+		}
+		return result, nil
+	}
+	return tool
+}
@@ -1,8 +1,13 @@
 package copilotcli
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	copilot "github.com/github/copilot-sdk/go"
 	"github.com/stretchr/testify/assert"
@@ -23,7 +28,7 @@ func TestToolDefinitionToSDKTool(t *testing.T) {
 			},
 		}
 
-		tool := td.toSDKTool()
+		tool := td.toSDKTool(nil, realClock{})
 
 		assert.Equal(t, "my_tool", tool.Name)
 		assert.Equal(t, "Does something useful", tool.Description)
@@ -52,7 +57,7 @@ func TestToolDefinitionToSDKTool(t *testing.T) {
 			Handler:     func(_ map[string]any) (string, error) { return "ok", nil },
 		}
 
-		tool := td.toSDKTool()
+		tool := td.toSDKTool(nil, realClock{})
 
 		params := tool.Parameters
 
@@ -64,6 +69,72 @@ func TestToolDefinitionToSDKTool(t *testing.T) {
 	})
 }
 
+func TestToolDefinition_EnumAndDefault(t *testing.T) {
+	td := ToolDefinition{
+		Name:        "set_mode",
+		Description: "Sets the mode",
+		Parameters: []ToolParameter{
+			{Name: "mode", Type: "string", Description: "Mode", Enum: []string{"fast", "slow"}, Default: "fast"},
+			{Name: "limit", Type: "number", Description: "Limit", Default: 10},
+			{Name: "note", Type: "string", Description: "Note"},
+		},
+		Handler: func(_ map[string]any) (string, error) { return "ok", nil },
+	}
+
+	props := td.toSDKTool(nil, realClock{}).Parameters["properties"].(map[string]any)
+
+	mode := props["mode"].(map[string]any)
+	assert.Equal(t, []string{"fast", "slow"}, mode["enum"])
+	assert.Equal(t, "fast", mode["default"])
+
+	limit := props["limit"].(map[string]any)
+	assert.NotContains(t, limit, "enum")
+	assert.Equal(t, 10, limit["default"])
+
+	note := props["note"].(map[string]any)
+	assert.NotContains(t, note, "enum")
+	assert.NotContains(t, note, "default")
+}
+
+func TestToolDefinition_NestedSchemas(t *testing.T) {
+	td := ToolDefinition{
+		Name:        "create_order",
+		Description: "Creates an order",
+		Parameters: []ToolParameter{
+			{
+				Name:        "lines",
+				Type:        "array",
+				Description: "Order lines",
+				Required:    true,
+				Items: &ToolParameter{
+					Type:        "object",
+					Description: "A single order line",
+					Properties: []ToolParameter{
+						{Name: "sku", Type: "string", Description: "Item SKU", Required: true},
+						{Name: "qty", Type: "number", Description: "Quantity"},
+					},
+				},
+			},
+		},
+		Handler: func(_ map[string]any) (string, error) { return "ok", nil },
+	}
+
+	params := td.toSDKTool(nil, realClock{}).Parameters
+	assert.Equal(t, []string{"lines"}, params["required"])
+
+	lines := params["properties"].(map[string]any)["lines"].(map[string]any)
+	assert.Equal(t, "array", lines["type"])
+
+	items := lines["items"].(map[string]any)
+	assert.Equal(t, "object", items["type"])
+	assert.Equal(t, []string{"sku"}, items["required"])
+
+	itemProps := items["properties"].(map[string]any)
+	require.Contains(t, itemProps, "sku")
+	require.Contains(t, itemProps, "qty")
+	assert.Equal(t, "number", itemProps["qty"].(map[string]any)["type"])
+}
+
 func TestToolHandler_Invocation(t *testing.T) {
 	t.Run("successful handler invocation", func(t *testing.T) {
 		td := ToolDefinition{
@@ -77,7 +148,7 @@ func TestToolHandler_Invocation(t *testing.T) {
 			},
 		}
 
-		tool := td.toSDKTool()
+		tool := td.toSDKTool(nil, realClock{})
 		result, err := tool.Handler(copilot.ToolInvocation{
 			Arguments: map[string]any{"name": "Alice"},
 		})
@@ -97,7 +168,7 @@ func TestToolHandler_Invocation(t *testing.T) {
 			},
 		}
 
-		tool := td.toSDKTool()
+		tool := td.toSDKTool(nil, realClock{})
 		result, err := tool.Handler(copilot.ToolInvocation{
 			Arguments: map[string]any{},
 		})
@@ -110,6 +181,32 @@ func TestToolHandler_Invocation(t *testing.T) {
 		assert.Contains(t, result.SessionLog, "failed")
 	})
 
+	t.Run("panicking handler returns error result", func(t *testing.T) {
+		td := ToolDefinition{
+			Name:        "panicky_tool",
+			Description: "Always panics",
+			Handler: func(_ map[string]any) (string, error) {
+				panic("index out of range")
+			},
+		}
+
+		tool := td.toSDKTool(nil, realClock{})
+		var (
+			result copilot.ToolResult
+			err    error
+		)
+		require.NotPanics(t, func() {
+			result, err = tool.Handler(copilot.ToolInvocation{
+				Arguments: map[string]any{},
+			})
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, "index out of range")
+		assert.Contains(t, result.SessionLog, "panicky_tool")
+		assert.Contains(t, result.SessionLog, "panicked")
+	})
+
 	t.Run("unexpected arguments type returns error", func(t *testing.T) {
 		td := ToolDefinition{
 			Name:        "typed_tool",
@@ -119,7 +216,7 @@ func TestToolHandler_Invocation(t *testing.T) {
 			},
 		}
 
-		tool := td.toSDKTool()
+		tool := td.toSDKTool(nil, realClock{})
 		_, err := tool.Handler(copilot.ToolInvocation{
 			Arguments: "not-a-map",
 		})
@@ -133,7 +230,7 @@ func TestToolHandler_Invocation(t *testing.T) {
 			Handler: func(_ map[string]any) (string, error) { return "ok", nil },
 		}
 
-		tool := td.toSDKTool()
+		tool := td.toSDKTool(nil, realClock{})
 		_, err := tool.Handler(copilot.ToolInvocation{
 			Arguments: nil,
 		})
@@ -142,6 +239,237 @@ func TestToolHandler_Invocation(t *testing.T) {
 	})
 }
 
+func TestToolDefinition_StructuredHandler(t *testing.T) {
+	invoke := func(t *testing.T, handler StructuredToolHandler) copilot.ToolResult {
+		t.Helper()
+		td := ToolDefinition{Name: "inventory", StructuredHandler: handler}
+		result, err := td.toSDKTool(nil, realClock{}).Handler(copilot.ToolInvocation{Arguments: map[string]any{"sku": "A1"}})
+		require.NoError(t, err)
+		return result
+	}
+
+	t.Run("structured data", func(t *testing.T) {
+		result := invoke(t, func(args map[string]any) (ToolResult, error) {
+			return ToolResult{Data: map[string]any{"sku": args["sku"], "stock": 3}}, nil
+		})
+		assert.JSONEq(t, `{"sku": "A1", "stock": 3}`, result.TextResultForLLM)
+		assert.Equal(t, "success", result.ResultType)
+		assert.Contains(t, result.SessionLog, "successfully")
+	})
+
+	t.Run("text followed by data", func(t *testing.T) {
+		result := invoke(t, func(map[string]any) (ToolResult, error) {
+			return ToolResult{Text: "Stock levels:", Data: []int{1, 2}}, nil
+		})
+		assert.Equal(t, "Stock levels:\n\n[1,2]", result.TextResultForLLM)
+	})
+
+	t.Run("error result", func(t *testing.T) {
+		result := invoke(t, func(map[string]any) (ToolResult, error) {
+			return ToolResult{Text: "unknown SKU", IsError: true}, nil
+		})
+		assert.Equal(t, "unknown SKU", result.TextResultForLLM)
+		assert.Equal(t, "error", result.ResultType)
+		assert.Equal(t, "unknown SKU", result.Error)
+		assert.Contains(t, result.SessionLog, "reported an error")
+	})
+
+	t.Run("explicit result type", func(t *testing.T) {
+		result := invoke(t, func(map[string]any) (ToolResult, error) {
+			return ToolResult{Text: "not allowed", ResultType: "rejected"}, nil
+		})
+		assert.Equal(t, "rejected", result.ResultType)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		result := invoke(t, func(map[string]any) (ToolResult, error) {
+			return ToolResult{}, errors.New("database down")
+		})
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, "database down")
+	})
+
+	t.Run("unencodable data", func(t *testing.T) {
+		result := invoke(t, func(map[string]any) (ToolResult, error) {
+			return ToolResult{Data: make(chan int)}, nil
+		})
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, "encoding result data")
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		result := invoke(t, func(map[string]any) (ToolResult, error) { panic("boom") })
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.SessionLog, "panicked")
+	})
+}
+
+func TestToolDefinition_RetryOnError(t *testing.T) {
+	errBlip := errors.New("connection reset")
+	transient := func(err error) bool { return errors.Is(err, errBlip) }
+
+	// failing returns a handler that fails with the given errors, in order,
+	// and then succeeds, counting its calls.
+	failing := func(calls *int, errs ...error) ToolHandler {
+		return func(map[string]any) (string, error) {
+			*calls++
+			if *calls <= len(errs) {
+				return "", errs[*calls-1]
+			}
+			return "stock: 3", nil
+		}
+	}
+	invoke := func(t *testing.T, td ToolDefinition) copilot.ToolResult {
+		t.Helper()
+		result, err := td.toSDKTool(nil, newFakeClock()).Handler(copilot.ToolInvocation{Arguments: map[string]any{}})
+		require.NoError(t, err)
+		return result
+	}
+
+	t.Run("transient error is retried", func(t *testing.T) {
+		var calls int
+		result := invoke(t, ToolDefinition{Name: "stock", Handler: failing(&calls, errBlip, errBlip), RetryOnError: transient})
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, "success", result.ResultType)
+		assert.Equal(t, "stock: 3", result.TextResultForLLM)
+	})
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		var calls int
+		result := invoke(t, ToolDefinition{Name: "stock", Handler: failing(&calls, errBlip, errBlip, errBlip), RetryOnError: transient})
+		assert.Equal(t, 1+toolRetries, calls)
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, "connection reset")
+	})
+
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		var calls int
+		result := invoke(t, ToolDefinition{Name: "stock", Handler: failing(&calls, errors.New("unknown SKU")), RetryOnError: transient})
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, "unknown SKU")
+	})
+
+	t.Run("default never retries", func(t *testing.T) {
+		var calls int
+		result := invoke(t, ToolDefinition{Name: "stock", Handler: failing(&calls, errBlip)})
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, "error", result.ResultType)
+	})
+
+	t.Run("structured handler", func(t *testing.T) {
+		var calls int
+		result := invoke(t, ToolDefinition{
+			Name: "stock",
+			StructuredHandler: func(map[string]any) (ToolResult, error) {
+				calls++
+				if calls == 1 {
+					return ToolResult{}, errBlip
+				}
+				return ToolResult{Data: 3}, nil
+			},
+			RetryOnError: transient,
+		})
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, "3", result.TextResultForLLM)
+	})
+
+	t.Run("backs off on the clock", func(t *testing.T) {
+		var calls int
+		clk := newFakeClock()
+		td := ToolDefinition{Name: "stock", Handler: failing(&calls, errBlip, errBlip), RetryOnError: transient}
+
+		_, err := td.toSDKTool(nil, clk).Handler(copilot.ToolInvocation{Arguments: map[string]any{}})
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{toolRetryDelay, 2 * toolRetryDelay}, clk.Waits())
+	})
+
+	t.Run("cancellation stops retrying", func(t *testing.T) {
+		contexts := newToolContexts()
+		ctx, cancel := context.WithCancel(t.Context())
+		defer contexts.begin(ctx, "s1")()
+
+		var calls int
+		td := ToolDefinition{
+			Name: "stock",
+			Handler: func(map[string]any) (string, error) {
+				calls++
+				cancel() // the query is canceled while the call fails
+				return "", errBlip
+			},
+			RetryOnError: transient,
+		}
+
+		result, err := td.toSDKTool(contexts, newManualClock()).Handler(copilot.ToolInvocation{SessionID: "s1", Arguments: map[string]any{}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, "connection reset")
+	})
+}
+
+func TestToolDefinition_StrictArgs(t *testing.T) {
+	called := false
+	td := ToolDefinition{
+		Name:        "lookup",
+		Description: "Looks up an item",
+		Parameters: []ToolParameter{
+			{Name: "sku", Type: "string", Description: "Item SKU", Required: true},
+			{Name: "qty", Type: "number", Description: "Quantity"},
+		},
+		Handler: func(_ map[string]any) (string, error) {
+			called = true
+			return "ok", nil
+		},
+		StrictArgs: true,
+	}
+	tool := td.toSDKTool(nil, realClock{})
+
+	t.Run("missing required parameter", func(t *testing.T) {
+		called = false
+		result, err := tool.Handler(copilot.ToolInvocation{
+			Arguments: map[string]any{"qty": float64(2)},
+		})
+		require.NoError(t, err)
+		assert.False(t, called)
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, `missing required parameter "sku"`)
+	})
+
+	t.Run("type mismatch", func(t *testing.T) {
+		called = false
+		result, err := tool.Handler(copilot.ToolInvocation{
+			Arguments: map[string]any{"sku": "A-1", "qty": "two"},
+		})
+		require.NoError(t, err)
+		assert.False(t, called)
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, `parameter "qty" must be of type number`)
+	})
+
+	t.Run("valid arguments reach handler", func(t *testing.T) {
+		called = false
+		result, err := tool.Handler(copilot.ToolInvocation{
+			Arguments: map[string]any{"sku": "A-1", "qty": float64(2)},
+		})
+		require.NoError(t, err)
+		assert.True(t, called)
+		assert.Equal(t, "success", result.ResultType)
+	})
+
+	t.Run("validation is skipped when not strict", func(t *testing.T) {
+		called = false
+		lax := td
+		lax.StrictArgs = false
+		result, err := lax.toSDKTool(nil, realClock{}).Handler(copilot.ToolInvocation{
+			Arguments: map[string]any{},
+		})
+		require.NoError(t, err)
+		assert.True(t, called)
+		assert.Equal(t, "success", result.ResultType)
+	})
+}
+
 func TestDefineTypedTool(t *testing.T) {
 	type lookupParams struct {
 		Query string `json:"query" description:"The search query"`
@@ -156,6 +484,285 @@ func TestDefineTypedTool(t *testing.T) {
 	assert.NotNil(t, tool.Handler)
 }
 
+func TestWithTypedTool(t *testing.T) {
+	type lookupParams struct {
+		Query string `json:"query" jsonschema:"The search query"`
+		Limit int    `json:"limit,omitempty"`
+	}
+
+	client, err := New(WithTypedTool("search", "Search for items", func(params lookupParams, ctx context.Context) (any, error) {
+		require.NotNil(t, ctx)
+		switch params.Query {
+		case "fail":
+			return nil, errors.New("index unavailable")
+		case "panic":
+			panic("boom")
+		}
+		return map[string]any{"result": params.Query, "limit": params.Limit}, nil
+	}))
+	require.NoError(t, err)
+
+	tools := client.sdkTools()
+	require.Len(t, tools, 1)
+	tool := tools[0]
+	assert.Equal(t, "search", tool.Name)
+	assert.Equal(t, "Search for items", tool.Description)
+	assert.Contains(t, tool.Parameters["properties"], "query")
+
+	invoke := func(args map[string]any) copilot.ToolResult {
+		t.Helper()
+		result, err := tool.Handler(copilot.ToolInvocation{Arguments: args})
+		require.NoError(t, err)
+		return result
+	}
+
+	result := invoke(map[string]any{"query": "widgets", "limit": float64(3)})
+	assert.Equal(t, "success", result.ResultType)
+	assert.JSONEq(t, `{"result":"widgets","limit":3}`, result.TextResultForLLM)
+
+	result = invoke(map[string]any{"query": "fail"})
+	assert.Equal(t, "error", result.ResultType)
+	assert.Equal(t, "error: index unavailable", result.TextResultForLLM)
+
+	result = invoke(map[string]any{"query": "panic"})
+	assert.Equal(t, "error", result.ResultType)
+	assert.Contains(t, result.TextResultForLLM, "tool panicked: boom")
+
+	result = invoke(map[string]any{"query": 42})
+	assert.Equal(t, "error", result.ResultType)
+	assert.Contains(t, result.TextResultForLLM, "failed to unmarshal arguments")
+}
+
+func TestWithTypedTool_Validation(t *testing.T) {
+	handler := func(struct{}, context.Context) (any, error) { return "ok", nil }
+
+	_, err := New(WithTypedTool("", "desc", handler))
+	require.Error(t, err)
+
+	_, err = New(WithTypedTool[struct{}]("noop", "desc", nil))
+	require.Error(t, err)
+
+	_, err = New(WithTypedTool("noop", "desc", handler), WithToolChoice("noop"))
+	require.NoError(t, err)
+
+	client, err := New(WithTypedTool("noop", "desc", handler))
+	require.NoError(t, err)
+	require.ErrorIs(t, client.RegisterTool(ToolDefinition{Name: "noop"}), ErrDuplicateTool)
+	assert.Empty(t, client.Tools())
+}
+
+func TestWithToolConcurrency(t *testing.T) {
+	const limit = 2
+	var (
+		running atomic.Int32
+		peak    atomic.Int32
+		release = make(chan struct{})
+	)
+	handler := func(map[string]any) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		return "ok", nil
+	}
+	client, err := New(WithToolConcurrency(limit), WithTools(
+		ToolDefinition{Name: "a", Handler: handler},
+		ToolDefinition{Name: "b", Handler: handler},
+	))
+	require.NoError(t, err)
+	tools := client.sdkTools()
+
+	// limit+1 concurrent invocations spread across both tools share one limit.
+	var wg sync.WaitGroup
+	for i := range limit + 1 {
+		wg.Go(func() {
+			result, err := tools[i%len(tools)].Handler(copilot.ToolInvocation{Arguments: map[string]any{}})
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", result.TextResultForLLM)
+		})
+	}
+
+	require.Eventually(t, func() bool { return running.Load() == limit }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(limit), running.Load(), "the extra invocation queues")
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(limit), peak.Load())
+
+	_, err = New(WithToolConcurrency(0))
+	require.Error(t, err)
+}
+
+func TestWithToolConcurrencyCanceledWait(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	handler := func(map[string]any) (string, error) {
+		calls.Add(1)
+		<-release
+		return "ok", nil
+	}
+	client, err := New(WithToolConcurrency(1), WithTools(ToolDefinition{Name: "slow", Handler: handler}))
+	require.NoError(t, err)
+	tool := client.sdkTools()[0]
+
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		_, _ = tool.Handler(copilot.ToolInvocation{SessionID: "other", Arguments: map[string]any{}})
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	end := client.cfg.toolCtxs.begin(ctx, "s1")
+	defer end()
+	done := make(chan copilot.ToolResult, 1)
+	go func() {
+		result, err := tool.Handler(copilot.ToolInvocation{SessionID: "s1", Arguments: map[string]any{}})
+		assert.NoError(t, err)
+		done <- result
+	}()
+	cancel()
+
+	select {
+	case result := <-done:
+		assert.Equal(t, "error", result.ResultType)
+		assert.Contains(t, result.TextResultForLLM, "waiting for a tool slot")
+	case <-time.After(time.Second):
+		t.Fatal("the canceled call kept waiting for a slot")
+	}
+	assert.Equal(t, int32(1), calls.Load(), "the canceled call never ran")
+
+	close(release)
+	<-held
+}
+
+func TestWithMaxToolRounds(t *testing.T) {
+	const limit = 3
+	var executed atomic.Int32
+	var client *Client
+	client = newTestClient(&mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			sess := &mockSDKSession{id: "loop"}
+			sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+				// The model keeps calling the tool, ignoring its results.
+				tool := client.sdkTools()[0]
+				var last copilot.ToolResult
+				for range limit + 2 {
+					result, err := tool.Handler(copilot.ToolInvocation{SessionID: "loop", Arguments: map[string]any{}})
+					require.NoError(t, err)
+					last = result
+				}
+				go func() {
+					sess.emit(&copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr(last.TextResultForLLM)}})
+					sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+				}()
+				return testMsgID, nil
+			}
+			return sess, nil
+		},
+	}, WithMaxToolRounds(limit), WithTools(ToolDefinition{
+		Name: "search",
+		Handler: func(map[string]any) (string, error) {
+			executed.Add(1)
+			return "more results", nil
+		},
+	}))
+
+	result, err := client.QueryWithSession(t.Context(), "", "hi")
+	require.NoError(t, err)
+	assert.Equal(t, int32(limit), executed.Load(), "calls beyond the cap never reach the handler")
+	assert.Contains(t, result.Content, ErrToolLoopExceeded.Error())
+	assert.Contains(t, result.Content, "answer with the information you already have")
+
+	// The budget resets with every query, streaming included.
+	events, _, err := client.QueryStream(t.Context(), "", "again")
+	require.NoError(t, err)
+	drain(events)
+	assert.Equal(t, int32(2*limit), executed.Load())
+
+	// Calls outside a query are not counted.
+	_, err = client.sdkTools()[0].Handler(copilot.ToolInvocation{SessionID: "other", Arguments: map[string]any{}})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2*limit+1), executed.Load())
+
+	_, err = New(WithMaxToolRounds(0))
+	require.Error(t, err)
+}
+
+func TestWithTypedTool_QueryContext(t *testing.T) {
+	type params struct{}
+
+	// newClient returns a client whose sessions call the blocking tool once
+	// per message and go idle when it returns, reporting the tool's error.
+	newClient := func(t *testing.T) (client *Client, started <-chan struct{}, stopped <-chan error) {
+		t.Helper()
+		start := make(chan struct{}, 1)
+		stop := make(chan error, 1)
+		session := func(id string) *mockSDKSession {
+			sess := &mockSDKSession{id: id}
+			sess.sendFn = func(context.Context, copilot.MessageOptions) (string, error) {
+				go func() {
+					_, _ = client.sdkTools()[0].Handler(copilot.ToolInvocation{SessionID: id, Arguments: map[string]any{}})
+					sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+				}()
+				return testMsgID, nil
+			}
+			return sess
+		}
+		client = newTestClient(&mockSDKClient{
+			createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) { return session("tools"), nil },
+			resumeFn: func(_ context.Context, id string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+				return session(id), nil
+			},
+		}, WithTypedTool("crunch", "Expensive work", func(_ params, ctx context.Context) (any, error) {
+			start <- struct{}{}
+			<-ctx.Done()
+			stop <- ctx.Err()
+			return nil, ctx.Err()
+		}))
+		return client, start, stop
+	}
+
+	t.Run("canceling the query cancels the tool", func(t *testing.T) {
+		client, started, stopped := newClient(t)
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error, 1)
+		go func() {
+			_, err := client.QueryWithSession(ctx, "", "crunch")
+			done <- err
+		}()
+
+		<-started
+		cancel()
+		require.ErrorIs(t, <-stopped, context.Canceled)
+		require.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("aborting the session cancels the tool", func(t *testing.T) {
+		client, started, stopped := newClient(t)
+		events, sid, err := client.QueryStream(t.Context(), "", "crunch")
+		require.NoError(t, err)
+
+		<-started
+		require.NoError(t, client.AbortSession(t.Context(), sid))
+		require.ErrorIs(t, <-stopped, context.Canceled)
+		drain(events)
+	})
+
+	t.Run("calls outside a query are not canceled", func(t *testing.T) {
+		client, _, _ := newClient(t)
+		ctx := client.cfg.toolCtxs.get("unknown")
+		assert.NoError(t, ctx.Err())
+		assert.Nil(t, ctx.Done(), "context.Background is never canceled")
+	})
+}
+
 func TestToolDefinition_AllRequiredParams(t *testing.T) {
 	td := ToolDefinition{
 		Name:        "all_required",
@@ -168,7 +775,7 @@ func TestToolDefinition_AllRequiredParams(t *testing.T) {
 		Handler: func(_ map[string]any) (string, error) { return "ok", nil },
 	}
 
-	tool := td.toSDKTool()
+	tool := td.toSDKTool(nil, realClock{})
 	required := tool.Parameters["required"].([]string)
 	assert.Len(t, required, 3)
 	assert.Contains(t, required, "a")
@@ -187,7 +794,7 @@ func TestToolDefinition_NoRequiredParams(t *testing.T) {
 		Handler: func(_ map[string]any) (string, error) { return "ok", nil },
 	}
 
-	tool := td.toSDKTool()
+	tool := td.toSDKTool(nil, realClock{})
 	required := tool.Parameters["required"].([]string)
 	assert.Empty(t, required)
 }
@@ -0,0 +1,166 @@
+package copilotcli
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// ToolDefinitionFromStruct builds a ToolDefinition whose Parameters are
+// derived from the exported fields of paramsStruct, a struct or a pointer to
+// one, so the schema cannot drift from the Go type the arguments are decoded
+// into:
+//
+//	type OrderParams struct {
+//		OrderID string   `json:"order_id" description:"The order ID"`
+//		Notify  *bool    `json:"notify" description:"Email the customer"`
+//		Tags    []string `json:"tags,omitempty"`
+//	}
+//
+//	td, err := copilotcli.ToolDefinitionFromStruct("cancel_order", "Cancel an order", OrderParams{}, handler)
+//
+// Parameter names come from the json tag (fields tagged "-" are skipped) and
+// descriptions from the description tag. A field is required if its validate
+// tag includes "required"; otherwise it is required unless it is a pointer or
+// its json tag has omitempty. Strings, bools, integers, floats, slices,
+// arrays, maps, time.Time (as a string), and nested structs are supported;
+// embedded structs without a json name are flattened as by encoding/json.
+func ToolDefinitionFromStruct(name, description string, paramsStruct any, handler ToolHandler) (ToolDefinition, error) {
+	if name == "" {
+		return ToolDefinition{}, errors.New("tool name must not be empty")
+	}
+	if handler == nil {
+		return ToolDefinition{}, errors.New("tool handler must not be nil")
+	}
+
+	t := reflect.TypeOf(paramsStruct)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return ToolDefinition{}, fmt.Errorf("tool %s: params must be a struct, got %T", name, paramsStruct)
+	}
+
+	params, err := structParameters(t, map[reflect.Type]bool{})
+	if err != nil {
+		return ToolDefinition{}, fmt.Errorf("tool %s: %w", name, err)
+	}
+	return ToolDefinition{
+		Name:        name,
+		Description: description,
+		Parameters:  params,
+		Handler:     handler,
+	}, nil
+}
+
+// structParameters describes the exported fields of struct type t. visiting
+// holds the struct types being described, to reject recursive types.
+func structParameters(t reflect.Type, visiting map[reflect.Type]bool) ([]ToolParameter, error) {
+	if visiting[t] {
+		return nil, fmt.Errorf("recursive type %s is not supported", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var params []ToolParameter
+	for _, f := range reflect.VisibleFields(t) {
+		if len(f.Index) > 1 {
+			// Promoted fields are reached through their embedded struct.
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		jsonName, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && jsonName == "" && indirect(f.Type).Kind() == reflect.Struct {
+			embedded, err := structParameters(indirect(f.Type), visiting)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, embedded...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		p, err := typeParameter(f.Type, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		p.Name = jsonName
+		if p.Name == "" {
+			p.Name = f.Name
+		}
+		p.Description = f.Tag.Get("description")
+		p.Required = hasTagOption(f.Tag.Get("validate"), "required") ||
+			(f.Type.Kind() != reflect.Pointer && !hasTagOption(opts, "omitempty"))
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// typeParameter describes a value of type t, without name or description.
+func typeParameter(t reflect.Type, visiting map[reflect.Type]bool) (ToolParameter, error) {
+	t = indirect(t)
+	if t == timeType {
+		return ToolParameter{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return ToolParameter{Type: "string"}, nil
+	case reflect.Bool:
+		return ToolParameter{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ToolParameter{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return ToolParameter{Type: "number"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json sends byte slices, but not byte arrays, as
+			// base64 strings.
+			return ToolParameter{Type: "string"}, nil
+		}
+		items, err := typeParameter(t.Elem(), visiting)
+		if err != nil {
+			return ToolParameter{}, err
+		}
+		return ToolParameter{Type: "array", Items: &items}, nil
+	case reflect.Map:
+		return ToolParameter{Type: "object"}, nil
+	case reflect.Struct:
+		props, err := structParameters(t, visiting)
+		if err != nil {
+			return ToolParameter{}, err
+		}
+		return ToolParameter{Type: "object", Properties: props}, nil
+	default:
+		return ToolParameter{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// indirect returns the type pointed to by t, following any pointers.
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// hasTagOption reports whether the comma-separated tag value contains option.
+func hasTagOption(tag, option string) bool {
+	for opt := range strings.SplitSeq(tag, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package copilotcli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type addressParams struct {
+	Street string  `json:"street" description:"Street and number"`
+	Zip    *string `json:"zip"`
+}
+
+type auditInfo struct {
+	Reason string `json:"reason,omitempty" validate:"required" description:"Why the order changes"`
+}
+
+type orderParams struct {
+	auditInfo
+
+	OrderID  string            `json:"order_id" description:"The order ID"`
+	Quantity int               `json:"quantity"`
+	Price    float64           `json:"price,omitempty"`
+	Express  bool              `json:"express"`
+	Gift     *bool             `json:"gift"`
+	Tags     []string          `json:"tags,omitempty"`
+	Due      time.Time         `json:"due,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Address  addressParams     `json:"address" description:"Delivery address"`
+	Internal string            `json:"-"`
+	Untagged string
+	ignored  string
+}
+
+func noopHandler(map[string]any) (string, error) { return "ok", nil }
+
+func TestToolDefinitionFromStruct(t *testing.T) {
+	td, err := ToolDefinitionFromStruct("update_order", "Update an order", &orderParams{}, noopHandler)
+	require.NoError(t, err)
+
+	assert.Equal(t, "update_order", td.Name)
+	assert.Equal(t, "Update an order", td.Description)
+	assert.NotNil(t, td.Handler)
+	assert.Equal(t, []ToolParameter{
+		{Name: "reason", Type: "string", Description: "Why the order changes", Required: true},
+		{Name: "order_id", Type: "string", Description: "The order ID", Required: true},
+		{Name: "quantity", Type: "integer", Required: true},
+		{Name: "price", Type: "number"},
+		{Name: "express", Type: "boolean", Required: true},
+		{Name: "gift", Type: "boolean"},
+		{Name: "tags", Type: "array", Items: &ToolParameter{Type: "string"}},
+		{Name: "due", Type: "string"},
+		{Name: "meta", Type: "object"},
+		{Name: "address", Type: "object", Description: "Delivery address", Required: true, Properties: []ToolParameter{
+			{Name: "street", Type: "string", Description: "Street and number", Required: true},
+			{Name: "zip", Type: "string"},
+		}},
+		{Name: "Untagged", Type: "string", Required: true},
+	}, td.Parameters)
+	_ = orderParams{}.ignored
+}
+
+func TestToolDefinitionFromStruct_Bytes(t *testing.T) {
+	type blobParams struct {
+		Payload  []byte   `json:"payload"`
+		Checksum [4]byte  `json:"checksum"`
+		Chunks   [][]byte `json:"chunks"`
+	}
+	td, err := ToolDefinitionFromStruct("upload", "Upload a blob", blobParams{}, noopHandler)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ToolParameter{
+		{Name: "payload", Type: "string", Required: true},
+		{Name: "checksum", Type: "array", Items: &ToolParameter{Type: "integer"}, Required: true},
+		{Name: "chunks", Type: "array", Items: &ToolParameter{Type: "string"}, Required: true},
+	}, td.Parameters)
+}
+
+func TestToolDefinitionFromStruct_StrictArgs(t *testing.T) {
+	td, err := ToolDefinitionFromStruct("ship", "Ship an address", addressParams{}, noopHandler)
+	require.NoError(t, err)
+
+	require.NoError(t, validateArgs(td.Parameters, map[string]any{"street": "Main St 1"}, ""))
+	require.EqualError(t, validateArgs(td.Parameters, map[string]any{"zip": "12345"}, ""), `missing required parameter "street"`)
+	require.EqualError(t, validateArgs(td.Parameters, map[string]any{"street": 1.0}, ""), `parameter "street" must be of type string, got float64`)
+}
+
+func TestToolDefinitionFromStruct_Errors(t *testing.T) {
+	type recursive struct {
+		Next *recursive `json:"next"`
+	}
+	type withChan struct {
+		C chan int `json:"c"`
+	}
+
+	tests := []struct {
+		name    string
+		tool    string
+		params  any
+		handler ToolHandler
+		want    string
+	}{
+		{"empty name", "", addressParams{}, noopHandler, "tool name must not be empty"},
+		{"nil handler", "t", addressParams{}, nil, "tool handler must not be nil"},
+		{"nil params", "t", nil, noopHandler, "params must be a struct, got <nil>"},
+		{"not a struct", "t", "x", noopHandler, "params must be a struct, got string"},
+		{"recursive", "t", recursive{}, noopHandler, "recursive type"},
+		{"unsupported", "t", withChan{}, noopHandler, "field C: unsupported type chan int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ToolDefinitionFromStruct(tt.tool, "desc", tt.params, tt.handler)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package copilotcli
+
+import (
+	copilot "github.com/github/copilot-sdk/go"
+)
+
+// Usage is the token usage the sidecar reported for one query. A turn that
+// calls tools makes several model requests; their usage is summed.
+type Usage struct {
+	InputTokens      int
+	OutputTokens     int
+	CacheReadTokens  int
+	CacheWriteTokens int
+}
+
+// add accumulates the token counts of an AssistantUsage event.
+func (u *Usage) add(data *copilot.Data) {
+	u.InputTokens += tokenCount(data.InputTokens)
+	u.OutputTokens += tokenCount(data.OutputTokens)
+	u.CacheReadTokens += tokenCount(data.CacheReadTokens)
+	u.CacheWriteTokens += tokenCount(data.CacheWriteTokens)
+}
+
+func tokenCount(v *float64) int {
+	if v == nil {
+		return 0
+	}
+	return int(*v)
+}
+
+// CostModel estimates the cost of a query from its usage and the model it ran
+// on, in whatever currency unit the caller chooses. See WithCostModel.
+type CostModel func(usage Usage, model string) float64
+
+// estimateCost applies the WithCostModel cost model, or returns 0 if none is
+// configured.
+func (c *Client) estimateCost(usage Usage, model string) float64 {
+	if c.cfg.costModel == nil {
+		return 0
+	}
+	return c.cfg.costModel(usage, c.sessionModel(model))
+}
@@ -0,0 +1,125 @@
+package copilotcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usageSession replies "ok" after two usage reports, as a turn with a tool
+// call would.
+func usageSession(id string) *mockSDKSession {
+	return streamSession(id,
+		copilot.SessionEvent{Type: copilot.AssistantUsage, Data: copilot.Data{InputTokens: ptr(100.0), OutputTokens: ptr(10.0), CacheReadTokens: ptr(50.0)}},
+		copilot.SessionEvent{Type: copilot.AssistantUsage, Data: copilot.Data{InputTokens: ptr(120.0), OutputTokens: ptr(5.0)}},
+		copilot.SessionEvent{Type: copilot.AssistantMessage, Data: copilot.Data{Content: ptr("ok")}},
+		copilot.SessionEvent{Type: copilot.SessionIdle},
+	)
+}
+
+// perToken charges 1 per input token and 2 per output token, recording the
+// model it was called with.
+func perToken(gotModel *string) CostModel {
+	return func(u Usage, model string) float64 {
+		*gotModel = model
+		return float64(u.InputTokens) + 2*float64(u.OutputTokens)
+	}
+}
+
+func TestQuery_Usage(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return usageSession("s1"), nil
+		},
+	}
+	client := newTestClient(mock)
+
+	result, err := client.Query(t.Context(), "hi")
+
+	require.NoError(t, err)
+	assert.Equal(t, Usage{InputTokens: 220, OutputTokens: 15, CacheReadTokens: 50}, result.Usage)
+	assert.Zero(t, result.EstimatedCost)
+}
+
+func TestWithCostModel_Query(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return usageSession("s1"), nil
+		},
+	}
+	var model string
+	client := newTestClient(mock, WithCostModel(perToken(&model)))
+
+	result, err := client.QueryWithOptions(t.Context(), QueryOptions{Prompt: "hi", Model: "claude-sonnet-4"})
+
+	require.NoError(t, err)
+	assert.InDelta(t, 250.0, result.EstimatedCost, 1e-9)
+	assert.Equal(t, "claude-sonnet-4", model)
+}
+
+func TestWithCostModel_Stream(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return usageSession("s1"), nil
+		},
+	}
+	var model string
+	client := newTestClient(mock, WithCostModel(perToken(&model)))
+
+	events, _, err := client.QueryStream(t.Context(), "", "hi")
+	require.NoError(t, err)
+
+	var final StreamEvent
+	for event := range events {
+		if event.IsFinal {
+			final = event
+		}
+	}
+	assert.Equal(t, Usage{InputTokens: 220, OutputTokens: 15, CacheReadTokens: 50}, final.Usage)
+	assert.InDelta(t, 250.0, final.EstimatedCost, 1e-9)
+	assert.Equal(t, "gpt-4o", model)
+}
+
+func TestStreamTo_Cost(t *testing.T) {
+	client := newTestClient(&mockSDKClient{}, WithCostModel(func(Usage, string) float64 { return 0 }))
+
+	events := make(chan StreamEvent, 1)
+	events <- StreamEvent{Content: "Hi", IsFinal: true, ChunkCount: 1, SessionID: "s1", EstimatedCost: 0.25}
+	close(events)
+
+	var buf bytes.Buffer
+	require.NoError(t, streamTo(t.Context(), &buf, nil, events, client.sseFormat(false)))
+	assert.Equal(t,
+		"data: {\"chunk_count\":1,\"content\":\"Hi\",\"cost\":0.25,\"elapsed_ms\":0,\"final\":true,\"session_id\":\"s1\"}\n\n",
+		buf.String())
+}
+
+func TestWithCostModel_Validation(t *testing.T) {
+	_, err := New(WithCostModel(nil))
+	require.Error(t, err)
+
+	client, err := New()
+	require.NoError(t, err)
+	assert.Nil(t, client.cfg.costModel)
+	assert.False(t, client.sseFormat(false).cost)
+}
+
+func TestNewAnthropicMessagesHandler_Usage(t *testing.T) {
+	mock := &mockSDKClient{
+		createFn: func(context.Context, *copilot.SessionConfig) (SDKSession, error) {
+			return usageSession("s1"), nil
+		},
+	}
+	handler := NewAnthropicMessagesHandler(newTestClient(mock))
+
+	rec := postAnthropic(t, handler, `{"messages": [{"role": "user", "content": "hi"}]}`)
+
+	var resp anthropicResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, anthropicUsage{InputTokens: 220, OutputTokens: 15}, resp.Usage)
+}
@@ -0,0 +1,125 @@
+package copilotcli
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// toolNamePattern matches the tool names model providers accept.
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// validParameterTypes are the JSON schema types a ToolParameter may declare.
+var validParameterTypes = map[string]bool{
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+}
+
+// Validate checks the client's configuration without connecting to the
+// sidecar, for use in CI. Beyond the checks New performs, it verifies that
+// every tool has a well-formed name, a handler, and a valid parameter schema,
+// that tool names are unique, and that BYOK and fallback providers have a
+// known type and an absolute http or https base URL. It reports every problem
+// found, joined with errors.Join; tool problems wrap ErrInvalidTool and
+// provider problems wrap ErrInvalidProvider.
+func (c *Client) Validate() error {
+	var errs []error
+	if err := c.cfg.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	c.toolsMu.RLock()
+	seen := make(map[string]bool, len(c.cfg.tools)+len(c.cfg.typedTools))
+	checkName := func(name string) {
+		if !toolNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("%w: tool name %q must be 1-64 letters, digits, underscores, or hyphens", ErrInvalidTool, name))
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("%w: tool %q is defined more than once", ErrInvalidTool, name))
+		}
+		seen[name] = true
+	}
+	for _, td := range c.cfg.tools {
+		checkName(td.Name)
+		switch {
+		case td.Handler == nil && td.StructuredHandler == nil:
+			errs = append(errs, fmt.Errorf("%w: tool %q has no handler", ErrInvalidTool, td.Name))
+		case td.Handler != nil && td.StructuredHandler != nil:
+			errs = append(errs, fmt.Errorf("%w: tool %q has both Handler and StructuredHandler", ErrInvalidTool, td.Name))
+		}
+		for _, err := range validateParameters(td.Parameters, "") {
+			errs = append(errs, fmt.Errorf("%w: tool %q: %w", ErrInvalidTool, td.Name, err))
+		}
+	}
+	for _, t := range c.cfg.typedTools {
+		checkName(t.Name)
+	}
+	c.toolsMu.RUnlock()
+
+	if c.cfg.authMode == AuthModeBYOK {
+		if err := validateProvider(c.cfg.providerType, c.cfg.providerBaseURL); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidProvider, err))
+		}
+	}
+	for i, fb := range c.cfg.fallbacks {
+		if err := validateProvider(fb.providerType, fb.baseURL); err != nil {
+			errs = append(errs, fmt.Errorf("%w: fallback provider %d: %w", ErrInvalidProvider, i+1, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateParameters checks a parameter list and the schemas nested in it.
+// prefix qualifies nested parameter names in error messages.
+func validateParameters(params []ToolParameter, prefix string) []error {
+	var errs []error
+	seen := make(map[string]bool, len(params))
+	for _, p := range params {
+		name := prefix + p.Name
+		switch {
+		case p.Name == "":
+			errs = append(errs, fmt.Errorf("parameter %q has an empty name", name))
+		case seen[p.Name]:
+			errs = append(errs, fmt.Errorf("parameter %q is defined more than once", name))
+		}
+		seen[p.Name] = true
+		errs = append(errs, validateParameter(p, name)...)
+	}
+	return errs
+}
+
+// validateParameter checks a single parameter's schema; name is its
+// qualified name.
+func validateParameter(p ToolParameter, name string) []error {
+	if !validParameterTypes[p.Type] {
+		return []error{fmt.Errorf("parameter %q has unknown type %q", name, p.Type)}
+	}
+
+	var errs []error
+	if len(p.Enum) > 0 && p.Type != "string" {
+		errs = append(errs, fmt.Errorf("parameter %q: enum requires type string, not %s", name, p.Type))
+	}
+	if p.Items != nil {
+		if p.Type != "array" {
+			errs = append(errs, fmt.Errorf("parameter %q: items requires type array, not %s", name, p.Type))
+		}
+		errs = append(errs, validateParameter(*p.Items, name+"[]")...)
+	}
+	if len(p.Properties) > 0 {
+		if p.Type != "object" {
+			errs = append(errs, fmt.Errorf("parameter %q: properties require type object, not %s", name, p.Type))
+		}
+		errs = append(errs, validateParameters(p.Properties, name+".")...)
+	}
+	if p.Default != nil {
+		if err := validateValue(p, p.Default, name); err != nil {
+			errs = append(errs, fmt.Errorf("default value: %w", err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,104 @@
+package copilotcli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Validate(t *testing.T) {
+	okHandler := func(map[string]any) (string, error) { return "ok", nil }
+
+	t.Run("valid configuration", func(t *testing.T) {
+		client, err := New(
+			WithBYOK(ProviderAzure, "https://example.openai.azure.com", "key"),
+			WithFallbackProvider(ProviderOpenAI, "https://api.openai.com/v1", "key"),
+			WithTools(ToolDefinition{
+				Name:    "lookup_inventory",
+				Handler: okHandler,
+				Parameters: []ToolParameter{
+					{Name: "sku", Type: "string", Required: true, Enum: []string{"a", "b"}, Default: "a"},
+					{Name: "tags", Type: "array", Items: &ToolParameter{Type: "string"}},
+					{Name: "filter", Type: "object", Properties: []ToolParameter{{Name: "min", Type: "integer"}}},
+				},
+			}),
+			WithTypedTool("search", "Search", func(struct{}, context.Context) (any, error) { return nil, nil }),
+		)
+		require.NoError(t, err)
+		require.NoError(t, client.Validate())
+	})
+
+	t.Run("malformed tool", func(t *testing.T) {
+		client, err := New(WithTools(
+			ToolDefinition{
+				Name: "bad tool",
+				Parameters: []ToolParameter{
+					{Name: "", Type: "string"},
+					{Name: "count", Type: "int"},
+					{Name: "mode", Type: "number", Enum: []string{"fast"}},
+					{Name: "list", Type: "array", Items: &ToolParameter{Type: "map"}},
+					{Name: "opts", Type: "object", Properties: []ToolParameter{{Name: "x", Type: "string"}, {Name: "x", Type: "string"}}},
+					{Name: "flag", Type: "boolean", Default: "yes"},
+				},
+			},
+			ToolDefinition{Name: "ok", Handler: okHandler},
+		))
+		require.NoError(t, err, "New does not inspect tool schemas")
+
+		err = client.Validate()
+		require.ErrorIs(t, err, ErrInvalidTool)
+		msg := err.Error()
+		for _, want := range []string{
+			`tool name "bad tool"`,
+			`tool "bad tool" has no handler`,
+			`parameter "" has an empty name`,
+			`parameter "count" has unknown type "int"`,
+			`parameter "mode": enum requires type string`,
+			`parameter "list[]" has unknown type "map"`,
+			`parameter "opts.x" is defined more than once`,
+			`default value: parameter "flag" must be of type boolean`,
+		} {
+			assert.Contains(t, msg, want)
+		}
+		assert.NotContains(t, msg, `"ok"`)
+	})
+
+	t.Run("structured handler", func(t *testing.T) {
+		structured := func(map[string]any) (ToolResult, error) { return ToolResult{}, nil }
+		client, err := New(WithTools(
+			ToolDefinition{Name: "structured", StructuredHandler: structured},
+			ToolDefinition{Name: "both", Handler: okHandler, StructuredHandler: structured},
+		))
+		require.NoError(t, err)
+		err = client.Validate()
+		require.ErrorIs(t, err, ErrInvalidTool)
+		assert.Contains(t, err.Error(), `tool "both" has both Handler and StructuredHandler`)
+		assert.NotContains(t, err.Error(), `"structured"`)
+	})
+
+	t.Run("duplicate tool names", func(t *testing.T) {
+		client, err := New(
+			WithTools(ToolDefinition{Name: "search", Handler: okHandler}),
+			WithTypedTool("search", "Search", func(struct{}, context.Context) (any, error) { return nil, nil }),
+		)
+		require.NoError(t, err)
+		err = client.Validate()
+		require.ErrorIs(t, err, ErrInvalidTool)
+		assert.Contains(t, err.Error(), `tool "search" is defined more than once`)
+	})
+
+	t.Run("malformed providers", func(t *testing.T) {
+		client, err := New(
+			WithBYOK("gemini", "https://example.com", "key"),
+			WithFallbackProvider(ProviderOpenAI, "api.openai.com", "key"),
+		)
+		require.NoError(t, err)
+
+		err = client.Validate()
+		require.ErrorIs(t, err, ErrInvalidProvider)
+		assert.Contains(t, err.Error(), `unknown provider type "gemini"`)
+		assert.Contains(t, err.Error(), `fallback provider 1: base URL "api.openai.com"`)
+	})
+}
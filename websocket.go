@@ -0,0 +1,168 @@
+package copilotcli
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// wsRequest is a prompt frame sent by a WebSocket client.
+type wsRequest struct {
+	Prompt    string `json:"prompt"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// wsResponse is a frame sent to a WebSocket client.
+type wsResponse struct {
+	Type      string `json:"type"`
+	Delta     string `json:"delta,omitempty"`
+	Reasoning string `json:"reasoning,omitempty"`
+	Content   string `json:"content,omitempty"`
+	Error     string `json:"error,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// WebSocket frame types sent by NewWebSocketHandler.
+const (
+	wsFrameDelta     = "delta"
+	wsFrameReasoning = "reasoning"
+	wsFrameFinal     = "final"
+	wsFrameError     = "error"
+)
+
+// NewWebSocketHandler returns an http.HandlerFunc that upgrades the connection
+// to a WebSocket and streams LLM responses over it. Unlike NewStreamHandler,
+// the client can send follow-up prompts on the same connection.
+//
+// The client sends JSON text frames, one per prompt:
+//
+//	{"prompt": "...", "session_id": "..."}
+//
+// session_id is optional; when omitted, the session of the previous prompt on
+// this connection is reused, so consecutive prompts form a multi-turn
+// conversation. The server replies with a sequence of frames per prompt:
+//
+//	{"type": "delta", "delta": "...", "session_id": "..."}
+//	{"type": "reasoning", "reasoning": "...", "session_id": "..."}
+//	{"type": "final", "content": "...", "session_id": "..."}
+//	{"type": "error", "error": "...", "session_id": "..."}
+//
+// Each prompt ends with exactly one "final" or "error" frame. Prompts are
+// processed one at a time in the order received. Closing the connection
+// aborts the active query.
+//
+// Example registration:
+//
+//	mux.HandleFunc("GET /api/copilot/ws", copilotcli.NewWebSocketHandler(client))
+func NewWebSocketHandler(client CopilotClient) http.HandlerFunc {
+	h := handlerClient(client)
+	return RateLimit(h, func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			// Accept has already written an HTTP error response.
+			return
+		}
+		defer func() { _ = conn.CloseNow() }()
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+
+		// Read frames concurrently so a close from the client is noticed (and
+		// the active query canceled) while a response is still streaming.
+		requests := make(chan wsRequest)
+		go func() {
+			defer cancel()
+			for {
+				var req wsRequest
+				if err := wsjson.Read(ctx, conn, &req); err != nil {
+					return
+				}
+				select {
+				case requests <- req:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		var sessionID string
+		for {
+			var req wsRequest
+			select {
+			case req = <-requests:
+			case <-ctx.Done():
+				return
+			}
+
+			if req.SessionID != "" {
+				sessionID = req.SessionID
+			}
+
+			if strings.TrimSpace(req.Prompt) == "" {
+				if err := wsjson.Write(ctx, conn, wsResponse{Type: wsFrameError, Error: "prompt is required", SessionID: sessionID}); err != nil {
+					return
+				}
+				continue
+			}
+
+			next, err := streamWebSocket(ctx, conn, client, sessionID, req.Prompt)
+			if next != "" {
+				sessionID = next
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
+
+// streamWebSocket runs a single streaming query and writes its frames to conn.
+// It returns the session ID used and a non-nil error only when the connection
+// is no longer usable.
+func streamWebSocket(ctx context.Context, conn *websocket.Conn, client CopilotClient, sessionID, prompt string) (string, error) {
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, sid, err := client.QueryStream(queryCtx, sessionID, prompt)
+	if err != nil {
+		return "", wsjson.Write(ctx, conn, wsResponse{Type: wsFrameError, Error: err.Error(), SessionID: sessionID})
+	}
+
+	for {
+		var (
+			event StreamEvent
+			ok    bool
+		)
+		select {
+		case event, ok = <-events:
+		case <-ctx.Done():
+			return sid, ctx.Err()
+		}
+		if !ok {
+			return sid, nil
+		}
+		if event.Raw != nil {
+			continue
+		}
+
+		frame := wsResponse{Type: wsFrameDelta, Delta: event.DeltaContent, SessionID: sid}
+		switch {
+		case event.Error != nil:
+			frame = wsResponse{Type: wsFrameError, Error: event.Error.Error(), SessionID: sid}
+		case event.IsFinal:
+			frame = wsResponse{Type: wsFrameFinal, Content: event.Content, SessionID: sid}
+		case event.ReasoningDelta != "":
+			frame = wsResponse{Type: wsFrameReasoning, Reasoning: event.ReasoningDelta, SessionID: sid}
+		}
+
+		if err := wsjson.Write(ctx, conn, frame); err != nil {
+			return sid, err
+		}
+		if frame.Type == wsFrameFinal || frame.Type == wsFrameError {
+			return sid, nil
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package copilotcli
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	copilot "github.com/github/copilot-sdk/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dialTestWebSocket(t *testing.T, client *Client) *websocket.Conn {
+	t.Helper()
+
+	srv := httptest.NewServer(NewWebSocketHandler(client))
+	t.Cleanup(srv.Close)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conn, _, err := websocket.Dial(t.Context(), url, nil) //nolint:bodyclose // websocket.Dial closes the response body
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.CloseNow() })
+	return conn
+}
+
+func readTestFrame(t *testing.T, conn *websocket.Conn) wsResponse {
+	t.Helper()
+
+	var frame wsResponse
+	require.NoError(t, wsjson.Read(t.Context(), conn, &frame))
+	return frame
+}
+
+func TestNewWebSocketHandler_MultiTurn(t *testing.T) {
+	sess := &mockSDKSession{id: "ws-sess"}
+	var resumedID string
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return sess, nil
+		},
+		resumeFn: func(_ context.Context, sessionID string, _ *copilot.ResumeSessionConfig) (SDKSession, error) {
+			resumedID = sessionID
+			return sess, nil
+		},
+	}
+
+	sess.sendFn = func(_ context.Context, opts copilot.MessageOptions) (string, error) {
+		go func() {
+			sess.emit(&copilot.SessionEvent{
+				Type: copilot.AssistantMessageDelta,
+				Data: copilot.Data{DeltaContent: ptr("re: " + opts.Prompt)},
+			})
+			sess.emit(&copilot.SessionEvent{Type: copilot.SessionIdle})
+		}()
+		return testMsgID, nil
+	}
+
+	conn := dialTestWebSocket(t, newTestClient(mock))
+	ctx := t.Context()
+
+	require.NoError(t, wsjson.Write(ctx, conn, wsRequest{Prompt: "first"}))
+
+	assert.Equal(t, wsResponse{Type: "delta", Delta: "re: first", SessionID: "ws-sess"}, readTestFrame(t, conn))
+	assert.Equal(t, wsResponse{Type: "final", Content: "re: first", SessionID: "ws-sess"}, readTestFrame(t, conn))
+
+	// The follow-up omits session_id and must continue the same session.
+	require.NoError(t, wsjson.Write(ctx, conn, wsRequest{Prompt: "second"}))
+
+	assert.Equal(t, "re: second", readTestFrame(t, conn).Delta)
+	assert.Equal(t, "final", readTestFrame(t, conn).Type)
+	assert.Equal(t, "ws-sess", resumedID)
+}
+
+func TestNewWebSocketHandler_EmptyPrompt(t *testing.T) {
+	conn := dialTestWebSocket(t, newTestClient(&mockSDKClient{}))
+
+	require.NoError(t, wsjson.Write(t.Context(), conn, wsRequest{Prompt: "  "}))
+
+	frame := readTestFrame(t, conn)
+	assert.Equal(t, "error", frame.Type)
+	assert.Equal(t, "prompt is required", frame.Error)
+}
+
+func TestNewWebSocketHandler_CloseAbortsQuery(t *testing.T) {
+	sess := &mockSDKSession{id: "ws-abort"}
+	aborted := make(chan struct{})
+	sess.abortFn = func(_ context.Context) error {
+		close(aborted)
+		return nil
+	}
+	mock := &mockSDKClient{
+		createFn: func(_ context.Context, _ *copilot.SessionConfig) (SDKSession, error) {
+			return sess, nil
+		},
+	}
+
+	sent := make(chan struct{})
+	sess.sendFn = func(_ context.Context, _ copilot.MessageOptions) (string, error) {
+		// Never complete — the query stays active until the client goes away.
+		close(sent)
+		return testMsgID, nil
+	}
+
+	conn := dialTestWebSocket(t, newTestClient(mock))
+	require.NoError(t, wsjson.Write(t.Context(), conn, wsRequest{Prompt: "long running"}))
+	<-sent
+
+	require.NoError(t, conn.Close(websocket.StatusNormalClosure, "bye"))
+
+	select {
+	case <-aborted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("active query was not aborted after the client closed the connection")
+	}
+}